@@ -2,104 +2,227 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"j-project/src/server"
 	"j-project/src/utils/ai"
+	"j-project/src/utils/dump"
+	"j-project/src/utils/logsample"
+	"j-project/src/utils/metrics"
+	"j-project/src/utils/redact"
 	"j-project/src/utils/tts"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
-}
-
 func main() {
 	// Load .env file if present
 	_ = godotenv.Load()
 
-	// Demonstrate prompting the AI (which may invoke web search internally)
-	ctx := context.Background()
-	prompt := "What are some common concurrency patterns in Go?"
-	log.Printf("Prompting AI (ollama): %s", prompt)
-	aiResponse := ""
-	err := ai.Stream(ctx, "ollama", prompt, func(chunk string) {
-		log.Printf("AI chunk: %s", chunk)
-		aiResponse += chunk + " "
-	})
-	if err != nil {
-		log.Printf("AI error: %v", err)
-	} else {
-		log.Printf("AI full response: %s", aiResponse)
+	// METRICS=prometheus keeps metrics in memory and serves them at /metrics
+	if os.Getenv("METRICS") == "prometheus" {
+		metrics.Set(metrics.NewPrometheus())
 	}
 
-	ginrouter := gin.Default()
+	// report TTS availability once, up front
+	tts.Probe()
+
+	// Startup tasks run concurrently (STARTUP_CONCURRENCY, default 3) for at most
+	// STARTUP_TIMEOUT (default 30s). Fatal ones (only a strict config validation) finish
+	// before the server listens; the rest run once it is serving, so readiness probes
+	// pass right away, and are cancelled by shutdown. Each one can be turned off.
+	var tasks []startupTask
+
+	// check provider configuration; VALIDATE_CONFIG=strict refuses to start on problems,
+	// VALIDATE_CONFIG=off skips the check
+	if mode := os.Getenv("VALIDATE_CONFIG"); mode != "off" {
+		tasks = append(tasks, startupTask{name: "config validation", fatal: mode == "strict", run: func(context.Context) error {
+			if err := ai.Validate(); err != nil {
+				return fmt.Errorf("configuration problems:\n%w", err)
+			}
+			return nil
+		}})
+	}
 
-	ginrouter.GET("/health", func(c *gin.Context) {
-		c.Data(http.StatusOK, "text/plain", []byte("OK"))
-	})
+	// WARMUP_PROVIDERS (comma-separated) are sent a tiny prompt so their models are
+	// loaded before the first request
+	if names := os.Getenv("WARMUP_PROVIDERS"); names != "" {
+		if d, err := time.ParseDuration(os.Getenv("WARMUP_TIMEOUT")); err == nil {
+			ai.WarmupTimeout = d
+		}
+		var list []string
+		for _, n := range strings.Split(names, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				list = append(list, n)
+			}
+		}
+		tasks = append(tasks, startupTask{name: "warmup", run: func(ctx context.Context) error {
+			ai.Warmup(ctx, list...)
+			return nil
+		}})
+	}
+
+	// STARTUP_DEMO=false skips the demo prompt
+	if os.Getenv("STARTUP_DEMO") != "false" {
+		tasks = append(tasks, startupTask{name: "demo", run: runDemo})
+	}
+
+	timeout := 30 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("STARTUP_TIMEOUT")); err == nil {
+		timeout = d
+	}
+	limit := 3
+	if n, err := strconv.Atoi(os.Getenv("STARTUP_CONCURRENCY")); err == nil {
+		limit = n
+	}
+	var before, after []startupTask
+	for _, t := range tasks {
+		if t.fatal {
+			before = append(before, t)
+		} else {
+			after = append(after, t)
+		}
+	}
+	if err := runStartup(context.Background(), before, limit, timeout); err != nil {
+		log.Fatal("refusing to start with invalid configuration (VALIDATE_CONFIG=strict)")
+	}
 
-	// WebSocket endpoint for live AI comms. Client should send a JSON or plain text prompt.
-	ginrouter.GET("/ws/ai", func(c *gin.Context) {
-		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	// DUMP_DIR enables writing every streamed response and its metadata to disk
+	var recorder *dump.Recorder
+	if dir := os.Getenv("DUMP_DIR"); dir != "" {
+		var err error
+		recorder, err = dump.NewRecorder(dir)
 		if err != nil {
-			c.Error(err)
-			return
+			log.Printf("dump disabled: %v", err)
+		} else {
+			log.Printf("dumping streams to %s", dir)
 		}
-		defer conn.Close()
+	}
 
-		// read provider from the initial HTTP query parameters
-		provider := c.Query("provider") // e.g. "jetify", "anthropic", "ollama"
+	// SHADOW_PROVIDER mirrors a sample (SHADOW_RATE, default 0.1) of the requests to
+	// SHADOW_PRIMARY (default ollama) onto another provider for comparison
+	if name := os.Getenv("SHADOW_PROVIDER"); name != "" {
+		enableShadow(name, recorder)
+	}
 
-		for {
-			// Read message (blocking until client sends)
-			_, msg, err := conn.ReadMessage()
-			if err != nil {
-				log.Printf("ws read error: %v", err)
-				return
-			}
+	ginrouter := server.NewRouter(server.Dependencies{
+		Config:   server.ConfigFromEnv(),
+		Recorder: recorder,
+	})
 
-			prompt := string(msg)
-			log.Printf("ws: received prompt (provider=%s): %s", provider, prompt)
-
-			// create a cancellable context so the handler can stop streaming on write errors
-			ctx, cancel := context.WithCancel(context.Background())
-
-			// handler called by ai.Stream for every chunk
-			handler := func(chunk string) {
-				// attempt to write; on failure cancel the stream
-				if err := conn.WriteMessage(websocket.TextMessage, []byte(chunk)); err != nil {
-					log.Printf("ws write error: %v", err)
-					cancel()
-					return
-				}
-				// non-blocking TTS for each chunk
-				tts.Speak("espeak", chunk)
-			}
+	// SIGINT / SIGTERM drain the server: in-flight searches are cancelled at once and
+	// requests get SHUTDOWN_TIMEOUT (default 10s) to finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-			// call provider stream (this will block until provider completes or ctx is cancelled)
-			if err := ai.Stream(ctx, provider, prompt, handler); err != nil {
-				log.Printf("ai stream error: %v", err)
-				// try to inform client about the error, then continue
-				_ = conn.WriteMessage(websocket.TextMessage, []byte("__error__: "+err.Error()))
-				cancel()
-				continue
-			}
+	// HEALTH_CHECK_INTERVAL checks providers with a health endpoint (e.g.
+	// OLLAMA_HEALTH_ENDPOINT) periodically; fallback chains and load balancers skip
+	// unhealthy ones
+	if d, err := time.ParseDuration(os.Getenv("HEALTH_CHECK_INTERVAL")); err == nil && d > 0 {
+		go ai.RunHealthChecks(ctx, d)
+	}
 
-			// indicate stream end
-			if err := conn.WriteMessage(websocket.TextMessage, []byte("__end__")); err != nil {
-				log.Printf("ws write error on end marker: %v", err)
-				return
-			}
+	httpServer := &http.Server{Addr: ":8080", Handler: ginrouter}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		log.Println("shutting down")
+		ai.Shutdown()
+		grace := 10 * time.Second
+		if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil {
+			grace = d
+		}
+		drainCtx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		if err := httpServer.Shutdown(drainCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
+	l, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("starting server on :8080")
+	go func() {
+		if err := httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		runStartup(ctx, after, limit, timeout)
+	}()
+
+	// Serve returns as soon as Shutdown starts; wait for the drain
+	<-drained
+	<-started
+}
 
-			cancel()
+// runDemo demonstrates prompting the AI (which may invoke web search internally).
+func runDemo(ctx context.Context) error {
+	prompt := "What are some common concurrency patterns in Go?"
+	log.Printf("Prompting AI (ollama): %s", redact.SafeString(prompt))
+	aiResponse := ""
+	sampler := logsample.FromEnv()
+	err := ai.Stream(ctx, "ollama", prompt, func(chunk string) {
+		if ok, skipped := sampler.Allow(); ok {
+			log.Printf("AI chunk (+%d skipped): %s", skipped, redact.SafeString(chunk))
 		}
+		aiResponse += chunk + " "
 	})
+	if err != nil {
+		return errors.New(redact.Scrub(err.Error()))
+	}
+	log.Printf("AI full response: %s", redact.SafeString(aiResponse))
+	return nil
+}
 
-	log.Println("starting server on :8080")
-	ginrouter.Run(":8080")
+// enableShadow wraps the SHADOW_PRIMARY provider so that sampled requests also run
+// against shadowName. Both responses are logged with a similarity summary and, when
+// the recorder is enabled, the shadow's response is dumped next to the primary's.
+func enableShadow(shadowName string, recorder *dump.Recorder) {
+	primaryName := os.Getenv("SHADOW_PRIMARY")
+	if primaryName == "" {
+		primaryName = "ollama"
+	}
+	primary, err := ai.Lookup(primaryName)
+	if err != nil {
+		log.Printf("shadow disabled: %v", err)
+		return
+	}
+	shadow, err := ai.Lookup(shadowName)
+	if err != nil {
+		log.Printf("shadow disabled: %v", err)
+		return
+	}
+	rate := 0.1
+	if r, err := strconv.ParseFloat(os.Getenv("SHADOW_RATE"), 64); err == nil {
+		rate = r
+	}
+	sp := ai.NewShadowProvider(primary, shadow, rate)
+	sp.OnResult = func(r ai.ShadowResult) {
+		d := dump.Compare(r.Primary, r.Shadow)
+		log.Printf("shadow: %s vs %s: similarity %.2f, %d vs %d chars, %s vs %s",
+			primaryName, shadowName, d.Similarity, d.OldChars, d.NewChars,
+			r.PrimaryDuration.Round(time.Millisecond), r.ShadowDuration.Round(time.Millisecond))
+		if recorder != nil {
+			s := recorder.Start(shadowName+" (shadow of "+primaryName+")", r.Prompt)
+			s.Write(r.Shadow)
+			s.Close(r.ShadowErr)
+		}
+	}
+	ai.Register(primaryName, sp)
+	log.Printf("shadowing %.0f%% of %s requests onto %s", rate*100, primaryName, shadowName)
 }
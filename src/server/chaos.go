@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"j-project/src/utils/ai"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// withChaosHeaders applies X-Chaos-Jitter, X-Chaos-Error-Rate and X-Chaos-Drop-Rate
+// request headers as a per-request ai.ChaosConfig. They are ignored unless the server
+// runs with CHAOS_ENABLED=true.
+func withChaosHeaders(ctx context.Context, h http.Header) context.Context {
+	cfg, ok := chaosFromHeaders(h)
+	if !ok {
+		return ctx
+	}
+	return ai.WithChaos(ctx, cfg)
+}
+
+func chaosFromHeaders(h http.Header) (ai.ChaosConfig, bool) {
+	var cfg ai.ChaosConfig
+	if !ai.ChaosEnabled {
+		return cfg, false
+	}
+	jitter, errRate, dropRate := h.Get("X-Chaos-Jitter"), h.Get("X-Chaos-Error-Rate"), h.Get("X-Chaos-Drop-Rate")
+	if jitter == "" && errRate == "" && dropRate == "" {
+		return cfg, false
+	}
+	cfg.Jitter, _ = time.ParseDuration(jitter)
+	cfg.ErrorRate, _ = strconv.ParseFloat(errRate, 64)
+	cfg.DropRate, _ = strconv.ParseFloat(dropRate, 64)
+	return cfg, true
+}
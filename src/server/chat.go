@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"j-project/src/utils/ai"
+	"j-project/src/utils/redact"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type chatRequest struct {
+	Prompt   string   `json:"prompt"`
+	Provider string   `json:"provider,omitempty"`
+	Stop     []string `json:"stop,omitempty"`
+}
+
+// handleChat runs a prompt to completion. With "Accept: text/plain" the response is
+// streamed as chunked plain text, flushed as each chunk arrives; otherwise the full
+// response is returned as JSON. The generation's ID is sent in the X-Generation-ID
+// header; DELETE /chat/{id} cancels it. A JSON response's headers only arrive with the
+// answer, so clients that want to cancel one pick the ID themselves by sending it in
+// an X-Generation-ID request header.
+func (srv *server) handleChat(c *gin.Context) {
+	var req chatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be {\"prompt\":\"...\",\"provider\":\"...\"}"})
+		return
+	}
+	log.Printf("chat: received prompt (provider=%s): %s", req.Provider, redact.SafeString(req.Prompt))
+	if err := checkProvider(req.Provider); err != nil {
+		code, status := errorCode(err)
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+
+	genID, ctx, done, ok := srv.generations.start(c.Request.Context(), c.GetHeader("X-Generation-ID"))
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "a generation with that id is already running", "code": "duplicate_generation"})
+		return
+	}
+	defer done()
+	c.Header("X-Generation-ID", genID)
+
+	var res ai.Result
+	ctx = ai.WithResult(ctx, &res)
+	if id := c.GetHeader("X-Request-ID"); id != "" {
+		ctx = ai.WithRequestID(ctx, id)
+	}
+	ctx = withChaosHeaders(ctx, c.Request.Header)
+	if len(req.Stop) > 0 {
+		ctx = ai.WithOptions(ctx, ai.Options{StopSequences: req.Stop})
+	}
+
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEPlain) == gin.MIMEPlain {
+		srv.streamChat(ctx, c, req)
+		return
+	}
+
+	var b, reasoning strings.Builder
+	chunks := 0
+	ctx = ai.WithReasoning(ctx, func(chunk string) { reasoning.WriteString(chunk) })
+	err := srv.deps.Stream(ctx, req.Provider, req.Prompt, func(chunk string) {
+		chunks++
+		b.WriteString(chunk)
+	})
+	if srv.degrade(ctx, err, chunks) {
+		log.Printf("chat: stream error, sending degraded response: %s", redact.Scrub(err.Error()))
+		c.JSON(http.StatusOK, gin.H{"provider": req.Provider, "response": srv.deps.Config.DegradedResponse, "finish_reason": ai.FinishStop, "degraded": true})
+		return
+	}
+	if err != nil {
+		log.Printf("chat: stream error: %s", redact.Scrub(err.Error()))
+		code, status := errorCode(err)
+		c.JSON(status, gin.H{"error": err.Error(), "code": code, "response": b.String(), "finish_reason": finishReason(res, err)})
+		return
+	}
+	out := gin.H{"provider": req.Provider, "response": b.String(), "truncated": res.Truncated, "finish_reason": finishReason(res, nil)}
+	if reasoning.Len() > 0 {
+		out["reasoning"] = reasoning.String()
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// streamChat writes each chunk to the response as soon as it arrives. The status is
+// only committed with the first chunk, so an error before any output still gets a
+// proper status code; a later error is appended as an "__error__: msg" line, like the
+// WebSocket marker. A client that disconnects cancels the request context and with
+// it the stream.
+func (srv *server) streamChat(ctx context.Context, c *gin.Context, req chatRequest) {
+	w := c.Writer
+	started := false
+	err := srv.deps.Stream(ctx, req.Provider, req.Prompt, func(chunk string) {
+		if !started {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if _, err := w.WriteString(chunk); err != nil {
+			return
+		}
+		w.Flush()
+	})
+	if err == nil {
+		return
+	}
+	if errors.Is(context.Cause(ctx), errGenerationCancelled) {
+		// the client is still there; tell it why the response stopped
+		if !started {
+			c.String(499, "__error__: %s\n", errGenerationCancelled)
+			return
+		}
+		_, _ = w.WriteString("\n__error__: " + errGenerationCancelled.Error() + "\n")
+		w.Flush()
+		return
+	}
+	if ctx.Err() != nil {
+		log.Printf("chat: client went away: %v", ctx.Err())
+		return
+	}
+	if !started && srv.degrade(ctx, err, 0) {
+		log.Printf("chat: stream error, sending degraded response: %s", redact.Scrub(err.Error()))
+		c.Header("X-Degraded", "true")
+		c.String(http.StatusOK, "%s", srv.deps.Config.DegradedResponse)
+		return
+	}
+	log.Printf("chat: stream error: %s", redact.Scrub(err.Error()))
+	if !started {
+		_, status := errorCode(err)
+		c.String(status, "__error__: %s\n", err.Error())
+		return
+	}
+	_, _ = w.WriteString("\n__error__: " + err.Error() + "\n")
+	w.Flush()
+}
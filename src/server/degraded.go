@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"j-project/src/utils/ai"
+)
+
+// degrade reports whether a stream that failed with err before sending anything should
+// be answered with Config.DegradedResponse instead of an error. Failures the client
+// caused (an empty prompt, an unknown provider, cancelling, a panicking handler) are
+// still reported as errors.
+func (srv *server) degrade(ctx context.Context, err error, chunks int) bool {
+	if srv.deps.Config.DegradedResponse == "" || err == nil || chunks > 0 || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ai.ErrHandlerPanic) {
+		return false
+	}
+	switch code, _ := errorCode(err); code {
+	case "empty_prompt", "provider_not_found", "cancelled":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"j-project/src/utils/ai"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// allDown is a fallback chain whose every provider fails.
+func allDown() string {
+	down := &ai.ScriptedProvider{Err: &ai.ProviderError{StatusCode: 503, Msg: "down"}}
+	return scripted(ai.NewFallbackProvider(0, 1, scripted(down), scripted(down)))
+}
+
+func TestWSDegradedResponseWhenAllProvidersFail(t *testing.T) {
+	provider := allDown()
+	ts := newTestServer(t, Dependencies{Config: Config{DegradedResponse: "I'm temporarily unavailable, please try later"}})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+
+	c.send("hi")
+	frames := c.readUntilEnd()
+	if got := texts(frames); !slices.Equal(got, []string{"I'm temporarily unavailable, please try later", "__end__"}) {
+		t.Fatalf("text frames = %q, want the degraded response as content", got)
+	}
+	if errs := ofType(frames, "error"); len(errs) != 0 {
+		t.Fatalf("error frames = %+v, want none in degraded mode", errs)
+	}
+	end := ofType(frames, "end")
+	if len(end) != 1 || end[0].JSON["degraded"] != true || end[0].JSON["error"] != nil {
+		t.Fatalf("end frame = %+v, want it flagged degraded", end)
+	}
+
+	// opt-in: without a DegradedResponse the failure is reported
+	c = dialWS(t, newTestServer(t, Dependencies{}), "/ws/ai", url.Values{"provider": {provider}}, nil)
+	c.send("hi")
+	if errs := ofType(c.readUntilEnd(), "error"); len(errs) != 1 {
+		t.Fatalf("error frames without DegradedResponse = %+v, want one", errs)
+	}
+}
+
+func TestChatPlainTextDegraded(t *testing.T) {
+	ts := newTestServer(t, Dependencies{Config: Config{DegradedResponse: "try again later"}})
+	resp, body := postChat(t, ts, `{"prompt":"hi","provider":"`+allDown()+`"}`, "text/plain")
+	if resp.StatusCode != http.StatusOK || body != "try again later" || resp.Header.Get("X-Degraded") != "true" {
+		t.Fatalf("degraded plain text = %d %q (X-Degraded %q)", resp.StatusCode, body, resp.Header.Get("X-Degraded"))
+	}
+}
+
+func TestDegradeOnlyProviderFailures(t *testing.T) {
+	srv := &server{deps: Dependencies{Config: Config{DegradedResponse: "later"}}}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		err    error
+		chunks int
+		want   bool
+	}{
+		{"provider down", context.Background(), &ai.ProviderError{StatusCode: 502}, 0, true},
+		{"budget exhausted", context.Background(), fmt.Errorf("fallback: %w", ai.ErrBudgetExhausted), 0, true},
+		{"no error", context.Background(), nil, 0, false},
+		{"after output", context.Background(), &ai.ProviderError{StatusCode: 502}, 3, false},
+		{"client went away", cancelled, context.Canceled, 0, false},
+		{"empty prompt", context.Background(), ai.ErrEmptyPrompt, 0, false},
+		{"unknown provider", context.Background(), ai.ErrProviderNotFound, 0, false},
+		{"handler panic", context.Background(), fmt.Errorf("stream: %w", ai.ErrHandlerPanic), 0, false},
+	}
+	for _, tt := range tests {
+		if got := srv.degrade(tt.ctx, tt.err, tt.chunks); got != tt.want {
+			t.Errorf("%s: degrade = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	srv.deps.Config.DegradedResponse = ""
+	if srv.degrade(context.Background(), errors.New("down"), 0) {
+		t.Error("degraded without a DegradedResponse configured")
+	}
+}
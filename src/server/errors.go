@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"j-project/src/utils/ai"
+	"net/http"
+)
+
+// errorCode maps a stream error to a stable, client-facing code and HTTP status.
+func errorCode(err error) (string, int) {
+	var pe *ai.ProviderError
+	var se *ai.SearchError
+	switch {
+	case errors.Is(err, ai.ErrEmptyPrompt):
+		return "empty_prompt", http.StatusBadRequest
+	case errors.Is(err, errIdempotencyConflict):
+		return "idempotency_conflict", http.StatusConflict
+	case errors.Is(err, ai.ErrProviderNotFound):
+		return "provider_not_found", http.StatusNotFound
+	case errors.Is(err, ai.ErrCircuitOpen):
+		return "provider_unavailable", http.StatusServiceUnavailable
+	case errors.Is(err, ai.ErrProviderTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout", http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return "cancelled", 499
+	case errors.As(err, &se):
+		return "search_failed", http.StatusBadGateway
+	case errors.As(err, &pe):
+		return "provider_error", http.StatusBadGateway
+	}
+	return "internal", http.StatusInternalServerError
+}
+
+// checkProvider resolves a provider name sent by a client strictly, so a typo gets
+// "did you mean" instead of an answer from the mock fallback Stream would use. The
+// empty name and ai.AutoProvider are left for Stream to resolve.
+func checkProvider(name string) error {
+	if name == "" || name == ai.AutoProvider {
+		return nil
+	}
+	_, err := ai.Lookup(name)
+	return err
+}
+
+// finishReason is the finish reason reported to clients for a stream that ended with
+// err. It covers streams that failed before the provider ran, which Stream leaves unset.
+func finishReason(res ai.Result, err error) ai.FinishReason {
+	switch {
+	case err != nil && (res.FinishReason == "" || res.FinishReason == ai.FinishStop):
+		return ai.FinishError
+	case res.FinishReason == "":
+		return ai.FinishStop
+	}
+	return res.FinishReason
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"j-project/src/utils/ai"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{ai.ErrEmptyPrompt, "empty_prompt", http.StatusBadRequest},
+		{errIdempotencyConflict, "idempotency_conflict", http.StatusConflict},
+		{fmt.Errorf("lookup: %w", ai.ErrProviderNotFound), "provider_not_found", http.StatusNotFound},
+		{ai.ErrCircuitOpen, "provider_unavailable", http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, "timeout", http.StatusGatewayTimeout},
+		{context.Canceled, "cancelled", 499},
+		{fmt.Errorf("search augmentation: %w", &ai.SearchError{Searcher: "ddg"}), "search_failed", http.StatusBadGateway},
+		{&ai.ProviderError{StatusCode: 500, Msg: "bad status"}, "provider_error", http.StatusBadGateway},
+		{errors.New("something else"), "internal", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if code, status := errorCode(tt.err); code != tt.code || status != tt.status {
+			t.Errorf("errorCode(%v) = %s %d, want %s %d", tt.err, code, status, tt.code, tt.status)
+		}
+	}
+}
+
+func TestFinishReason(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		res  ai.Result
+		err  error
+		want ai.FinishReason
+	}{
+		{ai.Result{}, nil, ai.FinishStop},
+		{ai.Result{}, failed, ai.FinishError},
+		{ai.Result{FinishReason: ai.FinishStop}, failed, ai.FinishError},
+		{ai.Result{FinishReason: ai.FinishLength}, nil, ai.FinishLength},
+		{ai.Result{FinishReason: ai.FinishLength}, failed, ai.FinishLength},
+	}
+	for _, tt := range tests {
+		if got := finishReason(tt.res, tt.err); got != tt.want {
+			t.Errorf("finishReason(%q, %v) = %q, want %q", tt.res.FinishReason, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestUnknownProviderSuggestion(t *testing.T) {
+	ai.Register("nearmiss-provider", &ai.ScriptedProvider{Chunks: []string{"never"}})
+	ts := newTestServer(t, Dependencies{})
+	want := `did you mean "nearmiss-provider"?`
+
+	resp, body := postChat(t, ts, `{"prompt":"hi","provider":"nearmis-provider"}`, "")
+	var out struct{ Code, Error string }
+	json.Unmarshal([]byte(body), &out)
+	if resp.StatusCode != http.StatusNotFound || out.Code != "provider_not_found" || !strings.Contains(out.Error, want) {
+		t.Fatalf("/chat = %d %s, want 404 provider_not_found with the suggestion", resp.StatusCode, body)
+	}
+
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {"nearmis-provider"}}, nil)
+	f := c.read()
+	if f.typ() != "error" || f.JSON["code"] != "provider_not_found" || !strings.Contains(fmt.Sprint(f.JSON["error"]), want) {
+		t.Fatalf("first frame = %s, want a provider_not_found error with the suggestion", f.Text)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := c.conn.ReadMessage(); err == nil {
+		t.Fatal("connection stayed open for an unknown provider")
+	}
+}
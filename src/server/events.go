@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"j-project/src/utils/events"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventsBuffer is how many events a slow /events subscriber may fall behind by before
+// it starts missing them.
+const eventsBuffer = 64
+
+// handleEvents streams the server's event bus as server-sent events, one JSON-encoded
+// events.Event per message, until the client disconnects. A comment is sent every 15s
+// to keep idle connections open through proxies.
+func (srv *server) handleEvents(c *gin.Context) {
+	ch, unsubscribe := events.Default.Subscribe(eventsBuffer)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	log.Printf("events: subscriber connected from %s", c.ClientIP())
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	ctx := c.Request.Context()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-keepalive.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		case e := <-ch:
+			b, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("events: marshal: %v", err)
+				return true
+			}
+			_, err = io.WriteString(w, "event: "+e.Type+"\ndata: "+string(b)+"\n\n")
+			return err == nil
+		}
+	})
+	log.Printf("events: subscriber from %s disconnected", c.ClientIP())
+}
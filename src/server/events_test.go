@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"j-project/src/utils/ai"
+	"j-project/src/utils/events"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminEventsStream(t *testing.T) {
+	provider := scripted(&ai.ScriptedProvider{Chunks: []string{"hi"}})
+	ts := newTestServer(t, Dependencies{Config: Config{AdminToken: "s3cret"}})
+	if resp := adminRequest(t, ts, "GET", "/admin/events", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("/admin/events without the token: status %d, want 401", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/admin/events", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			close(respc)
+			return
+		}
+		respc <- resp
+	}()
+	// the response starts with the first event, so publish until the subscriber is there
+	var resp *http.Response
+	for resp == nil {
+		events.Publish(events.Event{Type: "test.ping"})
+		select {
+		case resp = <-respc:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	postChat(t, ts, `{"provider":"`+provider+`","prompt":"hello"}`, "")
+
+	var seen []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e events.Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("event %q: %v", data, err)
+		}
+		if e.Provider != provider {
+			continue
+		}
+		seen = append(seen, e.Type)
+		if e.Type == events.StreamEnded {
+			break
+		}
+	}
+	if len(seen) != 2 || seen[0] != events.StreamStarted {
+		t.Fatalf("events for the stream = %q, want started then ended", seen)
+	}
+}
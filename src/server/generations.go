@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errGenerationCancelled is the cause of a /chat generation cancelled with DELETE.
+var errGenerationCancelled = errors.New("generation cancelled")
+
+// generations tracks the running /chat generations so DELETE /chat/{id} can cancel
+// them. Generated IDs are random, so knowing one is what authorizes cancelling it.
+type generations struct {
+	mu     sync.Mutex
+	active map[string]context.CancelCauseFunc
+}
+
+func newGenerations() *generations {
+	return &generations{active: map[string]context.CancelCauseFunc{}}
+}
+
+// start registers a generation under id, or a random ID when id is empty, and returns
+// the ID, a context that DELETE cancels and a done function that must be called when
+// the generation ends. ok is false if id is already in use.
+func (g *generations) start(ctx context.Context, id string) (_ string, genCtx context.Context, done func(), ok bool) {
+	if id == "" {
+		var b [8]byte
+		_, _ = rand.Read(b[:])
+		id = hex.EncodeToString(b[:])
+	}
+	genCtx, cancel := context.WithCancelCause(ctx)
+	g.mu.Lock()
+	if _, taken := g.active[id]; taken {
+		g.mu.Unlock()
+		cancel(nil)
+		return id, nil, nil, false
+	}
+	g.active[id] = cancel
+	g.mu.Unlock()
+	return id, genCtx, func() {
+		g.mu.Lock()
+		delete(g.active, id)
+		g.mu.Unlock()
+		cancel(nil)
+	}, true
+}
+
+// cancel stops the generation with the given ID and reports whether it was running.
+func (g *generations) cancel(id string) bool {
+	g.mu.Lock()
+	cancel, ok := g.active[id]
+	delete(g.active, id)
+	g.mu.Unlock()
+	if ok {
+		cancel(errGenerationCancelled)
+	}
+	return ok
+}
+
+// handleCancelChat serves DELETE /chat/:id.
+func (srv *server) handleCancelChat(c *gin.Context) {
+	id := c.Param("id")
+	if !srv.generations.cancel(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no running generation with that id", "id": id})
+		return
+	}
+	log.Printf("chat: generation %s cancelled", id)
+	c.JSON(http.StatusOK, gin.H{"cancelled": id})
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"j-project/src/utils/ai"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+var scriptedSeq atomic.Int64
+
+// scripted registers p under a provider name unique to this run and returns the name,
+// so breaker state never carries over between tests.
+func scripted(p ai.Provider) string {
+	name := fmt.Sprintf("scripted-%d", scriptedSeq.Add(1))
+	ai.Register(name, p)
+	return name
+}
+
+// newTestServer serves NewRouter(deps) without speech or synthesis.
+func newTestServer(t *testing.T, deps Dependencies) *httptest.Server {
+	t.Helper()
+	if deps.Speaker == nil {
+		deps.Speaker = func(context.Context) Speaker { return NopSpeaker() }
+	}
+	if deps.Synthesize == nil {
+		deps.Synthesize = func(context.Context, string) ([]byte, error) { return nil, errors.New("no synthesis in tests") }
+	}
+	ts := httptest.NewServer(NewRouter(deps))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// frame is one message received over a WebSocket: a JSON control frame when it
+// decodes to an object with a type, otherwise text.
+type frame struct {
+	Text string
+	JSON map[string]any
+}
+
+// typ is the control frame's type, or "" for text.
+func (f frame) typ() string {
+	s, _ := f.JSON["type"].(string)
+	return s
+}
+
+// isEnd reports whether f is the legacy end-of-response marker.
+func (f frame) isEnd() bool {
+	return f.JSON == nil && (f.Text == "__end__" || strings.HasPrefix(f.Text, "__error__"))
+}
+
+type wsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+// dialWS connects to path on ts with the given query and request headers.
+func dialWS(t *testing.T, ts *httptest.Server, path string, query url.Values, header http.Header) *wsClient {
+	t.Helper()
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(u, header)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial %s: %v (status %d)", u, err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{t: t, conn: conn}
+}
+
+// send writes a string as a text frame and anything else as JSON.
+func (c *wsClient) send(v any) {
+	c.t.Helper()
+	var err error
+	if s, ok := v.(string); ok {
+		err = c.conn.WriteMessage(websocket.TextMessage, []byte(s))
+	} else {
+		err = c.conn.WriteJSON(v)
+	}
+	if err != nil {
+		c.t.Fatalf("send: %v", err)
+	}
+}
+
+// read returns the next frame, failing the test if none arrives in time.
+func (c *wsClient) read() frame {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	f := frame{Text: string(data)}
+	var m map[string]any
+	if json.Unmarshal(data, &m) == nil && m["type"] != nil {
+		f.JSON = m
+	}
+	return f
+}
+
+// readUntilEnd returns the frames up to and including the end marker.
+func (c *wsClient) readUntilEnd() []frame {
+	c.t.Helper()
+	var frames []frame
+	for {
+		f := c.read()
+		frames = append(frames, f)
+		if f.isEnd() {
+			return frames
+		}
+	}
+}
+
+// texts returns the text frames, end marker included.
+func texts(frames []frame) []string {
+	var out []string
+	for _, f := range frames {
+		if f.JSON == nil {
+			out = append(out, f.Text)
+		}
+	}
+	return out
+}
+
+// ofType returns the control frames of the given type.
+func ofType(frames []frame, typ string) []frame {
+	var out []frame
+	for _, f := range frames {
+		if f.typ() == typ {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// adminRequest sends body to an admin route, with token as the bearer token when set.
+func adminRequest(t *testing.T, ts *httptest.Server, method, path, token, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
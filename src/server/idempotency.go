@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"j-project/src/utils/ai"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errIdempotencyConflict is returned for a prompt whose idempotency key was already
+// used with a different prompt.
+var errIdempotencyConflict = errors.New("idempotency key already used for a different prompt")
+
+// idempotencyStore remembers responses by client-supplied idempotency key, so a prompt
+// retried after a flaky connection is answered from the first run instead of calling
+// the provider again. Entries are in flight until the first run completes, and are
+// kept for ttl afterwards. Failed runs are forgotten so they can be retried.
+//
+// Keys are scoped (see idempotencyScope) so one caller can never be answered with
+// another's response, and each entry remembers its prompt so a reused key is refused.
+type idempotencyStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	prompt  [sha256.Size]byte
+	done    chan struct{} // closed when the owning run finishes
+	ok      bool          // the run succeeded; chunks and reason hold its response
+	chunks  []string
+	reason  ai.FinishReason
+	expires time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, entries: map[string]*idempotencyEntry{}}
+}
+
+// begin returns the entry for key. owner is true when the caller created it and must
+// finish it; otherwise the entry belongs to an earlier run of the same prompt. A key
+// whose earlier run had a different prompt returns errIdempotencyConflict.
+func (s *idempotencyStore) begin(key, prompt string) (e *idempotencyEntry, owner bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+	sum := sha256.Sum256([]byte(prompt))
+	if e, ok := s.entries[key]; ok {
+		if e.prompt != sum {
+			return nil, false, errIdempotencyConflict
+		}
+		return e, false, nil
+	}
+	e = &idempotencyEntry{prompt: sum, done: make(chan struct{})}
+	s.entries[key] = e
+	return e, true, nil
+}
+
+// idempotencyScope is the store key for a client's idempotency key: the caller, the
+// provider and the key itself, hashed so credentials in the caller aren't kept.
+func idempotencyScope(caller, provider, key string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{caller, provider, key}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// callerIdentity identifies who opened a connection, for scoping idempotency keys: its
+// Authorization header and ?session=, or its address when it sent neither.
+func callerIdentity(c *gin.Context) string {
+	auth, session := c.GetHeader("Authorization"), c.Query("session")
+	if auth == "" && session == "" {
+		return "ip\x00" + c.ClientIP()
+	}
+	return "auth\x00" + auth + "\x00" + session
+}
+
+// finish records the outcome of the owning run and wakes anyone waiting on it.
+func (s *idempotencyStore) finish(key string, e *idempotencyEntry, chunks []string, reason ai.FinishReason, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.ok, e.chunks, e.reason = ok, chunks, reason
+	if ok {
+		e.expires = time.Now().Add(s.ttl)
+	} else if s.entries[key] == e {
+		delete(s.entries, key)
+	}
+	close(e.done)
+}
+
+// wait blocks until the entry's run finishes and reports whether it succeeded, in
+// which case its chunks and reason may be read. It returns false if ctx ended first.
+func (e *idempotencyEntry) wait(ctx context.Context) bool {
+	select {
+	case <-e.done:
+		return e.ok
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseGate holds back a connection's chunks while the client has it paused. Up to
+// limit chunks are kept server-side; past that the stream's handler blocks, which
+// stalls the provider until the client resumes. Chunks are always delivered in order,
+// since every delivery happens under the gate's lock.
+type pauseGate struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	paused  bool
+	limit   int
+	pending []string
+	deliver func(string) // of the running prompt; nil between prompts
+}
+
+func newPauseGate(limit int) *pauseGate {
+	g := &pauseGate{limit: limit}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// begin routes the gate's chunks to deliver until the returned end function is called.
+// end waits for the client to resume if it is still paused, flushes what was held back
+// and returns; if ctx ends first the held chunks are dropped.
+func (g *pauseGate) begin(ctx context.Context, deliver func(string)) (end func()) {
+	g.mu.Lock()
+	g.deliver = deliver
+	g.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() {
+		g.mu.Lock()
+		g.cond.Broadcast()
+		g.mu.Unlock()
+	})
+	return func() {
+		defer stop()
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for g.paused && ctx.Err() == nil {
+			g.cond.Wait()
+		}
+		if ctx.Err() == nil {
+			g.flush()
+		}
+		g.pending, g.deliver = nil, nil
+	}
+}
+
+// pass delivers chunk, or holds it back while paused. With the buffer full it blocks
+// until the client resumes or ctx ends.
+func (g *pauseGate) pass(ctx context.Context, chunk string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.paused && len(g.pending) >= g.limit && ctx.Err() == nil {
+		g.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if g.paused {
+		g.pending = append(g.pending, chunk)
+		return
+	}
+	g.deliver(chunk)
+}
+
+// pause starts holding chunks back and reports whether the gate was running.
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	was := g.paused
+	g.paused = true
+	return !was
+}
+
+// resume flushes the held chunks and lets new ones through. It returns how many were
+// flushed and whether the gate was paused.
+func (g *pauseGate) resume() (int, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return 0, false
+	}
+	g.paused = false
+	n := g.flush()
+	g.cond.Broadcast()
+	return n, true
+}
+
+// flush delivers the held chunks. Callers must hold g.mu.
+func (g *pauseGate) flush() int {
+	n := len(g.pending)
+	if g.deliver != nil {
+		for _, chunk := range g.pending {
+			g.deliver(chunk)
+		}
+	}
+	g.pending = g.pending[:0]
+	return n
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"j-project/src/utils/ai"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPauseGateBuffersAndBlocks(t *testing.T) {
+	g := newPauseGate(2)
+	var got []string
+	end := g.begin(context.Background(), func(c string) { got = append(got, c) })
+
+	g.pass(context.Background(), "a")
+	if !g.pause() || g.pause() {
+		t.Fatal("pause should succeed once")
+	}
+	g.pass(context.Background(), "b")
+	g.pass(context.Background(), "c")
+	passed := make(chan struct{})
+	go func() {
+		g.pass(context.Background(), "d") // buffer full: blocks until resumed
+		close(passed)
+	}()
+	select {
+	case <-passed:
+		t.Fatal("pass didn't block with the buffer full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if n, ok := g.resume(); !ok || n != 2 {
+		t.Fatalf("resume = %d, %v; want the 2 held chunks flushed", n, ok)
+	}
+	<-passed
+	end()
+	if want := []string{"a", "b", "c", "d"}; !slices.Equal(got, want) {
+		t.Fatalf("delivered %q, want %q", got, want)
+	}
+	if _, ok := g.resume(); ok {
+		t.Fatal("resume succeeded on a running gate")
+	}
+}
+
+func TestPauseGateCancelDropsHeld(t *testing.T) {
+	g := newPauseGate(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []string
+	end := g.begin(ctx, func(c string) { got = append(got, c) })
+	g.pause()
+	g.pass(ctx, "held")
+	done := make(chan struct{})
+	go func() {
+		g.pass(ctx, "blocked")
+		end()
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a cancelled stream stayed blocked on the paused gate")
+	}
+	if len(got) != 0 {
+		t.Fatalf("delivered %q after cancel, want nothing", got)
+	}
+}
+
+// countingProvider streams n numbered chunks, counting how many the handler accepted.
+type countingProvider struct {
+	n    int
+	sent atomic.Int32
+}
+
+func (p *countingProvider) Stream(ctx context.Context, prompt string, handler ai.StreamHandler) error {
+	for i := range p.n {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		handler(strconv.Itoa(i) + " ")
+		p.sent.Add(1)
+	}
+	return nil
+}
+
+func TestWSPauseAndResume(t *testing.T) {
+	p := &countingProvider{n: 10}
+	provider := scripted(p)
+	ts := newTestServer(t, Dependencies{Config: Config{PauseBuffer: 3}})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+
+	c.send(map[string]any{"type": "pause"})
+	if f := c.read(); f.typ() != "paused" {
+		t.Fatalf("reply to pause = %+v", f)
+	}
+	c.send("count")
+	// 3 chunks are held and the provider stalls delivering the 4th
+	deadline := time.Now().Add(5 * time.Second)
+	for p.sent.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("the provider never filled the pause buffer")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := p.sent.Load(); n != 3 {
+		t.Fatalf("provider sent %d chunks past a pause buffer of 3", n)
+	}
+
+	// nothing reaches the client while paused: the reply to a later message comes first
+	c.send(map[string]any{"type": "info"})
+	for f := c.read(); f.typ() != "info"; f = c.read() {
+		if f.JSON == nil {
+			t.Fatalf("text frame %q delivered while paused", f.Text)
+		}
+	}
+
+	c.send(map[string]any{"type": "resume"})
+	frames := c.readUntilEnd()
+	resumed := ofType(frames, "resumed")
+	if len(resumed) != 1 || resumed[0].JSON["flushed"] != float64(3) {
+		t.Fatalf("frames = %+v, want a resumed frame with 3 flushed", frames)
+	}
+	want := []string{"0 ", "1 ", "2 ", "3 ", "4 ", "5 ", "6 ", "7 ", "8 ", "9 ", "__end__"}
+	if got := texts(frames); !slices.Equal(got, want) {
+		t.Fatalf("text frames = %q, want every chunk in order", got)
+	}
+}
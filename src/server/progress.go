@@ -0,0 +1,35 @@
+package server
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// progress decides when a stream is due a progress frame; see Config.ProgressInterval
+// and Config.ProgressChars.
+type progress struct {
+	interval  time.Duration
+	every     int
+	start     time.Time
+	lastAt    time.Time
+	chars     int
+	lastChars int
+}
+
+func (srv *server) newProgress() *progress {
+	now := time.Now()
+	return &progress{interval: srv.deps.Config.ProgressInterval, every: srv.deps.Config.ProgressChars, start: now, lastAt: now}
+}
+
+// add counts a delivered chunk and reports whether a frame is due, with the characters
+// sent so far and the time since the stream started.
+func (p *progress) add(chunk string) (chars int, elapsed time.Duration, due bool) {
+	p.chars += utf8.RuneCountInString(chunk)
+	now := time.Now()
+	due = (p.interval > 0 && now.Sub(p.lastAt) >= p.interval) ||
+		(p.every > 0 && p.chars-p.lastChars >= p.every)
+	if due {
+		p.lastAt, p.lastChars = now, p.chars
+	}
+	return p.chars, now.Sub(p.start), due
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"j-project/src/utils/ai"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWSProgressEveryNChars(t *testing.T) {
+	provider := scripted(&ai.ScriptedProvider{Chunks: slices.Repeat([]string{"ten chars."}, 20)})
+	ts := newTestServer(t, Dependencies{Config: Config{ProgressChars: 50}})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+
+	c.send("go")
+	var chars []float64
+	sent := 0
+	for _, f := range c.readUntilEnd() {
+		switch {
+		case f.typ() == "progress":
+			chars = append(chars, f.JSON["chars"].(float64))
+			if f.JSON["chars"] != float64(sent) {
+				t.Fatalf("progress at %v chars after %d were sent", f.JSON["chars"], sent)
+			}
+			if _, ok := f.JSON["elapsed_ms"].(float64); !ok {
+				t.Fatalf("progress frame without elapsed_ms: %+v", f.JSON)
+			}
+		case f.JSON == nil && !f.isEnd():
+			sent += len(f.Text)
+		}
+	}
+	if want := []float64{50, 100, 150, 200}; !slices.Equal(chars, want) {
+		t.Fatalf("progress frames at %v chars, want every 50: %v", chars, want)
+	}
+}
+
+func TestWSProgressInterval(t *testing.T) {
+	provider := scripted(&ai.ScriptedProvider{Chunks: strings.Split(strings.Repeat("x", 12), ""), Delay: 25 * time.Millisecond})
+	ts := newTestServer(t, Dependencies{Config: Config{ProgressInterval: 100 * time.Millisecond}})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+
+	c.send("go")
+	var elapsed []float64
+	for _, f := range ofType(c.readUntilEnd(), "progress") {
+		elapsed = append(elapsed, f.JSON["elapsed_ms"].(float64))
+	}
+	// 12 chunks 25ms apart is about 300ms of streaming: a frame every 100ms or so
+	if len(elapsed) < 1 || len(elapsed) > 3 {
+		t.Fatalf("%d progress frames over ~300ms at a 100ms interval (elapsed %v)", len(elapsed), elapsed)
+	}
+	for i := 1; i < len(elapsed); i++ {
+		if elapsed[i]-elapsed[i-1] < 100 {
+			t.Fatalf("progress frames %vms apart, want at least the 100ms interval", elapsed[i]-elapsed[i-1])
+		}
+	}
+
+	// off by default
+	c = dialWS(t, newTestServer(t, Dependencies{}), "/ws/ai", url.Values{"provider": {provider}}, nil)
+	c.send("go")
+	if frames := ofType(c.readUntilEnd(), "progress"); len(frames) != 0 {
+		t.Fatalf("progress frames with no cadence configured: %+v", frames)
+	}
+}
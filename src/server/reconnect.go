@@ -0,0 +1,58 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// reconnectLimiter bounds how often one client IP may open a WebSocket, using a sliding
+// window over its recent upgrade attempts. It guards against clients reconnecting in a
+// tight loop; message rates within a connection are a separate concern.
+type reconnectLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu       sync.Mutex
+	attempts map[string][]time.Time // per IP, oldest first
+	swept    time.Time
+}
+
+func newReconnectLimiter(limit int, window time.Duration) *reconnectLimiter {
+	return &reconnectLimiter{limit: limit, window: window, attempts: map[string][]time.Time{}}
+}
+
+// allow records an upgrade attempt from ip and reports whether it is within the limit.
+// When it isn't, retryAfter is how long until the oldest attempt leaves the window.
+// Rejected attempts count too, so a client hammering the endpoint stays blocked.
+func (l *reconnectLimiter) allow(ip string) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+
+	// forget idle IPs now and then so the map doesn't grow with every client ever seen
+	if now.Sub(l.swept) > l.window {
+		for k, ts := range l.attempts {
+			if len(ts) == 0 || !ts[len(ts)-1].After(cutoff) {
+				delete(l.attempts, k)
+			}
+		}
+		l.swept = now
+	}
+
+	ts := l.attempts[ip]
+	i := 0
+	for i < len(ts) && !ts[i].After(cutoff) {
+		i++
+	}
+	ts = append(ts[i:], now)
+	// keep at most limit+1 timestamps; older ones can't change the outcome
+	if len(ts) > l.limit+1 {
+		ts = ts[len(ts)-l.limit-1:]
+	}
+	l.attempts[ip] = ts
+	if len(ts) <= l.limit {
+		return true, 0
+	}
+	return false, ts[0].Add(l.window).Sub(now)
+}
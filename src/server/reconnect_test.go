@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectLimiterSlidingWindow(t *testing.T) {
+	l := newReconnectLimiter(3, 50*time.Millisecond)
+	for i := range 3 {
+		if ok, _ := l.allow("10.0.0.1"); !ok {
+			t.Fatalf("attempt %d refused within the limit", i+1)
+		}
+	}
+	ok, retryAfter := l.allow("10.0.0.1")
+	if ok || retryAfter <= 0 || retryAfter > 50*time.Millisecond {
+		t.Fatalf("fourth attempt: ok %v retry after %s, want refused within the window", ok, retryAfter)
+	}
+	if ok, _ := l.allow("10.0.0.2"); !ok {
+		t.Fatal("another IP was limited by the first one's attempts")
+	}
+
+	// rejected attempts count, but once they age out the IP is let back in
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := l.allow("10.0.0.1"); !ok {
+		t.Fatal("attempt refused after the window passed")
+	}
+}
+
+func TestWSReconnectStormRejected(t *testing.T) {
+	ts := newTestServer(t, Dependencies{Config: Config{ReconnectLimit: 5, ReconnectWindow: time.Minute}})
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/ai"
+
+	var rejected *http.Response
+	for i := range 20 {
+		conn, resp, err := websocket.DefaultDialer.Dial(u, nil)
+		if err == nil {
+			if i >= 5 {
+				t.Fatalf("upgrade %d accepted past a limit of 5", i+1)
+			}
+			conn.Close()
+			continue
+		}
+		if i < 5 {
+			t.Fatalf("upgrade %d within the limit: %v", i+1, err)
+		}
+		rejected = resp
+	}
+	if rejected == nil || rejected.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("rejected upgrade response %+v, want a 429", rejected)
+	}
+	if s, err := strconv.Atoi(rejected.Header.Get("Retry-After")); err != nil || s < 1 || s > 61 {
+		t.Fatalf("Retry-After = %q, want seconds until the window frees up", rejected.Header.Get("Retry-After"))
+	}
+	// plain HTTP from the same client isn't affected
+	resp, err := http.Get(ts.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/stats status %d during a reconnect storm", resp.StatusCode)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"j-project/src/utils/dump"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type replayRequest struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider,omitempty"` // overrides the stored provider when set
+}
+
+// handleReplay re-runs a stored interaction and compares the new response with the old one.
+func (srv *server) handleReplay(c *gin.Context) {
+	recorder := srv.deps.Recorder
+	if recorder == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "interaction store disabled; set DUMP_DIR"})
+		return
+	}
+	var req replayRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be {\"id\":\"...\",\"provider\":\"...\"}"})
+		return
+	}
+	meta, stored, err := recorder.Load(req.ID)
+	if errors.Is(err, dump.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider := meta.Provider
+	if req.Provider != "" {
+		provider = req.Provider
+	}
+
+	// the replay is itself recorded so it can be replayed or compared later
+	rec := recorder.Start(provider, meta.Prompt)
+	var b strings.Builder
+	err = srv.deps.Stream(c.Request.Context(), provider, meta.Prompt, func(chunk string) {
+		rec.Write(chunk)
+		b.WriteString(chunk)
+	})
+	rec.Close(err)
+
+	out := gin.H{
+		"id":        rec.ID(),
+		"replay_of": meta.ID,
+		"provider":  provider,
+		"response":  b.String(),
+		"diff":      dump.Compare(stored, b.String()),
+	}
+	if err != nil {
+		out["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, out)
+}
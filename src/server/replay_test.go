@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"j-project/src/utils/ai"
+	"j-project/src/utils/dump"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReplayRequiresAdmin(t *testing.T) {
+	rec, err := dump.NewRecorder(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := scripted(&ai.ScriptedProvider{Chunks: []string{"new ", "answer"}})
+	stored := rec.Start(provider, "question")
+	stored.Write("old answer")
+	stored.Close(nil)
+	stored.Wait()
+
+	ts := newTestServer(t, Dependencies{Config: Config{AdminToken: "s3cret"}, Recorder: rec})
+	post := func(path, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("POST", ts.URL+path, strings.NewReader(`{"id":"`+stored.ID()+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := post("/replay", "s3cret"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/replay status = %d, want 404 now that it is an admin route", resp.StatusCode)
+	}
+	for _, token := range []string{"", "wrong"} {
+		if resp := post("/admin/replay", token); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("/admin/replay with token %q: status = %d, want 401", token, resp.StatusCode)
+		}
+	}
+
+	resp := post("/admin/replay", "s3cret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/admin/replay status = %d, want 200", resp.StatusCode)
+	}
+	var out struct {
+		ReplayOf string `json:"replay_of"`
+		Response string `json:"response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ReplayOf != stored.ID() || out.Response != "new answer" {
+		t.Errorf("replay = %+v, want the new response to %s", out, stored.ID())
+	}
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"j-project/src/utils/ai"
+	"j-project/src/utils/conversation"
+	"j-project/src/utils/dump"
+	"j-project/src/utils/events"
+	"j-project/src/utils/metrics"
+	"j-project/src/utils/tts"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds the HTTP server settings.
+type Config struct {
+	WriteTimeout   time.Duration // bounds each WebSocket write; a stalled client is disconnected
+	MaxQueryPrompt int           // maximum length in bytes of the /ws/ai ?prompt= parameter
+	MaxConns       int           // maximum concurrent WebSocket connections; 0 means unlimited
+	AdminToken     string        // bearer token for /admin routes; empty disables them
+	Citations      bool          // send a citations frame after augmented responses
+	Reasoning      bool          // send reasoning tokens as {"type":"reasoning"} frames
+	SearchFrames   bool          // default for sending {"type":"search"} frames; prompts may override
+	StreamBuffer   int           // chunks a provider may run ahead of a slow client; 0 writes synchronously
+	PauseBuffer    int           // chunks held for a paused client before the provider is stalled
+	BusyPolicy     BusyPolicy    // what a prompt sent while another runs does; empty queues it
+	// ProgressInterval and ProgressChars send a {"type":"progress"} frame once that much
+	// time has passed or that many characters were sent since the last one. Both are
+	// checked as chunks are delivered; zero disables either.
+	ProgressInterval time.Duration
+	ProgressChars    int
+	// DebugPrompts lets prompts with "debug": true receive a {"type":"debug_prompt"}
+	// frame with the prompt as sent upstream. When AdminToken is set the connection
+	// must also present it as a bearer token.
+	DebugPrompts bool
+	// DegradedResponse, when set, is sent as the answer instead of an error frame when
+	// a prompt fails upstream before any content, e.g. with every fallback down. The
+	// end frame (or JSON response) then carries "degraded": true.
+	DegradedResponse string
+	// ConversationTTL and ConversationTurns bound the history kept for ?session= connections.
+	// A zero TTL disables conversation history.
+	ConversationTTL   time.Duration
+	ConversationTurns int
+	// IdempotencyTTL is how long a response is kept for replay to prompts carrying the
+	// same idempotency_key. Zero disables idempotency keys.
+	IdempotencyTTL time.Duration
+	// ReconnectLimit is how many WebSocket upgrades one client IP may attempt within
+	// ReconnectWindow; more are rejected with 429. Zero disables the limit.
+	ReconnectLimit  int
+	ReconnectWindow time.Duration
+}
+
+// ConfigFromEnv reads Config from WS_WRITE_TIMEOUT, WS_MAX_QUERY_PROMPT, WS_MAX_CONNECTIONS
+// ADMIN_TOKEN, WS_CITATIONS, WS_REASONING, WS_SEARCH_FRAMES, WS_STREAM_BUFFER, WS_PAUSE_BUFFER,
+// WS_BUSY_POLICY, WS_PROGRESS_INTERVAL, WS_PROGRESS_CHARS, WS_DEBUG_PROMPTS, DEGRADED_RESPONSE, WS_CONVERSATION_TTL, WS_CONVERSATION_TURNS,
+// WS_IDEMPOTENCY_TTL, WS_RECONNECT_LIMIT and WS_RECONNECT_WINDOW.
+func ConfigFromEnv() Config {
+	return Config{
+		WriteTimeout:   envDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+		MaxQueryPrompt: envInt("WS_MAX_QUERY_PROMPT", 4096),
+		MaxConns:       envInt("WS_MAX_CONNECTIONS", 1000),
+		AdminToken:     os.Getenv("ADMIN_TOKEN"),
+		Citations:      os.Getenv("WS_CITATIONS") != "false",
+		Reasoning:      os.Getenv("WS_REASONING") != "false",
+		SearchFrames:   os.Getenv("WS_SEARCH_FRAMES") == "true",
+		StreamBuffer:   envInt("WS_STREAM_BUFFER", 0),
+		PauseBuffer:    envInt("WS_PAUSE_BUFFER", 256),
+		BusyPolicy:     ParseBusyPolicy(os.Getenv("WS_BUSY_POLICY")),
+		DebugPrompts:   os.Getenv("WS_DEBUG_PROMPTS") == "true",
+
+		ProgressInterval:  envDuration("WS_PROGRESS_INTERVAL", 0),
+		ProgressChars:     envInt("WS_PROGRESS_CHARS", 0),
+		DegradedResponse:  os.Getenv("DEGRADED_RESPONSE"),
+		ConversationTTL:   envDuration("WS_CONVERSATION_TTL", 30*time.Minute),
+		ConversationTurns: envInt("WS_CONVERSATION_TURNS", 20),
+		IdempotencyTTL:    envDuration("WS_IDEMPOTENCY_TTL", 10*time.Minute),
+		ReconnectLimit:    envInt("WS_RECONNECT_LIMIT", 20),
+		ReconnectWindow:   envDuration("WS_RECONNECT_WINDOW", 10*time.Second),
+	}
+}
+
+// StreamFunc streams a prompt from the named provider; ai.Stream is the default.
+type StreamFunc func(ctx context.Context, provider, prompt string, handler ai.StreamHandler) error
+
+// Speaker speaks one streamed response. *tts.Stream implements it. Speech stops when
+// the context the Speaker was created with ends.
+type Speaker interface {
+	Write(chunk string)
+	Close()
+}
+
+// Dependencies are injected into the handlers built by NewRouter.
+type Dependencies struct {
+	Config   Config
+	Recorder *dump.Recorder                    // optional interaction store; enables /admin/replay
+	Stream   StreamFunc                        // defaults to ai.Stream
+	Speaker  func(ctx context.Context) Speaker // defaults to an espeak tts.Stream per response
+	// Synthesize renders one sentence as audio for /ws/voice; defaults to tts.Synthesize.
+	Synthesize func(ctx context.Context, text string) ([]byte, error)
+	// Conversations holds per-session history; by default one is created from the
+	// Config's conversation settings.
+	Conversations *conversation.Store
+}
+
+// NopSpeaker returns a Speaker that discards everything, for running the handlers
+// without espeak (e.g. against an httptest.Server).
+func NopSpeaker() Speaker { return nopSpeaker{} }
+
+type nopSpeaker struct{}
+
+func (nopSpeaker) Write(string) {}
+func (nopSpeaker) Close()       {}
+
+// server is the state shared by all handlers.
+type server struct {
+	deps        Dependencies
+	conns       atomic.Int64      // currently open WebSocket connections
+	idempotency *idempotencyStore // nil when idempotency keys are disabled
+	reconnects  *reconnectLimiter // nil when upgrades aren't rate limited
+	generations *generations      // running /chat requests, cancellable with DELETE
+}
+
+// NewRouter builds the HTTP routes.
+func NewRouter(deps Dependencies) *gin.Engine {
+	if deps.Stream == nil {
+		deps.Stream = ai.Stream
+	}
+	if deps.Speaker == nil {
+		deps.Speaker = func(ctx context.Context) Speaker { return tts.NewStreamContext(ctx, "espeak") }
+	}
+	if deps.Synthesize == nil {
+		deps.Synthesize = tts.Synthesize
+	}
+	if deps.Conversations == nil && deps.Config.ConversationTTL > 0 {
+		deps.Conversations = conversation.NewStore(deps.Config.ConversationTTL, deps.Config.ConversationTurns)
+	}
+	srv := &server{deps: deps, generations: newGenerations()}
+	if deps.Config.IdempotencyTTL > 0 {
+		srv.idempotency = newIdempotencyStore(deps.Config.IdempotencyTTL)
+	}
+	if deps.Config.ReconnectLimit > 0 && deps.Config.ReconnectWindow > 0 {
+		srv.reconnects = newReconnectLimiter(deps.Config.ReconnectLimit, deps.Config.ReconnectWindow)
+	}
+
+	r := gin.Default()
+	r.Use(countRequests)
+
+	r.GET("/health", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/plain", []byte("OK"))
+	})
+
+	// readiness details; TTS is optional so its absence doesn't fail the probe
+	r.GET("/health/ready", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "tts": tts.Available()})
+	})
+
+	// WebSocket endpoint for live AI comms. Client should send a JSON or plain text prompt.
+	// An initial prompt may also be passed as ?prompt=, bounded by Config.MaxQueryPrompt.
+	r.GET("/ws/ai", srv.handleWS)
+
+	// spoken responses: text frames interleaved with synthesized audio, one prompt at a time
+	r.GET("/ws/voice", srv.handleVoice)
+
+	// single-shot generation over plain HTTP
+	r.POST("/chat", srv.handleChat)
+	r.DELETE("/chat/:id", srv.handleCancelChat)
+
+	// administrative controls, guarded by Config.AdminToken
+	admin := r.Group("/admin", srv.requireAdmin)
+	admin.POST("/cancel-all", func(c *gin.Context) {
+		n := ai.CancelAll()
+		log.Printf("admin: cancelled %d active streams", n)
+		c.JSON(http.StatusOK, gin.H{"cancelled": n})
+	})
+	// re-run a dumped interaction, optionally against another provider; it spends
+	// provider quota and reveals stored prompts, so it is an admin route
+	admin.POST("/replay", srv.handleReplay)
+	// live event stream for dashboards, as server-sent events
+	admin.GET("/events", srv.handleEvents)
+	admin.GET("/default-provider", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"name": ai.DefaultProvider()})
+	})
+	admin.PUT("/default-provider", func(c *gin.Context) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "body must be {\"name\":\"...\"}"})
+			return
+		}
+		prev := ai.DefaultProvider()
+		if err := ai.SetDefaultProvider(body.Name); err != nil {
+			code, status := errorCode(err)
+			c.JSON(status, gin.H{"error": err.Error(), "code": code})
+			return
+		}
+		log.Printf("admin: default provider changed from %s to %s", prev, body.Name)
+		c.JSON(http.StatusOK, gin.H{"name": body.Name, "previous": prev})
+	})
+
+	// exposition endpoint for sinks that serve their own samples, e.g. metrics.Prometheus
+	if h, ok := metrics.Get().(http.Handler); ok {
+		r.GET("/metrics", gin.WrapH(h))
+	}
+
+	r.GET("/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"breakers":       ai.BreakerStates(),
+			"aliases":        ai.Aliases(),
+			"in_flight":      ai.InFlight(),
+			"active_streams": ai.ActiveStreams(),
+			"ws_connections": srv.conns.Load(),
+			"tts_dropped":    tts.Dropped(),
+			"events_dropped": events.Default.Dropped(),
+		})
+	})
+
+	return r
+}
+
+// countRequests reports every request by route and status to the metrics sink.
+func countRequests(c *gin.Context) {
+	c.Next()
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	metrics.Get().IncrCounter(metrics.HTTPRequestsTotal,
+		metrics.Tag{Key: "route", Value: route},
+		metrics.Tag{Key: "code", Value: strconv.Itoa(c.Writer.Status())})
+}
+
+// requireAdmin rejects requests without "Authorization: Bearer <AdminToken>".
+func (srv *server) requireAdmin(c *gin.Context) {
+	token := srv.deps.Config.AdminToken
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin routes disabled; set ADMIN_TOKEN"})
+		return
+	}
+	if !bearerMatches(c.GetHeader("Authorization"), token) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	c.Next()
+}
+
+// bearerMatches reports whether an Authorization header value is "Bearer <token>".
+func bearerMatches(header, token string) bool {
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// envInt reads an integer from the environment, falling back to def.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %d: %v", name, v, def, err)
+		return def
+	}
+	return n
+}
+
+// envDuration reads a duration (e.g. "10s") from the environment, falling back to def.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("invalid %s=%q, using %s: %v", name, v, def, err)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"j-project/src/utils/ai"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postChat sends body to /chat with the given Accept header.
+func postChat(t *testing.T, ts *httptest.Server, body, accept string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", ts.URL+"/chat", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+func TestHealth(t *testing.T) {
+	ts := newTestServer(t, Dependencies{})
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "OK" {
+		t.Fatalf("/health = %d %q, want 200 OK", resp.StatusCode, body)
+	}
+}
+
+func TestChatJSON(t *testing.T) {
+	ts := newTestServer(t, Dependencies{})
+	ok := scripted(&ai.ScriptedProvider{Chunks: []string{"Hello", ", ", "world"}})
+	failing := scripted(&ai.ScriptedProvider{Chunks: []string{"partial"}, Err: &ai.ProviderError{StatusCode: 500, Msg: "boom"}})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       map[string]any
+	}{
+		{"success", `{"prompt":"hi","provider":"` + ok + `"}`, http.StatusOK,
+			map[string]any{"response": "Hello, world", "finish_reason": "stop", "truncated": false}},
+		{"provider error keeps partial output", `{"prompt":"hi","provider":"` + failing + `"}`, http.StatusBadGateway,
+			map[string]any{"response": "partial", "finish_reason": "error", "code": "provider_error"}},
+		{"empty prompt", `{"prompt":"  ","provider":"mock"}`, http.StatusBadRequest,
+			map[string]any{"code": "empty_prompt", "finish_reason": "error"}},
+		{"malformed body", `{"prompt":`, http.StatusBadRequest, map[string]any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := postChat(t, ts, tt.body, "")
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", resp.StatusCode, tt.wantStatus, body)
+			}
+			var got map[string]any
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("body %q: %v", body, err)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v (body %s)", k, got[k], v, body)
+				}
+			}
+			if resp.Header.Get("X-Generation-ID") == "" && resp.StatusCode != http.StatusBadRequest {
+				t.Error("missing X-Generation-ID header")
+			}
+		})
+	}
+}
+
+func TestChatPlainText(t *testing.T) {
+	ts := newTestServer(t, Dependencies{})
+	ok := scripted(&ai.ScriptedProvider{Chunks: []string{"one ", "two"}})
+	failing := scripted(&ai.ScriptedProvider{Chunks: []string{"one "}, Err: &ai.ProviderError{StatusCode: 500, Msg: "boom"}})
+	early := scripted(&ai.ScriptedProvider{Err: &ai.ProviderError{StatusCode: 500, Msg: "boom"}})
+
+	resp, body := postChat(t, ts, `{"prompt":"hi","provider":"`+ok+`"}`, "text/plain")
+	if resp.StatusCode != http.StatusOK || body != "one two" {
+		t.Errorf("stream = %d %q, want 200 %q", resp.StatusCode, body, "one two")
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// once output has started the status is committed; the error follows the text
+	resp, body = postChat(t, ts, `{"prompt":"hi","provider":"`+failing+`"}`, "text/plain")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(body, "one \n__error__: ") {
+		t.Errorf("late failure = %d %q", resp.StatusCode, body)
+	}
+
+	// before any output the error still gets its status
+	resp, body = postChat(t, ts, `{"prompt":"hi","provider":"`+early+`"}`, "text/plain")
+	if resp.StatusCode != http.StatusBadGateway || !strings.HasPrefix(body, "__error__: ") {
+		t.Errorf("early failure = %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestChatDegradedResponse(t *testing.T) {
+	ts := newTestServer(t, Dependencies{Config: Config{DegradedResponse: "try again later"}})
+	failing := scripted(&ai.ScriptedProvider{Err: &ai.ProviderError{StatusCode: 503, Msg: "down"}})
+
+	resp, body := postChat(t, ts, `{"prompt":"hi","provider":"`+failing+`"}`, "")
+	var got map[string]any
+	json.Unmarshal([]byte(body), &got)
+	if resp.StatusCode != http.StatusOK || got["response"] != "try again later" || got["degraded"] != true {
+		t.Fatalf("degraded = %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestAdminCancelAll(t *testing.T) {
+	provider := scripted(&ai.ScriptedProvider{Chunks: strings.Split(strings.Repeat("x", 500), ""), Delay: 10 * time.Millisecond})
+	ts := newTestServer(t, Dependencies{Config: Config{AdminToken: "s3cret"}})
+	a := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+	b := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+	for _, c := range []*wsClient{a, b} {
+		c.send("go")
+		// wait for the first chunk
+		for {
+			if f := c.read(); f.JSON == nil {
+				break
+			}
+		}
+	}
+
+	if resp := adminRequest(t, ts, "POST", "/admin/cancel-all", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("/admin/cancel-all without the token: status %d, want 401", resp.StatusCode)
+	}
+	resp := adminRequest(t, ts, "POST", "/admin/cancel-all", "s3cret", "")
+	var out struct{ Cancelled int }
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("/admin/cancel-all = %d, %v", resp.StatusCode, err)
+	}
+	if out.Cancelled != 2 {
+		t.Fatalf("cancelled %d streams, want 2", out.Cancelled)
+	}
+	for _, c := range []*wsClient{a, b} {
+		frames := c.readUntilEnd()
+		if errs := ofType(frames, "error"); len(errs) != 1 {
+			t.Fatalf("frames after cancel-all = %+v, want one error frame", frames)
+		}
+		if last := frames[len(frames)-1].Text; !strings.HasPrefix(last, "__error__: ") {
+			t.Fatalf("last frame = %q, want the __error__ marker", last)
+		}
+	}
+}
+
+func TestChatCancelWithDelete(t *testing.T) {
+	provider := scripted(&ai.ScriptedProvider{Chunks: strings.Split(strings.Repeat("x", 500), ""), Delay: 10 * time.Millisecond})
+	ts := newTestServer(t, Dependencies{})
+	del := func(id string) int {
+		t.Helper()
+		req, _ := http.NewRequest("DELETE", ts.URL+"/chat/"+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// streamed: the ID arrives with the first chunk
+	req, _ := http.NewRequest("POST", ts.URL+"/chat", strings.NewReader(`{"provider":"`+provider+`","prompt":"go"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	id := resp.Header.Get("X-Generation-ID")
+	if id == "" {
+		t.Fatal("no X-Generation-ID header")
+	}
+	if status := del(id); status != http.StatusOK {
+		t.Fatalf("DELETE /chat/%s = %d, want 200", id, status)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasSuffix(string(body), "\n__error__: generation cancelled\n") || len(body) > 400 {
+		t.Fatalf("body after DELETE = %q, want a cut-off answer and the cancel marker", body)
+	}
+	if status := del(id); status != http.StatusNotFound {
+		t.Fatalf("DELETE of a finished generation = %d, want 404", status)
+	}
+
+	// JSON: the client names the generation up front
+	type result struct {
+		status int
+		body   map[string]any
+	}
+	results := make(chan result, 1)
+	go func() {
+		req, _ := http.NewRequest("POST", ts.URL+"/chat", strings.NewReader(`{"provider":"`+provider+`","prompt":"go"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Generation-ID", "gen-1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			close(results)
+			return
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		results <- result{resp.StatusCode, out}
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for del("gen-1") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("generation gen-1 never became cancellable")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case r := <-results:
+		if r.status == http.StatusOK || r.body["error"] == nil {
+			t.Fatalf("cancelled JSON generation = %d %v, want an error", r.status, r.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the JSON generation kept running after DELETE")
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"j-project/src/utils/ai"
+	"j-project/src/utils/redact"
+	"j-project/src/utils/tts"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// voiceSession is one /ws/voice connection. It answers one prompt at a time: the
+// response text is sent as {"type":"text"} frames as it streams, and each completed
+// sentence is synthesized and sent as an {"type":"audio"} frame followed by a binary
+// frame holding the WAV. A {"type":"cancel"} message or disconnecting stops both the
+// generation and the synthesis. The voice comes from the prompt's "voice" field or the
+// ?voice= query parameter.
+type voiceSession struct {
+	conn     *websocket.Conn
+	srv      *server
+	provider string
+	voice    string
+	header   http.Header
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc // of the running prompt; nil when idle
+	running sync.WaitGroup
+	nextID  int
+}
+
+// handleVoice serves /ws/voice. Clients send plain-text prompts or {"type":"prompt"}
+// and {"type":"cancel"} messages.
+func (srv *server) handleVoice(c *gin.Context) {
+	conn, release, ok := srv.upgrade(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	v := &voiceSession{conn: conn, srv: srv, provider: c.Query("provider"), voice: c.Query("voice"), header: c.Request.Header}
+	if err := checkProvider(v.provider); err != nil {
+		code, _ := errorCode(err)
+		v.writeJSON(map[string]any{"type": "error", "code": code, "error": err.Error()})
+		return
+	}
+	defer v.running.Wait()
+	defer v.stop()
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("voice: read error: %v", err)
+			return
+		}
+		in := parseInbound(msg)
+		switch in.Type {
+		case "prompt":
+			v.start(in)
+		case "cancel":
+			if !v.stop() {
+				v.writeJSON(map[string]any{"type": "error", "error": "nothing to cancel"})
+			}
+		default:
+			v.writeJSON(map[string]any{"type": "error", "error": "unknown message type: " + in.Type})
+		}
+	}
+}
+
+// start runs a prompt in the background, refusing it while another one is running.
+func (v *voiceSession) start(in inboundMessage) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.cancel != nil {
+		v.writeJSON(map[string]any{"type": "error", "code": "busy", "error": "a prompt is already running; cancel it first", "id": in.ID})
+		return
+	}
+	v.nextID++
+	id := in.ID
+	if id == "" {
+		id = strconv.Itoa(v.nextID)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	voice := in.Voice
+	if voice == "" {
+		voice = v.voice
+	}
+	if voice != "" {
+		ctx = tts.WithVoice(ctx, voice)
+	}
+	v.cancel = cancel
+	v.running.Add(1)
+	go func() {
+		defer v.running.Done()
+		v.run(ctx, id, in.Prompt)
+		v.mu.Lock()
+		v.cancel = nil
+		v.mu.Unlock()
+		cancel()
+	}()
+}
+
+// stop cancels the running prompt and reports whether there was one.
+func (v *voiceSession) stop() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.cancel == nil {
+		return false
+	}
+	v.cancel()
+	return true
+}
+
+func (v *voiceSession) run(ctx context.Context, id, prompt string) {
+	log.Printf("voice: running prompt %s (provider=%s): %s", id, v.provider, redact.SafeString(prompt))
+	var res ai.Result
+	ctx = withChaosHeaders(ai.WithRequestID(ai.WithResult(ctx, &res), id), v.header)
+
+	// sentences are synthesized one after another while the text keeps streaming
+	sentences := make(chan string, 8)
+	synthDone := make(chan struct{})
+	go func() {
+		defer close(synthDone)
+		v.synthesize(ctx, id, sentences)
+	}()
+
+	var split tts.Sentences
+	failed := false
+	err := v.srv.deps.Stream(ctx, v.provider, prompt, func(chunk string) {
+		if failed {
+			return
+		}
+		if err := v.writeJSON(map[string]any{"type": "text", "id": id, "content": chunk}); err != nil {
+			failed = true
+			v.stop()
+			return
+		}
+		for _, s := range split.Write(chunk) {
+			select {
+			case sentences <- s:
+			case <-ctx.Done():
+			}
+		}
+	})
+	if rest := split.Flush(); rest != "" && err == nil {
+		select {
+		case sentences <- rest:
+		case <-ctx.Done():
+		}
+	}
+	close(sentences)
+	<-synthDone
+
+	end := map[string]any{"type": "end", "id": id, "finish_reason": finishReason(res, err)}
+	if err != nil {
+		log.Printf("voice: prompt %s failed: %s", id, redact.Scrub(err.Error()))
+		code, _ := errorCode(err)
+		end["code"], end["error"] = code, err.Error()
+	}
+	v.writeJSON(end)
+}
+
+// synthesize turns each sentence into an audio frame until sentences is closed. Once
+// ctx is done the remaining sentences are dropped. A sentence that fails to synthesize
+// is reported and skipped; if TTS is unavailable the response continues as text only.
+func (v *voiceSession) synthesize(ctx context.Context, id string, sentences <-chan string) {
+	seq := 0
+	disabled := false
+	for s := range sentences {
+		if ctx.Err() != nil || disabled {
+			continue
+		}
+		audio, err := v.srv.deps.Synthesize(ctx, s)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			if errors.Is(err, tts.ErrUnavailable) {
+				disabled = true
+				v.writeJSON(map[string]any{"type": "error", "code": "tts_unavailable", "error": err.Error(), "id": id})
+				continue
+			}
+			log.Printf("voice: synthesis failed for prompt %s: %v", id, err)
+			v.writeJSON(map[string]any{"type": "error", "code": "tts_failed", "error": err.Error(), "id": id, "text": s})
+			continue
+		}
+		seq++
+		v.writeMu.Lock()
+		header, _ := json.Marshal(map[string]any{"type": "audio", "id": id, "seq": seq, "text": s, "format": "audio/wav", "bytes": len(audio)})
+		timeout := v.srv.deps.Config.WriteTimeout
+		err = writeFrame(v.conn, timeout, websocket.TextMessage, header)
+		if err == nil {
+			err = writeFrame(v.conn, timeout, websocket.BinaryMessage, audio)
+		}
+		v.writeMu.Unlock()
+		if err != nil {
+			// the client is gone; stop the prompt and drain what is left
+			log.Printf("voice: write error: %v", err)
+			disabled = true
+			v.stop()
+		}
+	}
+}
+
+// writeJSON writes a JSON control frame.
+func (v *voiceSession) writeJSON(m map[string]any) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	v.writeMu.Lock()
+	defer v.writeMu.Unlock()
+	if err := writeMessage(v.conn, v.srv.deps.Config.WriteTimeout, b); err != nil {
+		log.Printf("voice: write error: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,759 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"j-project/src/utils/ai"
+	"j-project/src/utils/conversation"
+	"j-project/src/utils/dump"
+	"j-project/src/utils/events"
+	"j-project/src/utils/logsample"
+	"j-project/src/utils/metrics"
+	"j-project/src/utils/redact"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// inboundMessage is a client message. Plain-text frames are treated as {"type":"prompt"}.
+type inboundMessage struct {
+	Type     string   `json:"type"`
+	ID       string   `json:"id,omitempty"`
+	Prompt   string   `json:"prompt,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	Stop     []string `json:"stop,omitempty"` // stop sequences for this prompt
+	// IdempotencyKey makes a retried prompt replay the first response (see Config.IdempotencyTTL).
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// ShowSearch turns the search frame on or off for this prompt (see Config.SearchFrames).
+	ShowSearch *bool `json:"show_search,omitempty"`
+	// Temperature and MaxTokens override the connection's options for a prompt, or set
+	// them for the connection in an {"type":"options"} message.
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	// Voice picks the TTS voice for a /ws/voice prompt (see tts.WithVoice).
+	Voice string `json:"voice,omitempty"`
+	// Debug asks for a debug_prompt frame; ignored unless Config.DebugPrompts allows it.
+	Debug bool `json:"debug,omitempty"`
+	// APIKey authenticates this prompt's upstream request in place of the server's key
+	// (see ai.WithAPIKey). It is never logged or kept past the prompt.
+	APIKey string `json:"api_key,omitempty"`
+}
+
+// parseInbound decodes a JSON control message, or wraps any other frame as a prompt.
+func parseInbound(msg []byte) inboundMessage {
+	trimmed := bytes.TrimSpace(msg)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var m inboundMessage
+		if err := json.Unmarshal(trimmed, &m); err == nil && m.Type != "" {
+			return m
+		}
+	}
+	return inboundMessage{Type: "prompt", Prompt: string(msg)}
+}
+
+type queuedPrompt struct {
+	id       string
+	prompt   string
+	priority int
+	stop     []string
+	idemKey  string
+	search   bool
+	debug    bool
+	apiKey   string
+	opts     ai.Options
+}
+
+// wsSession is one /ws/ai connection. The read loop enqueues prompts while a single
+// worker goroutine runs them one at a time, highest priority first. A prompt sent while
+// another is running or queued is handled per Config.BusyPolicy.
+type wsSession struct {
+	conn       *websocket.Conn
+	srv        *server
+	provider   string
+	session    string // conversation id from ?session=; empty means no history
+	historyKey string // the session's key in the conversation store (see conversationKey)
+	caller     string // who opened the connection (see callerIdentity)
+	chunkLog   *logsample.Sampler
+	header     http.Header // of the upgrade request; carries per-connection chaos settings
+	pause      *pauseGate  // {"type":"pause"} / {"type":"resume"}
+	debug      bool        // prompts may ask for debug_prompt frames
+
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	opts          ai.Options      // connection defaults set with {"type":"options"}
+	queue         []*queuedPrompt // sorted by priority, FIFO within a priority
+	running       *queuedPrompt
+	cancelRunning context.CancelFunc
+	nextID        int
+	wake          chan struct{}
+}
+
+// handleWS serves /ws/ai. Clients send plain-text prompts or JSON control messages.
+func (srv *server) handleWS(c *gin.Context) {
+	cfg := srv.deps.Config
+
+	// an optional ?prompt= starts streaming right after the upgrade
+	initialPrompt := c.Query("prompt")
+	if cfg.MaxQueryPrompt > 0 && len(initialPrompt) > cfg.MaxQueryPrompt {
+		c.String(http.StatusRequestURITooLong, "prompt query parameter exceeds %d bytes", cfg.MaxQueryPrompt)
+		return
+	}
+
+	conn, release, ok := srv.upgrade(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	s := &wsSession{
+		conn: conn,
+		srv:  srv,
+		// read provider from the initial HTTP query parameters
+		provider:   c.Query("provider"), // e.g. "jetify", "anthropic", "ollama"
+		session:    c.Query("session"),
+		historyKey: conversationKey(c),
+		caller:     callerIdentity(c),
+		chunkLog:   logsample.FromEnv(),
+		header:     c.Request.Header,
+		pause:      newPauseGate(cfg.PauseBuffer),
+		wake:       make(chan struct{}, 1),
+		debug:      cfg.DebugPrompts && (cfg.AdminToken == "" || bearerMatches(c.GetHeader("Authorization"), cfg.AdminToken)),
+	}
+	if err := checkProvider(s.provider); err != nil {
+		// the upgrade already succeeded, so the reason goes in a frame before closing
+		code, _ := errorCode(err)
+		s.writeJSON(map[string]any{"type": "error", "code": code, "error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.worker(ctx)
+		close(done)
+	}()
+
+	if initialPrompt != "" {
+		s.enqueue(inboundMessage{Type: "prompt", Prompt: initialPrompt})
+	}
+
+	s.readLoop()
+	cancel()
+	<-done
+}
+
+// conversationKey is the store key for a connection's ?session=. It is scoped to the
+// credentials the connection presented, or to the connection itself for anonymous
+// clients, so nobody can read or extend another caller's history by naming its session.
+func conversationKey(c *gin.Context) string {
+	session := c.Query("session")
+	if session == "" {
+		return ""
+	}
+	owner := c.GetHeader("Authorization")
+	if owner == "" {
+		var b [16]byte
+		_, _ = rand.Read(b[:])
+		owner = "conn\x00" + hex.EncodeToString(b[:])
+	}
+	sum := sha256.Sum256([]byte(owner + "\x00" + session))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *wsSession) readLoop() {
+	for {
+		// Read message (blocking until client sends)
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			log.Printf("ws read error: %v", err)
+			return
+		}
+
+		in := parseInbound(msg)
+		switch in.Type {
+		case "prompt":
+			if err := validateOptions(in); err != nil {
+				s.writeJSON(map[string]any{"type": "error", "code": "invalid_options", "error": err.Error(), "id": in.ID})
+				continue
+			}
+			s.enqueue(in)
+		case "options":
+			s.setOptions(in)
+		case "cancel":
+			s.cancel(in.ID)
+		case "pause":
+			if !s.pause.pause() {
+				s.writeJSON(map[string]any{"type": "error", "error": "already paused"})
+				continue
+			}
+			s.writeJSON(map[string]any{"type": "paused"})
+		case "resume":
+			n, ok := s.pause.resume()
+			if !ok {
+				s.writeJSON(map[string]any{"type": "error", "error": "not paused"})
+				continue
+			}
+			s.writeJSON(map[string]any{"type": "resumed", "flushed": n})
+		case "reset":
+			if store := s.srv.deps.Conversations; store != nil && s.session != "" {
+				store.Reset(s.historyKey)
+			}
+			s.writeJSON(map[string]any{"type": "reset", "session": s.session})
+		case "info":
+			info := ai.Info(s.provider)
+			s.writeJSON(map[string]any{
+				"type":         "info",
+				"provider":     info.Name,
+				"requested":    info.Requested,
+				"fallback":     info.Fallback,
+				"model":        info.Model,
+				"capabilities": ai.ProviderCapabilities(info.Name),
+			})
+		default:
+			s.writeJSON(map[string]any{"type": "error", "error": "unknown message type: " + in.Type})
+		}
+	}
+}
+
+// upgrade admits a WebSocket client against the reconnect and connection limits and
+// upgrades the request. When ok is false the client has already been answered; otherwise
+// release must be called when the connection ends, and closes it.
+func (srv *server) upgrade(c *gin.Context) (conn *websocket.Conn, release func(), ok bool) {
+	cfg := srv.deps.Config
+	if srv.reconnects != nil {
+		if ok, retryAfter := srv.reconnects.allow(c.ClientIP()); !ok {
+			log.Printf("ws: rejecting upgrade from %s, more than %d attempts in %s", c.ClientIP(), cfg.ReconnectLimit, cfg.ReconnectWindow)
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter/time.Second)+1))
+			c.String(http.StatusTooManyRequests, "reconnecting too fast")
+			return nil, nil, false
+		}
+	}
+
+	n := srv.conns.Add(1)
+	metrics.Get().SetGauge(metrics.WSConnections, float64(n))
+	leave := func() {
+		metrics.Get().SetGauge(metrics.WSConnections, float64(srv.conns.Add(-1)))
+	}
+	if cfg.MaxConns > 0 && n > int64(cfg.MaxConns) {
+		leave()
+		log.Printf("ws: rejecting connection, limit of %d reached", cfg.MaxConns)
+		c.String(http.StatusServiceUnavailable, "too many connections")
+		return nil, nil, false
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		leave()
+		c.Error(err)
+		return nil, nil, false
+	}
+	remote := c.ClientIP()
+	events.Publish(events.Event{Type: events.ConnOpened, Fields: map[string]any{"remote": remote, "connections": n, "path": c.FullPath()}})
+	return conn, func() {
+		conn.Close()
+		events.Publish(events.Event{Type: events.ConnClosed, Fields: map[string]any{"remote": remote}})
+		leave()
+	}, true
+}
+
+// BusyPolicy decides what happens to a prompt sent while another one is running or queued.
+type BusyPolicy string
+
+const (
+	BusyQueue   BusyPolicy = "queue"   // queue it behind the others (the default)
+	BusyReject  BusyPolicy = "reject"  // answer {"type":"busy"} and drop it
+	BusyReplace BusyPolicy = "replace" // cancel the running prompt, drop the queued ones, run it next
+)
+
+// ParseBusyPolicy maps "queue", "reject" or "replace" to a BusyPolicy, defaulting to BusyQueue.
+func ParseBusyPolicy(s string) BusyPolicy {
+	switch p := BusyPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case BusyReject, BusyReplace:
+		return p
+	}
+	return BusyQueue
+}
+
+// enqueue adds a prompt to the queue and acknowledges it with its position, after
+// applying the Config's BusyPolicy if the connection is busy.
+func (s *wsSession) enqueue(in inboundMessage) {
+	s.mu.Lock()
+
+	if s.running != nil || len(s.queue) > 0 {
+		switch ParseBusyPolicy(string(s.srv.deps.Config.BusyPolicy)) {
+		case BusyReject:
+			busy := map[string]any{"type": "busy", "id": in.ID, "queued": len(s.queue)}
+			if s.running != nil {
+				busy["running"] = s.running.id
+			}
+			s.writeJSON(busy)
+			s.mu.Unlock()
+			return
+		case BusyReplace:
+			for _, item := range s.queue {
+				s.writeJSON(map[string]any{"type": "cancelled", "id": item.id})
+			}
+			s.queue = nil
+			if s.running != nil {
+				// its end frame reports the cancellation
+				s.cancelRunning()
+			}
+		}
+	}
+
+	s.nextID++
+	item := &queuedPrompt{id: in.ID, prompt: in.Prompt, priority: in.Priority, stop: in.Stop, idemKey: in.IdempotencyKey}
+	item.opts = s.opts
+	if in.Temperature != nil {
+		item.opts.Temperature = in.Temperature
+	}
+	if in.MaxTokens != nil {
+		item.opts.MaxTokens = in.MaxTokens
+	}
+	item.search = s.srv.deps.Config.SearchFrames
+	if in.ShowSearch != nil {
+		item.search = *in.ShowSearch
+	}
+	item.debug = in.Debug && s.debug
+	item.apiKey = in.APIKey
+	if item.id == "" {
+		item.id = strconv.Itoa(s.nextID)
+	}
+	pos := len(s.queue)
+	for pos > 0 && s.queue[pos-1].priority < item.priority {
+		pos--
+	}
+	s.queue = append(s.queue, nil)
+	copy(s.queue[pos+1:], s.queue[pos:])
+	s.queue[pos] = item
+
+	// the write lock is taken before the queue is released, so the ack still goes out
+	// before any frame of the item, which the worker may pick up at once, without the
+	// worker waiting on the queue lock while a slow client takes the frame
+	s.writeMu.Lock()
+	s.mu.Unlock()
+	ack, _ := json.Marshal(map[string]any{"type": "queued", "id": item.id, "position": pos + 1})
+	err := writeMessage(s.conn, s.srv.deps.Config.WriteTimeout, ack)
+	s.writeMu.Unlock()
+	if err != nil {
+		log.Printf("ws write error: %v", err)
+	}
+	log.Printf("ws: queued prompt %s (provider=%s, priority=%d, position=%d): %s", item.id, s.provider, item.priority, pos+1, redact.SafeString(item.prompt))
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// setOptions validates and stores connection-level generation options. Prompts queued
+// afterwards use them unless they set their own; prompts already queued keep theirs.
+func (s *wsSession) setOptions(in inboundMessage) {
+	if err := validateOptions(in); err != nil {
+		s.writeJSON(map[string]any{"type": "error", "code": "invalid_options", "error": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in.Temperature != nil {
+		s.opts.Temperature = in.Temperature
+	}
+	if in.MaxTokens != nil {
+		s.opts.MaxTokens = in.MaxTokens
+	}
+	s.writeJSON(map[string]any{"type": "options", "temperature": s.opts.Temperature, "max_tokens": s.opts.MaxTokens})
+}
+
+// validateOptions checks the generation options carried by a message.
+func validateOptions(in inboundMessage) error {
+	if t := in.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", *t)
+	}
+	if n := in.MaxTokens; n != nil && *n < 1 {
+		return fmt.Errorf("max_tokens must be at least 1, got %d", *n)
+	}
+	return nil
+}
+
+// cancel removes a queued prompt by id, or aborts the running one when id is empty or matches it.
+func (s *wsSession) cancel(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, item := range s.queue {
+		if item.id == id {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.writeJSON(map[string]any{"type": "cancelled", "id": id})
+			return
+		}
+	}
+	if s.running != nil && (id == "" || id == s.running.id) {
+		s.cancelRunning()
+		return
+	}
+	s.writeJSON(map[string]any{"type": "error", "error": "nothing to cancel", "id": id})
+}
+
+// next blocks until a prompt is queued or ctx is done, and marks it as running.
+func (s *wsSession) next(ctx context.Context) (*queuedPrompt, context.Context, context.CancelFunc) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			item := s.queue[0]
+			s.queue = s.queue[1:]
+			streamCtx, cancel := context.WithCancel(ctx)
+			s.running, s.cancelRunning = item, cancel
+			s.mu.Unlock()
+			return item, streamCtx, cancel
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, nil
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *wsSession) worker(ctx context.Context) {
+	for {
+		item, streamCtx, cancel := s.next(ctx)
+		if item == nil {
+			return
+		}
+		ok := s.run(streamCtx, cancel, item)
+		s.mu.Lock()
+		s.running, s.cancelRunning = nil, nil
+		s.mu.Unlock()
+		cancel()
+		if !ok {
+			// the client is gone or stalled; drop the connection so the read loop exits
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+// run streams a single prompt to the client. It returns false if writing to the client failed.
+func (s *wsSession) run(ctx context.Context, cancel context.CancelFunc, item *queuedPrompt) bool {
+	// a prompt with a known idempotency key is answered from the first run
+	var idem *idempotencyEntry
+	var idemChunks []string
+	var idemReason ai.FinishReason
+	idemOK := false
+	if key := item.idemKey; key != "" && s.srv.idempotency != nil {
+		e, handled, ok := s.claim(ctx, item)
+		if handled {
+			return ok
+		}
+		idem = e
+		scope := s.idempotencyScope(item)
+		defer func() { s.srv.idempotency.finish(scope, idem, idemChunks, idemReason, idemOK) }()
+	}
+
+	provider, prompt := s.provider, item.prompt
+	store, session := s.srv.deps.Conversations, s.session
+	if store == nil {
+		session = ""
+	}
+	var history []ai.Message
+	if session != "" {
+		history = conversation.Messages(store.History(s.historyKey))
+	}
+	log.Printf("ws: running prompt %s (provider=%s)", item.id, provider)
+
+	var res ai.Result
+	ctx = ai.WithRequestID(ai.WithResult(ctx, &res), item.id)
+	if history != nil {
+		// sent ahead of the prompt; the oldest turns go first if they don't fit
+		ctx = ai.WithMessages(ctx, history)
+	}
+	ctx = withChaosHeaders(ctx, s.header)
+	if item.apiKey != "" {
+		ctx = ai.WithAPIKey(ctx, item.apiKey)
+	}
+	if s.srv.deps.Config.Reasoning {
+		// reasoning goes out as tagged frames; content keeps the plain-text frames
+		ctx = ai.WithReasoning(ctx, func(chunk string) {
+			s.writeJSON(map[string]any{"type": "reasoning", "id": item.id, "content": chunk})
+		})
+	}
+	// tool calls made while answering, so the client can show the steps as they happen
+	ctx = ai.WithToolObserver(ctx, func(call ai.ToolCall, done bool) {
+		if !done {
+			var args any = call.Arguments
+			if !json.Valid(call.Arguments) {
+				args = string(call.Arguments) // malformed; sent as the model wrote it
+			}
+			s.writeJSON(map[string]any{"type": "tool_call", "id": item.id, "name": call.Name, "args": args})
+			return
+		}
+		frame := map[string]any{"type": "tool_result", "id": item.id, "name": call.Name, "result": call.Output}
+		if call.Error != "" {
+			frame["error"] = call.Error
+		}
+		s.writeJSON(frame)
+	})
+	if item.debug {
+		ctx = ai.WithPromptObserver(ctx, func(prompt string) {
+			s.writeJSON(map[string]any{"type": "debug_prompt", "id": item.id, "text": prompt})
+		})
+	}
+	if item.search {
+		// what was searched and found, sent before the answer starts streaming
+		ctx = ai.WithSearchObserver(ctx, func(query string, results []string) {
+			if results == nil {
+				results = []string{}
+			}
+			s.writeJSON(map[string]any{"type": "search", "id": item.id, "query": query, "results": results})
+		})
+	}
+	if len(item.stop) > 0 || item.opts.Temperature != nil || item.opts.MaxTokens != nil {
+		opts := ai.OptionsFrom(ctx)
+		if item.opts.Temperature != nil {
+			opts.Temperature = item.opts.Temperature
+		}
+		if item.opts.MaxTokens != nil {
+			opts.MaxTokens = item.opts.MaxTokens
+		}
+		if len(item.stop) > 0 {
+			opts.StopSequences = item.stop
+		}
+		ctx = ai.WithOptions(ctx, opts)
+	}
+
+	var dumpStream *dump.Stream
+	if s.srv.deps.Recorder != nil {
+		dumpStream = s.srv.deps.Recorder.Start(provider, ai.Transcript(history, prompt))
+	}
+
+	// speak the response in order; playback continues in the background after the stream
+	// ends, but a cancelled or disconnected stream also silences what it queued
+	speechCtx, stopSpeech := context.WithCancel(context.WithoutCancel(ctx))
+	detachSpeech := context.AfterFunc(ctx, stopSpeech)
+	speech := s.srv.deps.Speaker(speechCtx)
+	defer speech.Close()
+
+	// deliver sends a chunk to the client, once any pause is over (see pauseGate)
+	writeFailed := false
+	progress := s.srv.newProgress()
+	deliver := func(chunk string) {
+		if writeFailed {
+			return
+		}
+		// attempt to write; on failure or a stalled client cancel the stream
+		if err := s.writeText([]byte(chunk)); err != nil {
+			log.Printf("ws write error: %v", err)
+			writeFailed = true
+			cancel()
+			return
+		}
+		// non-blocking, ordered TTS for each chunk
+		speech.Write(chunk)
+		if chars, elapsed, ok := progress.add(chunk); ok {
+			s.writeJSON(map[string]any{"type": "progress", "id": item.id, "chars": chars, "elapsed_ms": elapsed.Milliseconds()})
+		}
+	}
+	endPause := s.pause.begin(ctx, deliver)
+
+	// handler called by ai.Stream for every chunk
+	var reply strings.Builder
+	chunks := 0
+	handler := func(chunk string) {
+		chunks++
+		if idem != nil {
+			idemChunks = append(idemChunks, chunk)
+		}
+		if ok, skipped := s.chunkLog.Allow(); ok {
+			log.Printf("ws: prompt %s chunk %d (+%d skipped): %s", item.id, chunks, skipped, redact.SafeString(chunk))
+		}
+		if session != "" {
+			reply.WriteString(chunk)
+		}
+		if dumpStream != nil {
+			dumpStream.Write(chunk)
+		}
+		s.pause.pass(ctx, chunk)
+	}
+
+	// With a stream buffer the provider may run that many chunks ahead of the client;
+	// otherwise every write blocks the provider directly. Memory stays bounded either way.
+	streamHandler, flush := ai.StreamHandler(handler), func() {}
+	if n := s.srv.deps.Config.StreamBuffer; n > 0 {
+		streamHandler, flush = ai.BufferedHandler(ctx, n, handler)
+	}
+
+	// call provider stream (this will block until provider completes or ctx is cancelled)
+	err := s.srv.deps.Stream(ctx, provider, prompt, streamHandler)
+	flush()
+	// a paused client gets the rest of the response, and the end frame, once it resumes
+	endPause()
+	if ctx.Err() == nil {
+		detachSpeech()
+	}
+	idemOK, idemReason = err == nil && !writeFailed, finishReason(res, err)
+	if dumpStream != nil {
+		dumpStream.Close(err)
+	}
+	log.Printf("ws: finished prompt %s (provider=%s, chunks=%d)", item.id, provider, chunks)
+	if res.Augmentation != ai.AugmentationNone {
+		log.Printf("ws: search augmentation %s (provider=%s)", res.Augmentation, provider)
+	}
+	if writeFailed {
+		return false
+	}
+	if s.srv.degrade(ctx, err, chunks) {
+		log.Printf("ai stream error, sending degraded response: %s", redact.Scrub(err.Error()))
+		deliver(s.srv.deps.Config.DegradedResponse)
+		if writeFailed {
+			return false
+		}
+		s.writeJSON(map[string]any{"type": "end", "id": item.id, "finish_reason": ai.FinishStop, "degraded": true})
+		if err := s.writeText([]byte("__end__")); err != nil {
+			log.Printf("ws write error on end marker: %v", err)
+			return false
+		}
+		return true
+	}
+	if err != nil {
+		log.Printf("ai stream error: %s", redact.Scrub(err.Error()))
+		// try to inform client about the error, then continue
+		code, _ := errorCode(err)
+		s.writeJSON(map[string]any{"type": "error", "code": code, "error": err.Error()})
+		s.writeJSON(map[string]any{"type": "end", "id": item.id, "finish_reason": finishReason(res, err), "error": err.Error()})
+		_ = s.writeText([]byte("__error__: " + err.Error()))
+		return true
+	}
+
+	// sources used by search augmentation, sent after the content and before the end marker
+	if s.srv.deps.Config.Citations && len(res.Citations) > 0 {
+		s.writeJSON(map[string]any{"type": "citations", "sources": res.Citations})
+	}
+
+	if session != "" {
+		store.Append(s.historyKey, conversation.Turn{User: item.prompt, Assistant: reply.String()})
+	}
+
+	if res.Truncated {
+		s.writeJSON(map[string]any{"type": "truncated", "chars": res.TruncatedChars})
+	}
+
+	// indicate stream end: a structured frame with the finish reason, then the legacy marker
+	s.writeJSON(map[string]any{"type": "end", "id": item.id, "finish_reason": finishReason(res, nil)})
+	if err := s.writeText([]byte("__end__")); err != nil {
+		log.Printf("ws write error on end marker: %v", err)
+		return false
+	}
+	return true
+}
+
+// claim takes ownership of the prompt's idempotency key, or answers the prompt from
+// the run that already owns it. handled reports that the prompt was answered (or
+// abandoned because ctx ended) and ok is false if writing to the client failed.
+// If the owning run fails, the key is claimed afresh. A key reused for another prompt
+// is answered with an idempotency_conflict error.
+func (s *wsSession) claim(ctx context.Context, item *queuedPrompt) (e *idempotencyEntry, handled, ok bool) {
+	scope := s.idempotencyScope(item)
+	for {
+		e, owner, err := s.srv.idempotency.begin(scope, item.prompt)
+		if err != nil {
+			log.Printf("ws: rejecting prompt %s: %v", item.id, err)
+			code, _ := errorCode(err)
+			s.writeJSON(map[string]any{"type": "error", "id": item.id, "code": code, "error": err.Error()})
+			s.writeJSON(map[string]any{"type": "end", "id": item.id, "finish_reason": ai.FinishError, "error": err.Error()})
+			_ = s.writeText([]byte("__error__: " + err.Error()))
+			return nil, true, true
+		}
+		if owner {
+			return e, false, true
+		}
+		if e.wait(ctx) {
+			log.Printf("ws: replaying prompt %s from idempotency key", item.id)
+			return nil, true, s.replay(item, e)
+		}
+		if ctx.Err() != nil {
+			return nil, true, true
+		}
+	}
+}
+
+// idempotencyScope is the store key for the prompt's idempotency key. A prompt sent
+// with its own API key is scoped to that key as well as to the connection.
+func (s *wsSession) idempotencyScope(item *queuedPrompt) string {
+	caller := s.caller
+	if item.apiKey != "" {
+		caller += "\x00key\x00" + item.apiKey
+	}
+	return idempotencyScope(caller, s.provider, item.idemKey)
+}
+
+// replay sends a stored response as if it had just been streamed, finish reason included.
+func (s *wsSession) replay(item *queuedPrompt, e *idempotencyEntry) bool {
+	s.writeJSON(map[string]any{"type": "replayed", "id": item.id, "idempotency_key": item.idemKey})
+	for _, c := range e.chunks {
+		if err := s.writeText([]byte(c)); err != nil {
+			log.Printf("ws write error: %v", err)
+			return false
+		}
+	}
+	s.writeJSON(map[string]any{"type": "end", "id": item.id, "finish_reason": e.reason})
+	if err := s.writeText([]byte("__end__")); err != nil {
+		log.Printf("ws write error on end marker: %v", err)
+		return false
+	}
+	return true
+}
+
+// writeText writes a text frame, serialising writers and applying the write timeout.
+func (s *wsSession) writeText(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return writeMessage(s.conn, s.srv.deps.Config.WriteTimeout, data)
+}
+
+// writeJSON writes a JSON control frame, logging rather than returning failures.
+func (s *wsSession) writeJSON(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("ws: marshal frame: %v", err)
+		return
+	}
+	if err := s.writeText(b); err != nil {
+		log.Printf("ws write error: %v", err)
+	}
+}
+
+// writeMessage writes a text frame, failing if the client doesn't accept it within timeout.
+func writeMessage(conn *websocket.Conn, timeout time.Duration, data []byte) error {
+	return writeFrame(conn, timeout, websocket.TextMessage, data)
+}
+
+// writeFrame writes a frame of the given type, failing if the client doesn't accept it
+// within timeout.
+func writeFrame(conn *websocket.Conn, timeout time.Duration, messageType int, data []byte) error {
+	if timeout > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	}
+	return conn.WriteMessage(messageType, data)
+}
@@ -0,0 +1,626 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"j-project/src/utils/ai"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSIdempotentReplayKeepsFinishReason(t *testing.T) {
+	var calls atomic.Int32
+	stream := func(ctx context.Context, provider, prompt string, handler ai.StreamHandler) error {
+		calls.Add(1)
+		handler("cut ")
+		handler("short")
+		ai.ResultFrom(ctx).FinishReason = ai.FinishLength
+		return nil
+	}
+	ts := newTestServer(t, Dependencies{Config: Config{IdempotencyTTL: time.Minute}, Stream: stream})
+	c := dialWS(t, ts, "/ws/ai", nil, nil)
+
+	prompt := map[string]any{"type": "prompt", "prompt": "hi", "idempotency_key": "k1"}
+	c.send(prompt)
+	first := c.readUntilEnd()
+	c.send(prompt)
+	second := c.readUntilEnd()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("provider called %d times, want 1", n)
+	}
+	if len(ofType(second, "replayed")) != 1 {
+		t.Fatalf("second response has no replayed frame: %+v", second)
+	}
+	want := []string{"cut ", "short", "__end__"}
+	for i, frames := range [][]frame{first, second} {
+		if got := texts(frames); !slices.Equal(got, want) {
+			t.Errorf("response %d text = %q, want %q", i, got, want)
+		}
+		ends := ofType(frames, "end")
+		if len(ends) != 1 || ends[0].JSON["finish_reason"] != string(ai.FinishLength) {
+			t.Errorf("response %d end frames = %+v, want one with finish_reason length", i, ends)
+		}
+		// the structured end frame comes right before the legacy marker
+		if n := len(frames); n < 2 || frames[n-2].typ() != "end" {
+			t.Errorf("response %d: end frame not right before __end__: %+v", i, frames)
+		}
+	}
+}
+
+func TestWSIdempotencyKeysAreScopedToCaller(t *testing.T) {
+	var calls atomic.Int32
+	stream := func(ctx context.Context, provider, prompt string, handler ai.StreamHandler) error {
+		calls.Add(1)
+		handler("answer to " + prompt)
+		return nil
+	}
+	ts := newTestServer(t, Dependencies{Config: Config{IdempotencyTTL: time.Minute}, Stream: stream})
+	bearer := func(token string) http.Header { return http.Header{"Authorization": {"Bearer " + token}} }
+	prompt := map[string]any{"type": "prompt", "prompt": "hi", "idempotency_key": "k1"}
+
+	alice := dialWS(t, ts, "/ws/ai", nil, bearer("alice"))
+	alice.send(prompt)
+	alice.readUntilEnd()
+
+	// the same caller reconnecting is answered from the first run
+	again := dialWS(t, ts, "/ws/ai", nil, bearer("alice"))
+	again.send(prompt)
+	if frames := again.readUntilEnd(); len(ofType(frames, "replayed")) != 1 {
+		t.Fatalf("reconnected caller wasn't replayed: %+v", frames)
+	}
+
+	// another caller with the same key gets its own run
+	bob := dialWS(t, ts, "/ws/ai", nil, bearer("bob"))
+	bob.send(prompt)
+	if frames := bob.readUntilEnd(); len(ofType(frames, "replayed")) != 0 {
+		t.Fatalf("another caller was replayed alice's response: %+v", frames)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("provider called %d times, want 2", n)
+	}
+
+	// reusing a key for a different prompt is refused
+	alice.send(map[string]any{"type": "prompt", "prompt": "something else", "idempotency_key": "k1"})
+	frames := alice.readUntilEnd()
+	errs := ofType(frames, "error")
+	if len(errs) != 1 || errs[0].JSON["code"] != "idempotency_conflict" {
+		t.Fatalf("reused key frames = %+v, want an idempotency_conflict error", frames)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("provider called for a conflicting prompt (%d calls)", n)
+	}
+}
+
+func TestWSStreamsChunksThenEnd(t *testing.T) {
+	provider := scripted(&ai.ScriptedProvider{Chunks: []string{"Hello", ", ", "world", "!"}})
+	ts := newTestServer(t, Dependencies{})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+
+	c.send("hi there")
+	frames := c.readUntilEnd()
+	if frames[0].typ() != "queued" || frames[0].JSON["position"] != float64(1) {
+		t.Fatalf("first frame = %+v, want queued at position 1", frames[0])
+	}
+	want := []string{"Hello", ", ", "world", "!", "__end__"}
+	if got := texts(frames); !slices.Equal(got, want) {
+		t.Fatalf("text frames = %q, want %q", got, want)
+	}
+	if end := frames[len(frames)-2]; end.typ() != "end" || end.JSON["finish_reason"] != "stop" || end.JSON["id"] != "1" {
+		t.Fatalf("frame before __end__ = %+v, want end with finish_reason stop", end)
+	}
+
+	// a plain prompt passed on the query string streams right after the upgrade
+	q := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}, "prompt": {"hi"}}, nil)
+	if got := texts(q.readUntilEnd()); !slices.Equal(got, want) {
+		t.Fatalf("?prompt= text frames = %q, want %q", got, want)
+	}
+}
+
+func TestWSEmptyPromptError(t *testing.T) {
+	ts := newTestServer(t, Dependencies{})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {"mock"}}, nil)
+
+	c.send(map[string]any{"type": "prompt", "id": "p1", "prompt": "   "})
+	frames := c.readUntilEnd()
+	errs := ofType(frames, "error")
+	if len(errs) != 1 || errs[0].JSON["code"] != "empty_prompt" {
+		t.Fatalf("error frames = %+v, want one empty_prompt", errs)
+	}
+	ends := ofType(frames, "end")
+	if len(ends) != 1 || ends[0].JSON["finish_reason"] != "error" || ends[0].JSON["id"] != "p1" {
+		t.Fatalf("end frames = %+v, want one for p1 with finish_reason error", ends)
+	}
+	if last := frames[len(frames)-1].Text; last != "__error__: empty prompt" {
+		t.Fatalf("last frame = %q, want the __error__ marker", last)
+	}
+}
+
+func TestWSCancel(t *testing.T) {
+	chunks := strings.Split(strings.Repeat("x", 50), "")
+	provider := scripted(&ai.ScriptedProvider{Chunks: chunks, Delay: 20 * time.Millisecond})
+	ts := newTestServer(t, Dependencies{})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+
+	c.send(map[string]any{"type": "cancel"})
+	if f := c.read(); f.typ() != "error" || f.JSON["error"] != "nothing to cancel" {
+		t.Fatalf("cancel with nothing running = %+v", f)
+	}
+
+	c.send(map[string]any{"type": "prompt", "id": "a", "prompt": "first"})
+	c.send(map[string]any{"type": "prompt", "id": "b", "prompt": "second"})
+	// wait for a to be streaming before cancelling b, still queued behind it, and then a
+	for {
+		if f := c.read(); f.JSON == nil {
+			break
+		}
+	}
+	c.send(map[string]any{"type": "cancel", "id": "b"})
+	c.send(map[string]any{"type": "cancel", "id": "a"})
+	frames := c.readUntilEnd()
+
+	if n := len(texts(frames)); n > 10 {
+		t.Errorf("%d chunks arrived after the cancel", n-1)
+	}
+	cancelled := ofType(frames, "cancelled")
+	if len(cancelled) != 1 || cancelled[0].JSON["id"] != "b" {
+		t.Errorf("cancelled frames = %+v, want one for the queued prompt b", cancelled)
+	}
+	errs := ofType(frames, "error")
+	if len(errs) != 1 || errs[0].JSON["code"] != "cancelled" {
+		t.Errorf("error frames = %+v, want one cancelled", errs)
+	}
+	ends := ofType(frames, "end")
+	if len(ends) != 1 || ends[0].JSON["id"] != "a" || ends[0].JSON["finish_reason"] != "error" {
+		t.Errorf("end frames = %+v, want one for a with finish_reason error", ends)
+	}
+	if last := frames[len(frames)-1].Text; !strings.HasPrefix(last, "__error__: ") {
+		t.Errorf("last frame = %q, want the __error__ marker", last)
+	}
+
+	// the connection is still usable, and b never runs
+	c.send(map[string]any{"type": "prompt", "id": "c", "prompt": "third"})
+	c.read() // queued
+	if f := c.read(); f.Text != "x" {
+		t.Fatalf("after cancel got %+v, want c's first chunk", f)
+	}
+}
+
+func TestWSPriorityJumpsTheQueue(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	stream := func(ctx context.Context, provider, prompt string, handler ai.StreamHandler) error {
+		if prompt == "running" {
+			close(started)
+			<-release
+		}
+		handler(prompt)
+		return nil
+	}
+	ts := newTestServer(t, Dependencies{Stream: stream})
+	c := dialWS(t, ts, "/ws/ai", nil, nil)
+
+	c.send(map[string]any{"type": "prompt", "id": "a", "prompt": "running"})
+	c.read() // queued
+	<-started
+	positions := map[string]any{}
+	for _, p := range []map[string]any{
+		{"type": "prompt", "id": "b", "prompt": "low one"},
+		{"type": "prompt", "id": "c", "prompt": "low two"},
+		{"type": "prompt", "id": "d", "prompt": "urgent", "priority": 5},
+	} {
+		c.send(p)
+		f := c.read()
+		if f.typ() != "queued" || f.JSON["id"] != p["id"] {
+			t.Fatalf("ack for %s = %s", p["id"], f.Text)
+		}
+		positions[p["id"].(string)] = f.JSON["position"]
+	}
+	if positions["b"] != 1.0 || positions["c"] != 2.0 || positions["d"] != 1.0 {
+		t.Fatalf("positions = %v, want b 1, c 2 and then d ahead of both at 1", positions)
+	}
+
+	close(release)
+	var ran []string
+	for range 4 {
+		for _, text := range texts(c.readUntilEnd()) {
+			if text != "__end__" {
+				ran = append(ran, text)
+			}
+		}
+	}
+	if want := []string{"running", "urgent", "low one", "low two"}; !slices.Equal(ran, want) {
+		t.Fatalf("ran %q, want %q", ran, want)
+	}
+}
+
+func TestWSSessionSendsHistoryAsMessages(t *testing.T) {
+	var seen [][]ai.Message
+	stream := func(ctx context.Context, provider, prompt string, handler ai.StreamHandler) error {
+		seen = append(seen, ai.MessagesFrom(ctx))
+		handler("re: " + prompt)
+		return nil
+	}
+	ts := newTestServer(t, Dependencies{Config: Config{ConversationTTL: time.Minute, ConversationTurns: 10}, Stream: stream})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"session": {"s1"}}, nil)
+
+	c.send("first")
+	c.readUntilEnd()
+	c.send("second")
+	c.readUntilEnd()
+	c.send(map[string]any{"type": "reset"})
+	if f := c.read(); f.typ() != "reset" {
+		t.Fatalf("reset reply = %+v", f)
+	}
+	c.send("third")
+	c.readUntilEnd()
+
+	want := []ai.Message{{Role: ai.RoleUser, Content: "first"}, {Role: ai.RoleAssistant, Content: "re: first"}}
+	if len(seen) != 3 || seen[0] != nil || !slices.Equal(seen[1], want) || seen[2] != nil {
+		t.Fatalf("history per prompt = %+v, want none, %+v, none", seen, want)
+	}
+}
+
+func TestWSSessionHistoryIsScopedToCaller(t *testing.T) {
+	var mu sync.Mutex
+	var lastHistory []ai.Message
+	stream := func(ctx context.Context, provider, prompt string, handler ai.StreamHandler) error {
+		mu.Lock()
+		lastHistory = ai.MessagesFrom(ctx)
+		mu.Unlock()
+		handler("ok")
+		return nil
+	}
+	historyLen := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(lastHistory)
+	}
+	ts := newTestServer(t, Dependencies{Config: Config{ConversationTTL: time.Minute}, Stream: stream})
+	session := url.Values{"session": {"shared"}}
+	bearer := func(token string) http.Header { return http.Header{"Authorization": {"Bearer " + token}} }
+	ask := func(c *wsClient) int {
+		c.send("hello")
+		c.readUntilEnd()
+		return historyLen()
+	}
+
+	alice := dialWS(t, ts, "/ws/ai", session, bearer("alice"))
+	ask(alice)
+	if n := ask(alice); n != 2 {
+		t.Fatalf("alice's second prompt had %d history messages, want 2", n)
+	}
+	// the same credentials pick the conversation up on a new connection
+	if n := ask(dialWS(t, ts, "/ws/ai", session, bearer("alice"))); n != 4 {
+		t.Fatalf("alice reconnected with %d history messages, want 4", n)
+	}
+	// other callers naming the same session start their own
+	if n := ask(dialWS(t, ts, "/ws/ai", session, bearer("mallory"))); n != 0 {
+		t.Fatalf("another caller saw %d of alice's messages", n)
+	}
+	if n := ask(dialWS(t, ts, "/ws/ai", session, nil)); n != 0 {
+		t.Fatalf("an anonymous caller saw %d of alice's messages", n)
+	}
+
+	// anonymous history belongs to its connection
+	anon := dialWS(t, ts, "/ws/ai", url.Values{"session": {"anon"}}, nil)
+	ask(anon)
+	if n := ask(anon); n != 2 {
+		t.Fatalf("anonymous connection's second prompt had %d history messages, want 2", n)
+	}
+	if n := ask(dialWS(t, ts, "/ws/ai", url.Values{"session": {"anon"}}, nil)); n != 0 {
+		t.Fatalf("a new anonymous connection saw %d messages of another's session", n)
+	}
+}
+
+func TestWSStalledClientIsDisconnected(t *testing.T) {
+	stopped := make(chan struct{})
+	big := strings.Repeat("x", 64<<10)
+	stream := func(ctx context.Context, provider, prompt string, handler ai.StreamHandler) error {
+		defer close(stopped)
+		for ctx.Err() == nil {
+			handler(big)
+		}
+		return ctx.Err()
+	}
+	ts := newTestServer(t, Dependencies{Config: Config{WriteTimeout: 100 * time.Millisecond}, Stream: stream})
+	c := dialWS(t, ts, "/ws/ai", nil, nil)
+
+	// the client sends a prompt and never reads, so the server's writes back up
+	c.send("flood me")
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the stream kept running against a client that stopped reading")
+	}
+
+	// the server dropped the connection: draining it ends in an error, not a frame
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, _, err := c.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			t.Fatal("connection still open after the write timeout")
+		}
+		break
+	}
+}
+
+func TestWSConnectionLimit(t *testing.T) {
+	ts := newTestServer(t, Dependencies{Config: Config{MaxConns: 2}})
+	wsConnections := func() float64 {
+		resp, err := http.Get(ts.URL + "/stats")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var stats map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+			t.Fatal(err)
+		}
+		return stats["ws_connections"].(float64)
+	}
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/ai"
+
+	first := dialWS(t, ts, "/ws/ai", nil, nil)
+	dialWS(t, ts, "/ws/ai", nil, nil)
+	if n := wsConnections(); n != 2 {
+		t.Fatalf("ws_connections = %v with two open, want 2", n)
+	}
+	_, resp, err := websocket.DefaultDialer.Dial(u, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("connection past the limit: err %v, response %+v; want a 503", err, resp)
+	}
+	if n := wsConnections(); n != 2 {
+		t.Fatalf("ws_connections = %v after a rejected upgrade, want 2", n)
+	}
+
+	// closing one frees its slot
+	first.conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for wsConnections() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("ws_connections never dropped after a client disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	dialWS(t, ts, "/ws/ai", nil, nil)
+}
+
+func TestWSSearchFrameBeforeAnswer(t *testing.T) {
+	provider := scripted(ai.NewSearchAugmentedProvider(&ai.ScriptedProvider{Chunks: []string{"The ", "answer"}}, "mock", ai.SearchFailProceed))
+	ts := newTestServer(t, Dependencies{})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+
+	c.send(map[string]any{"type": "prompt", "prompt": "what is go", "show_search": true})
+	frames := c.readUntilEnd()
+	search := -1
+	for i, f := range frames {
+		if f.typ() == "search" {
+			search = i
+			break
+		}
+		if f.JSON == nil {
+			t.Fatalf("text frame %q arrived before the search frame", f.Text)
+		}
+	}
+	if search < 0 {
+		t.Fatalf("no search frame in %+v", frames)
+	}
+	f := frames[search].JSON
+	results, _ := f["results"].([]any)
+	if f["query"] != "what is go" || len(results) != 1 || results[0] != "This is a mock search result for: what is go" {
+		t.Fatalf("search frame = %+v", f)
+	}
+	if got := texts(frames); !slices.Equal(got, []string{"The ", "answer", "__end__"}) {
+		t.Fatalf("text frames = %q", got)
+	}
+
+	// off unless the prompt or the config asks for it
+	c.send("what is go")
+	if frames := c.readUntilEnd(); len(ofType(frames, "search")) != 0 {
+		t.Fatalf("search frame sent without show_search: %+v", frames)
+	}
+	on := newTestServer(t, Dependencies{Config: Config{SearchFrames: true}})
+	c = dialWS(t, on, "/ws/ai", url.Values{"provider": {provider}}, nil)
+	c.send(map[string]any{"type": "prompt", "prompt": "what is go", "show_search": false})
+	if frames := c.readUntilEnd(); len(ofType(frames, "search")) != 0 {
+		t.Fatalf("search frame sent with show_search false: %+v", frames)
+	}
+}
+
+func TestWSOptionsMessage(t *testing.T) {
+	seen := make(chan ai.Options, 4)
+	stream := func(ctx context.Context, provider, prompt string, handler ai.StreamHandler) error {
+		seen <- ai.OptionsFrom(ctx)
+		handler("ok")
+		return nil
+	}
+	ts := newTestServer(t, Dependencies{Stream: stream})
+	c := dialWS(t, ts, "/ws/ai", nil, nil)
+	check := func(what string, temperature float64, maxTokens int) {
+		t.Helper()
+		o := <-seen
+		if o.Temperature == nil || *o.Temperature != temperature || o.MaxTokens == nil || *o.MaxTokens != maxTokens {
+			t.Fatalf("%s: options = %+v, want temperature %g and max_tokens %d", what, o, temperature, maxTokens)
+		}
+	}
+
+	c.send(map[string]any{"type": "options", "temperature": 0.2, "max_tokens": 512})
+	if f := c.read(); f.typ() != "options" || f.JSON["temperature"] != 0.2 || f.JSON["max_tokens"] != float64(512) {
+		t.Fatalf("options ack = %+v", f)
+	}
+	c.send("first")
+	c.readUntilEnd()
+	check("connection options", 0.2, 512)
+
+	// a prompt overrides them for itself only
+	c.send(map[string]any{"type": "prompt", "prompt": "second", "temperature": 0.9})
+	c.readUntilEnd()
+	check("prompt override", 0.9, 512)
+
+	for _, bad := range []map[string]any{{"temperature": 5}, {"max_tokens": 0}} {
+		bad["type"] = "options"
+		c.send(bad)
+		if f := c.read(); f.typ() != "error" || f.JSON["code"] != "invalid_options" {
+			t.Fatalf("options %v: reply %+v, want an invalid_options error", bad, f)
+		}
+	}
+	c.send("third")
+	c.readUntilEnd()
+	check("after rejected options", 0.2, 512)
+}
+
+// toolCallingProvider asks for one tool call mid-answer, the way a provider's tool loop
+// does, and then streams the tool's output.
+type toolCallingProvider struct{ call ai.ToolCall }
+
+func (p toolCallingProvider) Stream(ctx context.Context, prompt string, handler ai.StreamHandler) error {
+	handler("Let me check. ")
+	calls := ai.DispatchToolCalls(ctx, []ai.ToolCall{p.call})
+	handler("It says " + calls[0].Output + calls[0].Error)
+	return nil
+}
+
+func (toolCallingProvider) Capabilities() ai.Capabilities {
+	return ai.Capabilities{Streaming: true, Tools: true}
+}
+
+func TestWSToolFramesBracketResult(t *testing.T) {
+	ai.RegisterTool(ai.Tool{Name: "ws_test_lookup", Call: func(ctx context.Context, args json.RawMessage) (string, error) {
+		var a struct{ Q string }
+		json.Unmarshal(args, &a)
+		return "found " + a.Q, nil
+	}})
+	provider := scripted(toolCallingProvider{ai.ToolCall{ID: "c1", Name: "ws_test_lookup", Arguments: json.RawMessage(`{"q":"go"}`)}})
+	ts := newTestServer(t, Dependencies{})
+	c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+
+	c.send("look it up")
+	frames := c.readUntilEnd()
+	var order []string
+	for _, f := range frames {
+		switch {
+		case f.typ() == "tool_call":
+			if f.JSON["name"] != "ws_test_lookup" || f.JSON["args"].(map[string]any)["q"] != "go" {
+				t.Fatalf("tool_call frame = %+v", f.JSON)
+			}
+			order = append(order, "call")
+		case f.typ() == "tool_result":
+			if f.JSON["name"] != "ws_test_lookup" || f.JSON["result"] != "found go" || f.JSON["error"] != nil {
+				t.Fatalf("tool_result frame = %+v", f.JSON)
+			}
+			order = append(order, "result")
+		case f.JSON == nil:
+			order = append(order, f.Text)
+		}
+	}
+	want := []string{"Let me check. ", "call", "result", "It says found go", "__end__"}
+	if !slices.Equal(order, want) {
+		t.Fatalf("frames in order %q, want %q", order, want)
+	}
+
+	// a tool that isn't registered still gets both frames, with the error
+	provider = scripted(toolCallingProvider{ai.ToolCall{Name: "ws_test_missing", Arguments: json.RawMessage(`{}`)}})
+	c = dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+	c.send("look it up")
+	results := ofType(c.readUntilEnd(), "tool_result")
+	if len(results) != 1 || results[0].JSON["error"] == nil {
+		t.Fatalf("tool_result frames for an unknown tool = %+v", results)
+	}
+}
+
+func TestWSBusyPolicies(t *testing.T) {
+	provider := scripted(&ai.ScriptedProvider{Chunks: strings.Split(strings.Repeat("x", 20), ""), Delay: 10 * time.Millisecond})
+	for _, policy := range []BusyPolicy{BusyQueue, BusyReject, BusyReplace} {
+		t.Run(string(policy), func(t *testing.T) {
+			ts := newTestServer(t, Dependencies{Config: Config{BusyPolicy: policy}})
+			c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, nil)
+			c.send(map[string]any{"type": "prompt", "id": "a", "prompt": "first"})
+			// wait for a to be streaming, then send b
+			for {
+				if f := c.read(); f.JSON == nil {
+					break
+				}
+			}
+			c.send(map[string]any{"type": "prompt", "id": "b", "prompt": "second"})
+			first := c.readUntilEnd()
+			end := ofType(first, "end")
+			if len(end) != 1 || end[0].JSON["id"] != "a" {
+				t.Fatalf("frames = %+v, want a's end first", first)
+			}
+
+			switch policy {
+			case BusyQueue:
+				if q := ofType(first, "queued"); len(q) != 1 || q[0].JSON["id"] != "b" || q[0].JSON["position"] != float64(1) {
+					t.Fatalf("queued frames = %+v, want b queued behind a", q)
+				}
+				if end[0].JSON["error"] != nil || len(texts(first)) != 20 {
+					t.Fatalf("a = %+v, want it to finish with all 19 remaining chunks", first)
+				}
+			case BusyReject:
+				busy := ofType(first, "busy")
+				if len(busy) != 1 || busy[0].JSON["id"] != "b" || busy[0].JSON["running"] != "a" {
+					t.Fatalf("busy frames = %+v, want b rejected while a runs", busy)
+				}
+				// b never runs: the next reply is to a new message
+				c.send(map[string]any{"type": "info"})
+				if f := c.read(); f.typ() != "info" {
+					t.Fatalf("frame after a rejected prompt = %+v", f)
+				}
+				return
+			case BusyReplace:
+				if end[0].JSON["error"] == nil || len(texts(first)) >= 20 {
+					t.Fatalf("a = %+v, want it cut off by b", first)
+				}
+			}
+			second := c.readUntilEnd()
+			if end := ofType(second, "end"); len(end) != 1 || end[0].JSON["id"] != "b" || end[0].JSON["error"] != nil {
+				t.Fatalf("frames after a = %+v, want b to run to the end", second)
+			}
+		})
+	}
+}
+
+func TestWSDebugPromptFrame(t *testing.T) {
+	provider := scripted(ai.NewSearchAugmentedProvider(&ai.MockProvider{}, "mock", ai.SearchFailProceed))
+	prompt := map[string]any{"type": "prompt", "prompt": "what is go", "debug": true}
+	auth := http.Header{"Authorization": {"Bearer s3cret"}}
+	debugFrames := func(ts *httptest.Server, header http.Header) []frame {
+		t.Helper()
+		c := dialWS(t, ts, "/ws/ai", url.Values{"provider": {provider}}, header)
+		c.send(prompt)
+		return ofType(c.readUntilEnd(), "debug_prompt")
+	}
+
+	ts := newTestServer(t, Dependencies{Config: Config{DebugPrompts: true, AdminToken: "s3cret"}})
+	frames := debugFrames(ts, auth)
+	if len(frames) != 1 {
+		t.Fatalf("debug_prompt frames = %+v, want one", frames)
+	}
+	text, _ := frames[0].JSON["text"].(string)
+	if !strings.Contains(text, "[1] This is a mock search result for: what is go") || !strings.HasSuffix(text, "Question: what is go") {
+		t.Fatalf("debug prompt = %q, want the augmented prompt sent upstream", text)
+	}
+
+	// the frame needs both the config and, when there is one, the admin token
+	if frames := debugFrames(ts, nil); len(frames) != 0 {
+		t.Fatalf("debug_prompt sent without the admin token: %+v", frames)
+	}
+	if frames := debugFrames(newTestServer(t, Dependencies{Config: Config{AdminToken: "s3cret"}}), auth); len(frames) != 0 {
+		t.Fatalf("debug_prompt sent with DebugPrompts off: %+v", frames)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// startupTask is one piece of work run when the process starts.
+type startupTask struct {
+	name string
+	run  func(ctx context.Context) error
+	// fatal tasks are always waited for, even past the timeout, and their error stops
+	// the process; other failures are only logged
+	fatal bool
+}
+
+// runStartup runs tasks with at most limit in parallel and returns once they have all
+// finished or timeout has passed, whichever is first. Tasks still running at the
+// timeout, or when parent ends, see their context cancelled and finish in the
+// background. The returned error is the first failure of a fatal task.
+func runStartup(parent context.Context, tasks []startupTask, limit int, timeout time.Duration) error {
+	if limit < 1 {
+		limit = 1
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	sem := make(chan struct{}, limit)
+
+	var (
+		all, fatal sync.WaitGroup
+		mu         sync.Mutex
+		firstErr   error
+	)
+	for _, t := range tasks {
+		all.Add(1)
+		if t.fatal {
+			fatal.Add(1)
+		}
+		go func() {
+			defer all.Done()
+			if t.fatal {
+				defer fatal.Done()
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			err := t.run(ctx)
+			if err == nil {
+				log.Printf("startup: %s done in %s", t.name, time.Since(start).Round(time.Millisecond))
+				return
+			}
+			log.Printf("startup: %s failed after %s: %v", t.name, time.Since(start).Round(time.Millisecond), err)
+			if t.fatal {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		all.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			log.Printf("startup: cancelling remaining tasks: %v", context.Cause(parent))
+		} else {
+			log.Printf("startup: tasks still running after %s, giving up on them", timeout)
+		}
+	}
+	fatal.Wait()
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return firstErr
+}
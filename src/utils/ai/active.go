@@ -0,0 +1,50 @@
+package ai
+
+import (
+	"context"
+	"j-project/src/utils/metrics"
+	"sync"
+)
+
+var (
+	activeMu sync.Mutex
+	activeID uint64
+	active   = map[uint64]context.CancelFunc{}
+)
+
+// track registers a stream so CancelAll can stop it. The returned untrack must be
+// called when the stream ends.
+func track(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	activeMu.Lock()
+	activeID++
+	id := activeID
+	active[id] = cancel
+	metrics.Get().SetGauge(metrics.ActiveStreams, float64(len(active)))
+	activeMu.Unlock()
+	return ctx, func() {
+		activeMu.Lock()
+		delete(active, id)
+		metrics.Get().SetGauge(metrics.ActiveStreams, float64(len(active)))
+		activeMu.Unlock()
+		cancel()
+	}
+}
+
+// CancelAll cancels every in-flight stream started through Stream and returns how many
+// were cancelled. The streams return their context's error to their callers.
+func CancelAll() int {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	for _, cancel := range active {
+		cancel()
+	}
+	return len(active)
+}
+
+// ActiveStreams returns the number of streams currently in flight.
+func ActiveStreams() int {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	return len(active)
+}
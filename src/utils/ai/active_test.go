@@ -0,0 +1,46 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCancelAll(t *testing.T) {
+	gated := &gatedProvider{release: make(chan struct{})}
+	register(t, "cancel-all-test", gated)
+
+	errs := make(chan error, 3)
+	for range 3 {
+		go func() {
+			_, err := collect(t, context.Background(), "cancel-all-test", "hi")
+			errs <- err
+		}()
+	}
+	eventually(t, "three streams to start", func() bool { return gated.running.Load() == 3 })
+	if n := ActiveStreams(); n != 3 {
+		t.Fatalf("ActiveStreams = %d, want 3", n)
+	}
+
+	if n := CancelAll(); n != 3 {
+		t.Fatalf("CancelAll cancelled %d streams, want 3", n)
+	}
+	for range 3 {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("cancelled stream err = %v, want context.Canceled", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a stream kept running after CancelAll")
+		}
+	}
+	eventually(t, "the streams to be untracked", func() bool { return ActiveStreams() == 0 })
+
+	// streams started afterwards are unaffected
+	close(gated.release)
+	if chunks, err := collect(t, context.Background(), "cancel-all-test", "hi"); err != nil || joined(chunks) != "done" {
+		t.Fatalf("stream after CancelAll = %q, %v", joined(chunks), err)
+	}
+}
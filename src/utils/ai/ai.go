@@ -2,14 +2,22 @@ package ai
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"j-project/src/utils/events"
+	"j-project/src/utils/metrics"
+	"j-project/src/utils/redact"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -28,8 +36,14 @@ func RegisterWebSearcher(name string, ws WebSearcher) {
 }
 
 // SearchWeb performs a web search using the specified provider.
-// If providerName is empty or not found, it falls back to the mock provider.
+// If providerName is empty or not found, it falls back to the mock provider. Searches
+// are cancelled by Shutdown.
 func SearchWeb(ctx context.Context, providerName, query string) ([]string, error) {
+	if ShuttingDown() {
+		return nil, ErrShuttingDown
+	}
+	ctx, cancel := withShutdown(ctx)
+	defer cancel()
 	if providerName == "" {
 		providerName = "mock"
 	}
@@ -47,11 +61,39 @@ func (m *MockWebSearcher) Search(ctx context.Context, query string) ([]string, e
 }
 
 // DuckDuckGoWebSearcher implements WebSearcher using DuckDuckGo's Instant Answer API.
-type DuckDuckGoWebSearcher struct{}
+// The zero value searches without a region and with DuckDuckGo's default safe-search.
+type DuckDuckGoWebSearcher struct {
+	Region     string // region code sent as kl, e.g. "de-de" or "uk-en"
+	SafeSearch string // "strict", "moderate" or "off", sent as kp; empty uses the default
+}
+
+// NewDuckDuckGoWebSearcher creates a searcher for a region and safe-search level.
+func NewDuckDuckGoWebSearcher(region, safeSearch string) *DuckDuckGoWebSearcher {
+	return &DuckDuckGoWebSearcher{Region: region, SafeSearch: safeSearch}
+}
+
+// safeSearchParam maps a SafeSearch level to DuckDuckGo's kp value.
+func safeSearchParam(level string) string {
+	switch strings.ToLower(level) {
+	case "strict":
+		return "1"
+	case "moderate":
+		return "-1"
+	case "off":
+		return "-2"
+	}
+	return ""
+}
 
 func (d *DuckDuckGoWebSearcher) Search(ctx context.Context, query string) ([]string, error) {
 	// Use DuckDuckGo's Instant Answer API (no API key required)
 	endpoint := "https://api.duckduckgo.com/?q=" + url.QueryEscape(query) + "&format=json&no_redirect=1&no_html=1"
+	if d.Region != "" {
+		endpoint += "&kl=" + url.QueryEscape(d.Region)
+	}
+	if kp := safeSearchParam(d.SafeSearch); kp != "" {
+		endpoint += "&kp=" + kp
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -63,7 +105,7 @@ func (d *DuckDuckGoWebSearcher) Search(ctx context.Context, query string) ([]str
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return nil, errors.New("duckduckgo: bad status " + resp.Status + " body: " + string(data))
+		return nil, &SearchError{Searcher: "duckduckgo", StatusCode: resp.StatusCode, Msg: "bad status", Body: string(data)}
 	}
 	var result struct {
 		RelatedTopics []struct {
@@ -73,9 +115,17 @@ func (d *DuckDuckGoWebSearcher) Search(ctx context.Context, query string) ([]str
 		AbstractText string `json:"AbstractText"`
 		AbstractURL  string `json:"AbstractURL"`
 	}
+	// when rate limiting, DuckDuckGo may answer 200 with an HTML page instead of JSON
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == "text/html" {
+		return nil, &SearchError{Searcher: "duckduckgo", Msg: "got an HTML page instead of JSON", Err: ErrSearchBlocked}
+	}
 	dec := json.NewDecoder(resp.Body)
 	if err := dec.Decode(&result); err != nil {
-		return nil, err
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return nil, &SearchError{Searcher: "duckduckgo", Msg: "response is not JSON", Err: ErrSearchBlocked}
+		}
+		return nil, &SearchError{Searcher: "duckduckgo", Msg: "decode response", Err: err}
 	}
 	var out []string
 	if result.AbstractText != "" {
@@ -86,9 +136,7 @@ func (d *DuckDuckGoWebSearcher) Search(ctx context.Context, query string) ([]str
 			out = append(out, t.Text+" ("+t.FirstURL+")")
 		}
 	}
-	if len(out) == 0 {
-		out = append(out, "No results found.")
-	}
+	// an empty slice means "no results"; callers decide how to present that
 	return out, nil
 }
 
@@ -96,7 +144,8 @@ type StreamHandler func(chunk string)
 
 // Provider is an abstraction over different AI providers.
 // Implementations should call the handler for each chunk they receive
-// and return nil on normal completion or an error on failure.
+// and return nil on normal completion or an error on failure. Given a context that is
+// already done they return its error at once, without chunks or network calls.
 type Provider interface {
 	Stream(ctx context.Context, prompt string, handler StreamHandler) error
 }
@@ -110,27 +159,199 @@ func Register(name string, p Provider) {
 
 // Stream looks up a provider by name and streams the response using the handler.
 // If provider is not found it falls back to a built-in mock provider.
+// An empty name reuses the provider of the enclosing request (see WithProvider) and
+// otherwise uses DefaultProvider. AutoProvider lets the Router pick (see SetRouter).
 func Stream(ctx context.Context, providerName string, prompt string, handler StreamHandler) error {
+	// nothing to do for a caller that has already given up, not even routing
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx, untrack := track(ctx)
+	defer untrack()
+
 	if providerName == "" {
-		providerName = "mock"
+		providerName = ProviderFrom(ctx)
+	}
+	if providerName == "" {
+		providerName = DefaultProvider()
+	}
+	if providerName == AutoProvider {
+		routed, err := route(ctx, prompt)
+		if err != nil {
+			return err
+		}
+		providerName = routed
+	}
+	providerName, err := resolveAlias(providerName)
+	if err != nil {
+		return err
 	}
 	if p, ok := providers[providerName]; ok {
-		return p.Stream(ctx, prompt, handler)
+		ctx = WithProvider(ctx, providerName)
+		release, err := acquire(ctx, providerName)
+		if err != nil {
+			return err
+		}
+		defer release()
+		start := time.Now()
+		events.Publish(events.Event{Type: events.StreamStarted, Provider: providerName, RequestID: RequestIDFrom(ctx)})
+		breaker := breakerFor(providerName)
+		if err := breaker.Allow(); err != nil {
+			err = fmt.Errorf("provider %s: %w", providerName, err)
+			finishResult(ctx, err)
+			observeStream(ctx, providerName, start, err)
+			return err
+		}
+		streamCtx, streamHandler, recovered := withRecover(ctx, providerName, handler)
+		finishTrim := func() {}
+		if trimWhitespace(providerName) {
+			// after stripping, which may leave whitespace at the start
+			streamHandler, finishTrim = withTrim(streamHandler)
+		}
+		finishStrip := func() {}
+		if patterns, ok := stripPatterns(providerName); ok {
+			streamHandler, finishStrip = withStrip(patterns, streamHandler)
+		}
+		finishStops := func() bool { return false }
+		if stops := OptionsFrom(ctx).StopSequences; len(stops) > 0 {
+			streamCtx, streamHandler, finishStops = withStopSequences(streamCtx, stops, streamHandler)
+		}
+		stop := func() bool { return false }
+		if _, ok := ctx.Deadline(); !ok {
+			if d := providerTimeout(providerName); d > 0 {
+				streamCtx, streamHandler, stop = withInactivityTimeout(streamCtx, d, streamHandler)
+			}
+		}
+		// closest to the provider, so everything after it sees whole characters
+		streamHandler, flushRunes := withRuneBoundaries(streamHandler)
+		if n := chunkDedup(providerName); n > 0 {
+			// on the provider's own chunks, before anything re-splits them
+			streamHandler = withDedup(n, streamHandler)
+		}
+		callCtx, callPrompt := fitConversation(streamCtx, prompt)
+		err = p.Stream(callCtx, fitPrompt(callCtx, wrapPrompt(providerName, callPrompt)), streamHandler)
+		flushRunes()
+		stopped, timedOut := finishStops(), stop()
+		finishStrip()
+		finishTrim()
+		if perr := recovered(); perr != nil {
+			err = perr
+		} else if stopped {
+			// the stream was cut short on purpose; the cancellation is not a failure
+			err = nil
+		} else if timedOut {
+			err = fmt.Errorf("provider %s: %w after %s", providerName, ErrProviderTimeout, providerTimeout(providerName))
+		}
+		var pe *ProviderError
+		if errors.As(err, &pe) && pe.Provider == "" {
+			pe.Provider = providerName
+		}
+		// a caller cancelling its own context, sending an empty prompt or its handler
+		// panicking says nothing about the provider's health; no upstream call finished.
+		// Nor does a request made with the client's own key: one tenant's bad key must
+		// not open the breaker for everyone.
+		if ctx.Err() != nil || errors.Is(err, ErrHandlerPanic) || errors.Is(err, ErrEmptyPrompt) || apiKeyFrom(ctx) != "" {
+			breaker.Release()
+		} else {
+			breaker.Record(err != nil)
+		}
+		finishResult(ctx, err)
+		observeStream(ctx, providerName, start, err)
+		return err
 	}
 	// fallback
-	return (&MockProvider{}).Stream(ctx, prompt, handler)
+	ctx, handler, recovered := withRecover(ctx, "mock", handler)
+	ctx, prompt = fitConversation(ctx, prompt)
+	err = (&MockProvider{}).Stream(ctx, prompt, handler)
+	if perr := recovered(); perr != nil {
+		err = perr
+	}
+	finishResult(ctx, err)
+	return err
+}
+
+// observeStream reports one finished stream to the metrics sink and the event bus.
+func observeStream(ctx context.Context, provider string, start time.Time, err error) {
+	m := metrics.Get()
+	tag := metrics.Tag{Key: "provider", Value: provider}
+	m.IncrCounter(metrics.StreamsTotal, tag)
+	elapsed := time.Since(start)
+	e := events.Event{Type: events.StreamEnded, Provider: provider, RequestID: RequestIDFrom(ctx),
+		Fields: map[string]any{"duration_ms": elapsed.Milliseconds()}}
+	if err != nil {
+		m.IncrCounter(metrics.StreamErrorsTotal, tag)
+		e.Error = redact.Scrub(err.Error())
+	}
+	m.ObserveHistogram(metrics.StreamDuration, elapsed.Seconds(), tag)
+	events.Publish(e)
+}
+
+// mockMessagesReply answers a JSON messages array with "You said X; this is turn N.",
+// where N counts the user messages. ok is false for anything else.
+func mockMessagesReply(prompt string) (reply string, ok bool) {
+	trimmed := strings.TrimSpace(prompt)
+	if !strings.HasPrefix(trimmed, "[") {
+		return "", false
+	}
+	var messages []Message
+	if err := json.Unmarshal([]byte(trimmed), &messages); err != nil {
+		return "", false
+	}
+	return mockConversationReply(messages)
+}
+
+// mockConversationReply is mockMessagesReply for decoded messages.
+func mockConversationReply(messages []Message) (reply string, ok bool) {
+	turns, last := 0, ""
+	for _, m := range messages {
+		if m.Role == "user" {
+			turns++
+			last = m.Content
+		}
+	}
+	if turns == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("You said %s; this is turn %d.", last, turns), true
+}
+
+// Lookup returns the provider registered under name (after resolving aliases), or an
+// *UnknownProviderError, matching ErrProviderNotFound, that lists the known names and
+// suggests the closest one. Unlike Stream it never falls back to the mock provider.
+func Lookup(name string) (Provider, error) {
+	resolved, err := resolveAlias(name)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := providers[resolved]; ok {
+		return p, nil
+	}
+	return nil, unknownProvider(name)
 }
 
 // MockProvider returns simulated chunks useful for local testing.
+// A prompt that is a JSON array of {"role","content"} messages, or one sent with
+// history (see WithMessages), gets a reply quoting the last user message and the turn
+// count, for exercising multi-turn clients.
 type MockProvider struct{}
 
 func (m *MockProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if strings.TrimSpace(prompt) == "" {
-		return errors.New("empty prompt")
+		return ErrEmptyPrompt
 	}
+	observePrompt(ctx, prompt)
 	// simple chunking by words
 	words := strings.Fields(prompt)
-	if len(words) < 6 {
+	reply, ok := mockMessagesReply(prompt)
+	if history := MessagesFrom(ctx); len(history) > 0 {
+		reply, ok = mockConversationReply(append(slices.Clip(history), Message{Role: RoleUser, Content: prompt}))
+	}
+	if ok {
+		words = strings.Fields(reply)
+	} else if len(words) < 6 {
 		chunks := []string{"Hello,", "this is a mock AI reply.", "Replace with a real provider."}
 		for _, c := range chunks {
 			select {
@@ -162,14 +383,130 @@ func (m *MockProvider) Stream(ctx context.Context, prompt string, handler Stream
 	return nil
 }
 
+// ScriptedProvider replays a fixed list of chunks and then returns Err. It is a
+// deterministic stand-in for a real provider when exercising the handlers: unlike
+// MockProvider its output doesn't depend on the prompt. Each chunk is preceded by
+// Delay, during which a cancelled context ends the stream.
+type ScriptedProvider struct {
+	Chunks []string
+	Err    error
+	Delay  time.Duration
+}
+
+func (s *ScriptedProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, c := range s.Chunks {
+		if s.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.Delay):
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		handler(c)
+	}
+	return s.Err
+}
+
 // HTTPProvider is a simple, configurable provider that POSTs the prompt to an HTTP endpoint.
 // It supports both full-response and chunked streaming responses (line-delimited).
 type HTTPProvider struct {
 	Endpoint      string
-	ApiKeyEnv     string // environment variable name that holds the API key (optional)
+	ApiKeyEnv     string     // environment variable name that holds the API key (optional)
+	RequireAPIKey bool       // Validate reports a missing key instead of sending unauthenticated requests
+	Auth          AuthScheme // where the key goes; bearer auth by default
+	Defaults      Options    // generation options for fields a request leaves unset
 	Model         string
 	StreamEnabled bool
-	// optional extra headers can be added later
+	// PromptPrefix and PromptSuffix bracket the prompt before it is placed in the body,
+	// e.g. "[INST] " and " [/INST]" for Llama chat templates.
+	PromptPrefix string
+	PromptSuffix string
+	// BuildBody overrides the default {"prompt","model","stream"} request body (optional).
+	BuildBody BodyBuilder
+	// EncodeBody serialises the body (optional); by default it is sent as JSON. The
+	// content type it returns, if any, is sent instead of ContentType.
+	EncodeBody BodyEncoder
+	// ContentType is the request's Content-Type; empty means "application/json".
+	ContentType string
+	// Format selects how streamed lines are parsed and where generation options go.
+	// When empty it is guessed from the endpoint (see format); set it explicitly.
+	Format Format
+	// ParseLine extracts content from each streamed line (optional), overriding Format.
+	ParseLine LineParser
+	// NewParser builds a fresh LineParser for each stream (optional). Use it instead of
+	// ParseLine when parsing needs state across lines; it takes precedence.
+	NewParser func(ctx context.Context) LineParser
+	// Delimiter separates records in a streamed body; zero means '\n'. "\r\n" framing
+	// needs no setting since lines are trimmed; use e.g. 0x1e for record-separated streams.
+	Delimiter byte
+	// MaxLineLength bounds a single streamed record in bytes; zero uses
+	// DefaultMaxLineLength. A longer record fails the stream with ErrLineTooLong
+	// instead of being buffered without limit.
+	MaxLineLength int
+	// MaxResponseBytes bounds the body read when StreamEnabled is false; zero uses
+	// DefaultMaxResponseBytes. A larger body fails with ErrResponseTooLarge.
+	MaxResponseBytes int
+	// ErrorField names a JSON field (dot-separated path, e.g. "error") whose presence in a
+	// 200 response — the whole body, or any streamed line — means the upstream failed.
+	ErrorField string
+	// Charset is the response body's character encoding (e.g. "iso-8859-1"), for
+	// upstreams that declare it wrongly or not at all. Empty uses the charset of the
+	// Content-Type header and UTF-8 when there is none.
+	Charset string
+	// HealthEndpoint is fetched by CheckHealth (optional), e.g. Ollama's /api/tags.
+	HealthEndpoint string
+	// Client sends the requests (optional). By default all HTTPProviders share a pooled
+	// client with keep-alives, so repeated requests to an endpoint reuse connections.
+	// Deadlines come from the request context, so the client should not set a Timeout.
+	Client *http.Client
+	// RequestInterceptor, when set, runs after the request is built and before it is sent.
+	// It may modify the request (sign it, add headers); returning an error aborts it.
+	RequestInterceptor func(*http.Request) error
+	// ResumeAttempts retries a request whose connection fails or drops mid-stream, up to
+	// this many times. Zero (the default) disables it. A retry resends the same request
+	// and skips as much of the new output as was already delivered, which is only
+	// correct for deterministic upstreams (e.g. temperature 0 or a fixed seed), so a
+	// retry after more than ResumeMaxBytes of output is not attempted.
+	ResumeAttempts int
+	ResumeMaxBytes int
+	// Caps describes the endpoint's features for Capabilities; Streaming is always taken
+	// from StreamEnabled.
+	Caps Capabilities
+}
+
+// BodyBuilder builds the JSON request body for a prompt.
+type BodyBuilder func(h *HTTPProvider, prompt string) map[string]any
+
+// BodyEncoder serialises a request body and may name its content type.
+type BodyEncoder func(body map[string]any) (data []byte, contentType string, err error)
+
+// encodedBody is a serialised request body ready to send.
+type encodedBody struct {
+	data        []byte
+	contentType string
+}
+
+// LineParser extracts the content chunk from a single streamed line.
+// It returns done=true when the line marks the end of the stream and a non-nil
+// error if the line reports an upstream failure. An empty chunk is skipped.
+type LineParser func(line string) (chunk string, done bool, err error)
+
+// sharedHTTPClient is the pooled client used by HTTPProviders without their own Client.
+// There is no overall Timeout because streams are long-lived; contexts bound each request.
+var sharedHTTPClient = &http.Client{Transport: newPooledTransport()}
+
+// newPooledTransport returns a keep-alive transport sized for a few busy upstreams.
+func newPooledTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 100
+	t.MaxIdleConnsPerHost = 16
+	t.IdleConnTimeout = 90 * time.Second
+	return t
 }
 
 // NewHTTPProvider creates a configured HTTPProvider instance.
@@ -178,94 +515,288 @@ func NewHTTPProvider(endpoint, apiKeyEnv, model string, streamEnabled bool) *HTT
 }
 
 func (h *HTTPProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if strings.TrimSpace(h.Endpoint) == "" {
-		return errors.New("http provider: endpoint is empty")
+		return &ProviderError{Msg: "endpoint is empty"}
 	}
 
 	// build request body generically
-	body := map[string]any{"prompt": prompt}
-	if h.Model != "" {
-		body["model"] = h.Model
+	format := h.format()
+	prompt = h.PromptPrefix + prompt + h.PromptSuffix
+
+	var body map[string]any
+	if h.BuildBody != nil {
+		body = h.BuildBody(h, prompt)
+		if h.Caps.Messages {
+			prependHistory(body, MessagesFrom(ctx))
+		}
+	} else {
+		body = map[string]any{"prompt": prompt}
+		if h.Model != "" {
+			body["model"] = h.Model
+		}
+		if h.StreamEnabled {
+			body["stream"] = true
+		}
 	}
-	if h.StreamEnabled {
-		body["stream"] = true
+
+	optionsFormat := format
+	if format == FormatOllama && h.BuildBody != nil {
+		// a custom body builder decides its own layout; use top-level fields
+		optionsFormat = FormatRaw
 	}
+	applyOptions(body, OptionsFrom(ctx).withDefaults(h.Defaults), optionsFormat)
+	observePrompt(ctx, upstreamPrompt(body, prompt))
 
-	b, err := json.Marshal(body)
+	b, err := h.encode(body)
 	if err != nil {
 		return err
 	}
+	if h.ResumeAttempts > 0 {
+		return h.sendResumable(ctx, b, format, handler)
+	}
+	return h.send(ctx, b, format, handler)
+}
+
+// encode serialises body with EncodeBody or as JSON, and picks its content type.
+func (h *HTTPProvider) encode(body map[string]any) (encodedBody, error) {
+	var b encodedBody
+	var err error
+	if h.EncodeBody != nil {
+		b.data, b.contentType, err = h.EncodeBody(body)
+		if err != nil {
+			return b, &ProviderError{Msg: "encode request body", Err: err}
+		}
+	} else if b.data, err = json.Marshal(body); err != nil {
+		return b, err
+	}
+	if b.contentType == "" {
+		b.contentType = h.ContentType
+	}
+	if b.contentType == "" {
+		b.contentType = "application/json"
+	}
+	return b, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", h.Endpoint, strings.NewReader(string(b)))
+// send performs one request with an encoded body and streams the response to handler.
+func (h *HTTPProvider) send(ctx context.Context, b encodedBody, format Format, handler StreamHandler) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", h.Endpoint, bytes.NewReader(b.data))
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if h.ApiKeyEnv != "" {
+	req.Header.Set("Content-Type", b.contentType)
+	// a key supplied with the request is only used for it, so it isn't registered with
+	// redact like the long-lived ones; the places that could echo it scrub it instead
+	requestKey := apiKeyFrom(ctx)
+	if requestKey != "" {
+		h.Auth.apply(req, requestKey)
+	} else if h.ApiKeyEnv != "" {
 		if k := os.Getenv(h.ApiKeyEnv); k != "" {
-			req.Header.Set("Authorization", "Bearer "+k)
+			redact.RegisterSecret(k)
+			h.Auth.apply(req, k)
 		}
 	}
 
-	client := &http.Client{Timeout: 0}
+	if h.RequestInterceptor != nil {
+		if err := h.RequestInterceptor(req); err != nil {
+			return &ProviderError{Msg: "request interceptor", Err: err}
+		}
+	}
+
+	if DebugHTTP {
+		debugRequest(req, b.data, requestKey)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = sharedHTTPClient
+	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return &interruptedError{err}
 	}
 	defer resp.Body.Close()
 
+	// undo any Content-Encoding the upstream applied on its own
+	respBody, err := decodedBody(resp)
+	if err != nil {
+		return err
+	}
+	respBody = utf8Body(resp, respBody, h.Charset)
+	if DebugHTTP {
+		var logBody func()
+		respBody, logBody = debugBody(resp, respBody, requestKey)
+		defer logBody()
+	}
+
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		// attempt to read body for error details
-		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return errors.New("http provider: bad status " + resp.Status + " body: " + string(data))
+		data, _ := io.ReadAll(io.LimitReader(respBody, 4096))
+		return &ProviderError{StatusCode: resp.StatusCode, Msg: "bad status", Body: scrubKey(string(data), requestKey)}
 	}
 
 	if !h.StreamEnabled {
-		data, err := io.ReadAll(resp.Body)
+		limit := h.MaxResponseBytes
+		if limit <= 0 {
+			limit = DefaultMaxResponseBytes
+		}
+		data, err := io.ReadAll(io.LimitReader(respBody, int64(limit)+1))
 		if err != nil {
 			return err
 		}
+		if len(data) > limit {
+			return &ProviderError{Msg: fmt.Sprintf("response over %d bytes", limit), Err: ErrResponseTooLarge}
+		}
+		if err := bodyError(data, h.ErrorField); err != nil {
+			return err
+		}
 		handler(string(data))
 		return nil
 	}
 
-	// stream: read line-delimited/chunked body and call handler for each non-empty line
-	reader := bufio.NewReader(resp.Body)
-	isOllama := strings.Contains(strings.ToLower(h.Endpoint), "ollama") || strings.Contains(strings.ToLower(h.Endpoint), "11434")
+	parse := h.ParseLine
+	var finish func()
+	switch {
+	case h.NewParser != nil:
+		parse = h.NewParser(ctx)
+	case parse != nil:
+	case format == FormatOpenAISSE:
+		parse, finish = newChatCompletionsParser(ctx)
+	case format == FormatOpenAIResponses:
+		parse = newResponsesParser(ctx)
+	case format == FormatNDJSON:
+		parse = parseNDJSONLine
+	}
+
+	delim := h.Delimiter
+	if delim == 0 {
+		delim = '\n'
+	}
+
+	maxLine := h.MaxLineLength
+	if maxLine <= 0 {
+		maxLine = DefaultMaxLineLength
+	}
+
+	// stream: read delimited/chunked body and call handler for each non-empty record
+	reader := bufio.NewReader(respBody)
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
-		line, err := reader.ReadString('\n')
+		line, err := readRecord(reader, delim, maxLine)
+		line = strings.TrimSuffix(line, string(delim))
+		if errors.Is(err, ErrLineTooLong) {
+			return &ProviderError{Msg: fmt.Sprintf("stream record over %d bytes", maxLine), Err: err}
+		}
 		if err != nil {
 			if err == io.EOF {
-				return nil
+				// a final line without a trailing newline still counts, and the parser
+				// gets to act on anything it was holding back for a terminator
+				done, err := h.handleLine(ctx, line, parse, format, handler)
+				if err == nil && !done && finish != nil {
+					finish()
+				}
+				return err
 			}
-			log.Printf("http provider: stream read error: %v", err)
+			log.Printf("http provider: stream read error: %s", redact.Scrub(err.Error()))
+			return &interruptedError{err}
+		}
+		done, err := h.handleLine(ctx, line, parse, format, handler)
+		if err != nil || done {
 			return err
 		}
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	}
+}
+
+// DefaultMaxLineLength is the longest streamed record HTTPProvider accepts when its
+// MaxLineLength is unset. Real streaming records are small; this only catches whole
+// responses sent without delimiters.
+var DefaultMaxLineLength = 1 << 20
+
+// DefaultMaxResponseBytes is the largest non-streamed body HTTPProvider reads when its
+// MaxResponseBytes is unset.
+var DefaultMaxResponseBytes = 16 << 20
+
+// readRecord reads up to and including delim, failing with ErrLineTooLong once the
+// record exceeds limit bytes. At EOF it returns the partial record and io.EOF.
+func readRecord(r *bufio.Reader, delim byte, limit int) (string, error) {
+	var buf []byte
+	for {
+		frag, err := r.ReadSlice(delim)
+		if len(buf)+len(frag) > limit {
+			return "", ErrLineTooLong
+		}
+		buf = append(buf, frag...)
+		if err != bufio.ErrBufferFull {
+			return string(buf), err
+		}
+	}
+}
+
+// handleLine extracts the content of one streamed line and passes it to handler.
+// It reports done when the line marks the end of the stream.
+func (h *HTTPProvider) handleLine(ctx context.Context, line string, parse LineParser, format Format, handler StreamHandler) (bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false, nil
+	}
+	if h.ErrorField != "" {
+		data, _ := strings.CutPrefix(line, "data:")
+		if err := bodyError([]byte(data), h.ErrorField); err != nil {
+			return false, err
 		}
-		if isOllama {
-			// Try to parse as JSON and extract 'response' field
-			var chunk struct {
-				Response string `json:"response"`
+	}
+	if parse != nil {
+		chunk, done, err := parse(line)
+		if err != nil {
+			return false, err
+		}
+		if chunk != "" {
+			handler(chunk)
+		}
+		return done, nil
+	} else if format == FormatOllama {
+		// Try to parse as JSON and extract 'response' field; thinking models put their
+		// reasoning in 'thinking'
+		var chunk struct {
+			Response   string `json:"response"`
+			Thinking   string `json:"thinking"`
+			DoneReason string `json:"done_reason"`
+		}
+		if err := json.Unmarshal([]byte(line), &chunk); err == nil {
+			emitReasoning(ctx, chunk.Thinking)
+			if chunk.DoneReason != "" {
+				setFinishReason(ctx, chunk.DoneReason)
 			}
-			if err := json.Unmarshal([]byte(line), &chunk); err == nil && chunk.Response != "" {
+			if chunk.Response != "" {
 				handler(chunk.Response)
 			}
-			// else ignore or log parse errors
-		} else {
-			handler(line)
 		}
+		// else ignore or log parse errors
+	} else {
+		handler(line)
 	}
+	return false, nil
 }
 
 func init() {
+	// circuit breaker defaults; BREAKER_THRESHOLD=0 disables breaking
+	if n, err := strconv.Atoi(os.Getenv("BREAKER_THRESHOLD")); err == nil {
+		BreakerThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("BREAKER_COOLDOWN")); err == nil {
+		BreakerCooldown = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("PROVIDER_TIMEOUT")); err == nil {
+		DefaultProviderTimeout = d
+	}
+
 	// register builtin mock provider
 	Register("mock", &MockProvider{})
 
@@ -280,9 +811,111 @@ func init() {
 	}
 	ollamaApiKeyEnv := "OLLAMA_API_KEY"
 	ollama := NewHTTPProvider(ollamaEndpoint, ollamaApiKeyEnv, ollamaModel, true)
+	ollama.Format = FormatOllama
+	ollama.ResumeAttempts, _ = strconv.Atoi(os.Getenv("OLLAMA_RESUME_ATTEMPTS"))
+	ollama.ErrorField = "error" // Ollama reports mid-stream failures as {"error":"..."}
+	ollama.Caps = Capabilities{JSONMode: true}
+	ollama.Defaults = optionsFromEnv("OLLAMA")
+	ollama.HealthEndpoint = os.Getenv("OLLAMA_HEALTH_ENDPOINT")
 	Register("ollama", ollama)
 
+	// OLLAMA_REPLICAS (comma-separated endpoints) registers ollama-1, ollama-2, ... with
+	// the settings above and an ollama-lb provider balancing over them per LB_POLICY
+	if endpoints := splitList(os.Getenv("OLLAMA_REPLICAS")); len(endpoints) > 0 {
+		names := make([]string, len(endpoints))
+		for i, endpoint := range endpoints {
+			replica := *ollama
+			replica.Endpoint = endpoint
+			names[i] = "ollama-" + strconv.Itoa(i+1)
+			Register(names[i], &replica)
+		}
+		Register("ollama-lb", NewLoadBalancedProvider(ParseBalancePolicy(os.Getenv("LB_POLICY")), names...))
+	}
+
+	// Register OpenAI over the Responses API when OPENAI_API_KEY is set
+	if os.Getenv("OPENAI_API_KEY") != "" {
+		endpoint := os.Getenv("OPENAI_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "https://api.openai.com/v1/responses"
+		}
+		model := os.Getenv("OPENAI_MODEL")
+		if model == "" {
+			model = "gpt-4o-mini"
+		}
+		openai := NewOpenAIResponsesProvider(endpoint, model)
+		openai.Defaults = optionsFromEnv("OPENAI")
+		Register("openai", openai)
+	}
+
+	// Register Jetify when JETIFY_ENDPOINT points at its chat completions API
+	if jetify, ok := jetifyFromEnv(); ok {
+		Register("jetify", jetify)
+	}
+
 	// register DuckDuckGo web search provider
-	RegisterWebSearcher("duckduckgo", &DuckDuckGoWebSearcher{})
+	RegisterWebSearcher("duckduckgo", ChainSearch(
+		NewDuckDuckGoWebSearcher(os.Getenv("DDG_REGION"), os.Getenv("DDG_SAFE_SEARCH")),
+		LoggingSearchMiddleware("duckduckgo"),
+		TimeoutSearchMiddleware(10*time.Second),
+	))
 	RegisterWebSearcher("mock", &MockWebSearcher{})
+
+	// Register a search-augmented Ollama provider. SEARCH_FAIL_MODE selects whether a
+	// failing search aborts the stream ("abort") or proceeds without context ("proceed").
+	searcher := os.Getenv("SEARCH_PROVIDER")
+	if searcher == "" {
+		searcher = "duckduckgo"
+	}
+	searchProvider := NewSearchAugmentedProvider(ollama, searcher, ParseSearchFailureMode(os.Getenv("SEARCH_FAIL_MODE")))
+	searchProvider.NoResultsNote = os.Getenv("SEARCH_NO_RESULTS_NOTE") == "true"
+	searchProvider.SearchTimeout = 3 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("SEARCH_TIMEOUT")); err == nil {
+		searchProvider.SearchTimeout = d
+	}
+	searchProvider.InjectResults, _ = strconv.Atoi(os.Getenv("SEARCH_INJECT_RESULTS"))
+	searchProvider.DisplayResults, _ = strconv.Atoi(os.Getenv("SEARCH_DISPLAY_RESULTS"))
+	Register("ollama-search", searchProvider)
+
+	// Register a retrieval-augmented Ollama provider over the documents in RAG_DOCS_DIR.
+	if dir := os.Getenv("RAG_DOCS_DIR"); dir != "" {
+		r, err := LoadKeywordRetriever(dir)
+		if err != nil {
+			log.Printf("rag: load %s: %v", dir, err)
+		} else {
+			k, _ := strconv.Atoi(os.Getenv("RAG_TOP_K"))
+			Register("ollama-rag", NewRAGProvider(ollama, r, k))
+		}
+	}
+
+	// Register a fallback chain over FALLBACK_PROVIDERS (comma-separated) sharing a
+	// FALLBACK_BUDGET time budget, with FALLBACK_RETRIES extra attempts per provider.
+	if names := splitList(os.Getenv("FALLBACK_PROVIDERS")); len(names) > 0 {
+		budget, _ := time.ParseDuration(os.Getenv("FALLBACK_BUDGET"))
+		retries, _ := strconv.Atoi(os.Getenv("FALLBACK_RETRIES"))
+		fb := NewFallbackProvider(budget, retries, names...)
+		fb.MaxAttempts, _ = strconv.Atoi(os.Getenv("FALLBACK_MAX_ATTEMPTS"))
+		Register("fallback", fb)
+	}
+
+	// extra HTTP providers from the JSON file at PROVIDERS_CONFIG, before the
+	// per-provider settings below so those apply to them too
+	providersFromConfig()
+
+	// per-provider concurrency limits from PROVIDER_CONCURRENCY_<NAME>
+	concurrencyFromEnv()
+	// per-provider prompt wrapping from PROMPT_PREFIX_<NAME> / PROMPT_SUFFIX_<NAME>
+	promptWrapsFromEnv()
+	stripPatternsFromEnv()
+	authSchemesFromEnv()
+	dedupFromEnv()
+	trimFromEnv()
+	// per-provider prompt budgets from PROMPT_BUDGET_<NAME>
+	promptBudgetsFromEnv()
+	tokenizersFromEnv()
+	// logical provider names from PROVIDER_ALIAS_<ALIAS>
+	aliasesFromEnv()
+	// provider for requests that name none, from DEFAULT_PROVIDER
+	defaultProviderFromEnv()
+	routerFromEnv()
+	chaosFromEnv()
 }
@@ -0,0 +1,224 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// rawProvider is a streaming FormatRaw HTTPProvider for endpoint, registered as name.
+func rawProvider(t *testing.T, name, endpoint string) *HTTPProvider {
+	t.Helper()
+	h := NewHTTPProvider(endpoint, "", "", true)
+	h.Format = FormatRaw
+	register(t, name, h)
+	return h
+}
+
+func TestRequestInterceptor(t *testing.T) {
+	var tenant atomic.Value
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		tenant.Store(r.Header.Get("X-Tenant"))
+		fmt.Fprintln(w, "ok")
+	}))
+	defer upstream.Close()
+	h := rawProvider(t, "intercept-test", upstream.URL)
+
+	h.RequestInterceptor = func(req *http.Request) error {
+		if req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("interceptor ran before the request was built: %v", req.Header)
+		}
+		req.Header.Set("X-Tenant", "acme")
+		return nil
+	}
+	if chunks, err := collect(t, context.Background(), "intercept-test", "hi"); err != nil || joined(chunks) != "ok" {
+		t.Fatalf("stream = %q, %v", joined(chunks), err)
+	}
+	if got := tenant.Load(); got != "acme" {
+		t.Fatalf("upstream saw X-Tenant %q, want the interceptor's header", got)
+	}
+
+	errDenied := errors.New("denied")
+	h.RequestInterceptor = func(*http.Request) error { return errDenied }
+	_, err := collect(t, context.Background(), "intercept-test", "hi")
+	var pe *ProviderError
+	if !errors.Is(err, errDenied) || !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want a ProviderError wrapping the interceptor's error", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("upstream hit %d times, want the aborted request never sent", n)
+	}
+}
+
+func TestStreamDelimiter(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// record-separated JSON, with newlines inside the records' content
+		fmt.Fprint(w, "{\"text\":\"line one\\n\"}\x1e{\"text\":\"line two\"}\x1e{\"text\":\"!\"}")
+	}))
+	defer upstream.Close()
+	h := rawProvider(t, "delim-test", upstream.URL)
+	h.Format = FormatNDJSON
+	h.Delimiter = 0x1e
+
+	chunks, err := collect(t, context.Background(), "delim-test", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"line one\n", "line two", "!"}; !slices.Equal(chunks, want) {
+		t.Fatalf("chunks = %q, want %q", chunks, want)
+	}
+}
+
+func TestStreamCRLFLines(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{\"response\":\"a\"}\r\n{\"response\":\"b\"}\r\n")
+	}))
+	defer upstream.Close()
+	rawProvider(t, "crlf-test", upstream.URL).Format = FormatNDJSON
+
+	if chunks, err := collect(t, context.Background(), "crlf-test", "hi"); err != nil || !slices.Equal(chunks, []string{"a", "b"}) {
+		t.Fatalf("chunks = %q, %v; want the default delimiter to handle \\r\\n", chunks, err)
+	}
+}
+
+func TestStreamLineTooLong(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "short")
+		// a whole response without a single newline
+		fmt.Fprint(w, strings.Repeat("x", 10<<10))
+	}))
+	defer upstream.Close()
+	h := rawProvider(t, "long-line-test", upstream.URL)
+	h.MaxLineLength = 1 << 10
+
+	chunks, err := collect(t, context.Background(), "long-line-test", "hi")
+	var pe *ProviderError
+	if !errors.Is(err, ErrLineTooLong) || !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want a ProviderError wrapping ErrLineTooLong", err)
+	}
+	if joined(chunks) != "short" {
+		t.Fatalf("chunks = %q, want only the line before the oversized one", joined(chunks))
+	}
+
+	// the same line within the limit is fine
+	h.MaxLineLength = 20 << 10
+	if _, err := collect(t, context.Background(), "long-line-test", "hi"); err != nil {
+		t.Fatalf("line within the limit: %v", err)
+	}
+}
+
+func TestMockProviderMessagesPrompt(t *testing.T) {
+	mock := &MockProvider{}
+	stream := func(prompt string) string {
+		t.Helper()
+		var chunks []string
+		if err := mock.Stream(context.Background(), prompt, func(c string) { chunks = append(chunks, c) }); err != nil {
+			t.Fatal(err)
+		}
+		// the mock sends groups of words without the space between them
+		return strings.Join(chunks, " ")
+	}
+
+	messages := `[{"role":"system","content":"be brief"},{"role":"user","content":"hi"},` +
+		`{"role":"assistant","content":"hello"},{"role":"user","content":"how are you"}]`
+	if got, want := stream(messages), "You said how are you; this is turn 2."; got != want {
+		t.Fatalf("reply to a messages array = %q, want %q", got, want)
+	}
+	// anything else is echoed back as before
+	text := "[not a messages array] but plain text to echo"
+	if got := stream(text); got != text {
+		t.Fatalf("reply to plain text = %q, want it echoed", got)
+	}
+}
+
+func TestRequestContentType(t *testing.T) {
+	type request struct{ contentType, body string }
+	got := make(chan request, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got <- request{r.Header.Get("Content-Type"), string(b)}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer upstream.Close()
+	h := rawProvider(t, "content-type-test", upstream.URL)
+	h.Model = "m"
+
+	plain := func(body map[string]any) ([]byte, string, error) { return []byte("custom"), "", nil }
+	tests := []struct {
+		name        string
+		contentType string
+		encode      BodyEncoder
+		want        string
+		form        bool
+	}{
+		{"default", "", nil, "application/json", false},
+		{"configured", "application/vnd.gateway+json", nil, "application/vnd.gateway+json", false},
+		{"encoder decides", "text/plain", FormBodyEncoder, "application/x-www-form-urlencoded", true},
+		{"encoder without a type", "text/plain", plain, "text/plain", false},
+	}
+	for _, tt := range tests {
+		h.ContentType, h.EncodeBody = tt.contentType, tt.encode
+		if _, err := collect(t, context.Background(), "content-type-test", "hi there"); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		r := <-got
+		if r.contentType != tt.want {
+			t.Errorf("%s: Content-Type %q, want %q", tt.name, r.contentType, tt.want)
+		}
+		if tt.form {
+			form, err := url.ParseQuery(r.body)
+			if err != nil || form.Get("prompt") != "hi there" || form.Get("model") != "m" || form.Get("stream") != "true" {
+				t.Errorf("form body %q, want the prompt, model and stream as fields", r.body)
+			}
+		}
+	}
+
+	h.EncodeBody = func(map[string]any) ([]byte, string, error) { return nil, "", errors.New("unencodable") }
+	var pe *ProviderError
+	if _, err := collect(t, context.Background(), "content-type-test", "hi"); !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want a ProviderError for a failed encoding", err)
+	}
+}
+
+func TestNonStreamingResponseLimit(t *testing.T) {
+	var size atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", int(size.Load())))
+	}))
+	defer upstream.Close()
+	h := rawProvider(t, "limit-test", upstream.URL)
+	h.StreamEnabled = false
+	h.MaxResponseBytes = 1 << 10
+
+	size.Store(1 << 20)
+	chunks, err := collect(t, context.Background(), "limit-test", "hi")
+	var pe *ProviderError
+	if !errors.Is(err, ErrResponseTooLarge) || !errors.As(err, &pe) || len(chunks) != 0 {
+		t.Fatalf("oversized body: %d chunks, err %v; want ErrResponseTooLarge and no output", len(chunks), err)
+	}
+
+	// a body of exactly the limit is fine
+	size.Store(1 << 10)
+	if chunks, err := collect(t, context.Background(), "limit-test", "hi"); err != nil || len(joined(chunks)) != 1<<10 {
+		t.Fatalf("body at the limit: %d bytes, %v", len(joined(chunks)), err)
+	}
+
+	// without a limit of its own the provider uses DefaultMaxResponseBytes
+	prev := DefaultMaxResponseBytes
+	DefaultMaxResponseBytes = 100
+	t.Cleanup(func() { DefaultMaxResponseBytes = prev })
+	h.MaxResponseBytes = 0
+	if _, err := collect(t, context.Background(), "limit-test", "hi"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("err = %v, want DefaultMaxResponseBytes applied", err)
+	}
+}
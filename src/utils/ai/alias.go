@@ -0,0 +1,74 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrAliasCycle is returned when provider aliases refer to each other in a loop.
+var ErrAliasCycle = errors.New("provider alias cycle")
+
+var (
+	aliasesMu sync.RWMutex
+	aliases   = map[string]string{}
+)
+
+// RegisterAlias makes alias (e.g. "fast") refer to target, which may be a provider or
+// another alias. Aliases are resolved before provider lookup, so they also shadow a
+// provider of the same name. An empty target removes the alias.
+func RegisterAlias(alias, target string) {
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+	if target == "" {
+		delete(aliases, alias)
+		return
+	}
+	aliases[alias] = target
+}
+
+// Aliases returns a copy of the alias table.
+func Aliases() map[string]string {
+	aliasesMu.RLock()
+	defer aliasesMu.RUnlock()
+	out := make(map[string]string, len(aliases))
+	for k, v := range aliases {
+		out[k] = v
+	}
+	return out
+}
+
+// resolveAlias follows aliases from name to a non-alias name.
+func resolveAlias(name string) (string, error) {
+	aliasesMu.RLock()
+	defer aliasesMu.RUnlock()
+	seen := []string{name}
+	for {
+		target, ok := aliases[name]
+		if !ok {
+			return name, nil
+		}
+		for _, s := range seen {
+			if s == target {
+				return "", fmt.Errorf("%w: %s -> %s", ErrAliasCycle, strings.Join(seen, " -> "), target)
+			}
+		}
+		seen = append(seen, target)
+		name = target
+	}
+}
+
+// aliasesFromEnv registers PROVIDER_ALIAS_<ALIAS>=<target>, e.g. PROVIDER_ALIAS_FAST=ollama
+// makes "fast" refer to ollama. Underscores in the alias become dashes.
+func aliasesFromEnv() {
+	for _, kv := range os.Environ() {
+		key, target, _ := strings.Cut(kv, "=")
+		alias, ok := strings.CutPrefix(key, "PROVIDER_ALIAS_")
+		if !ok || alias == "" || target == "" {
+			continue
+		}
+		RegisterAlias(strings.ToLower(strings.ReplaceAll(alias, "_", "-")), target)
+	}
+}
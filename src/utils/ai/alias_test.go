@@ -0,0 +1,60 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// withAlias makes alias refer to target for the duration of the test.
+func withAlias(t *testing.T, alias, target string) {
+	t.Helper()
+	RegisterAlias(alias, target)
+	t.Cleanup(func() { RegisterAlias(alias, "") })
+}
+
+func TestAliasResolution(t *testing.T) {
+	register(t, "alias-backend", &ScriptedProvider{Chunks: []string{"from backend"}})
+	withAlias(t, "smart", "alias-backend")
+	withAlias(t, "default-test", "smart")
+
+	if got, err := resolveAlias("default-test"); err != nil || got != "alias-backend" {
+		t.Fatalf("resolveAlias = %q, %v; want the chain followed to alias-backend", got, err)
+	}
+	if got, _ := resolveAlias("alias-backend"); got != "alias-backend" {
+		t.Fatalf("resolveAlias of a provider name = %q", got)
+	}
+	if chunks, err := collect(t, context.Background(), "default-test", "hi"); err != nil || joined(chunks) != "from backend" {
+		t.Fatalf("stream through the alias = %q, %v", joined(chunks), err)
+	}
+
+	// repointing the alias switches what backs it
+	register(t, "alias-other", &ScriptedProvider{Chunks: []string{"from other"}})
+	withAlias(t, "smart", "alias-other")
+	if chunks, _ := collect(t, context.Background(), "default-test", "hi"); joined(chunks) != "from other" {
+		t.Fatalf("stream after repointing = %q", joined(chunks))
+	}
+}
+
+func TestAliasCycle(t *testing.T) {
+	withAlias(t, "cycle-a", "cycle-b")
+	withAlias(t, "cycle-b", "cycle-c")
+	withAlias(t, "cycle-c", "cycle-a")
+
+	_, err := resolveAlias("cycle-a")
+	if !errors.Is(err, ErrAliasCycle) || err.Error() != "provider alias cycle: cycle-a -> cycle-b -> cycle-c -> cycle-a" {
+		t.Fatalf("resolveAlias = %v, want the cycle reported", err)
+	}
+	if _, err := Lookup("cycle-b"); !errors.Is(err, ErrAliasCycle) {
+		t.Fatalf("Lookup = %v, want ErrAliasCycle", err)
+	}
+}
+
+func TestAliasesFromEnv(t *testing.T) {
+	t.Setenv("PROVIDER_ALIAS_FAST_LANE", "mock")
+	t.Cleanup(func() { RegisterAlias("fast-lane", "") })
+	aliasesFromEnv()
+	if got := Aliases()["fast-lane"]; got != "mock" {
+		t.Fatalf("alias from env = %q, want fast-lane -> mock", got)
+	}
+}
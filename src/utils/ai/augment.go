@@ -0,0 +1,168 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"j-project/src/utils/redact"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchFailureMode controls what SearchAugmentedProvider does when the web search fails.
+type SearchFailureMode int
+
+const (
+	// SearchFailProceed streams the original prompt without search context and notes it.
+	SearchFailProceed SearchFailureMode = iota
+	// SearchFailAbort fails the whole stream when the search fails.
+	SearchFailAbort
+)
+
+// ParseSearchFailureMode maps a config value ("proceed", "abort") to a SearchFailureMode.
+// Unknown or empty values default to SearchFailProceed.
+func ParseSearchFailureMode(s string) SearchFailureMode {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "abort", "fail", "strict":
+		return SearchFailAbort
+	default:
+		return SearchFailProceed
+	}
+}
+
+func (m SearchFailureMode) String() string {
+	if m == SearchFailAbort {
+		return "abort"
+	}
+	return "proceed"
+}
+
+// SearchAugmentedProvider runs a web search for the prompt and prepends the results
+// as context before delegating to the inner provider.
+type SearchAugmentedProvider struct {
+	Inner         Provider
+	Searcher      string // name of a registered web searcher; empty uses the mock
+	OnSearchError SearchFailureMode
+	// NoResultsNote tells the model that no sources were found when the search comes back
+	// empty. When false the prompt is sent unchanged.
+	NoResultsNote bool
+	// SearchTimeout bounds the search on its own child context, so a slow searcher is
+	// cancelled and handled per OnSearchError without eating into the generation's
+	// time. Zero means the search only ends with the request.
+	SearchTimeout time.Duration
+	// InjectResults caps how many results are added to the prompt and DisplayResults how
+	// many are reported as citations, so a client can show more sources than the model
+	// is given. Zero means all; DisplayResults never drops below the injected count.
+	InjectResults  int
+	DisplayResults int
+}
+
+// NewSearchAugmentedProvider wraps inner with web search augmentation.
+func NewSearchAugmentedProvider(inner Provider, searcher string, onSearchError SearchFailureMode) *SearchAugmentedProvider {
+	return &SearchAugmentedProvider{Inner: inner, Searcher: searcher, OnSearchError: onSearchError}
+}
+
+func (s *SearchAugmentedProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.Inner == nil {
+		return errors.New("search augmentation: inner provider is nil")
+	}
+	res := ResultFrom(ctx)
+
+	searchCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.SearchTimeout > 0 {
+		searchCtx, cancel = context.WithTimeout(ctx, s.SearchTimeout)
+	}
+	results, err := SearchWeb(searchCtx, s.Searcher, prompt)
+	cancel()
+	if err != nil && ctx.Err() == nil && errors.Is(searchCtx.Err(), context.DeadlineExceeded) {
+		err = &SearchError{Searcher: s.Searcher, Msg: "timed out after " + s.SearchTimeout.String(), Err: err}
+	} else if err != nil && ctx.Err() == nil && ShuttingDown() {
+		// cut off by Shutdown; handled like any other failed search
+		err = &SearchError{Searcher: s.Searcher, Err: ErrShuttingDown}
+	}
+	if err != nil {
+		if s.OnSearchError == SearchFailAbort {
+			log.Printf("search augmentation: search failed, aborting stream (mode=%s): %s", s.OnSearchError, redact.Scrub(err.Error()))
+			if res != nil {
+				res.Augmentation = AugmentationAborted
+				res.SearchError = err.Error()
+			}
+			var se *SearchError
+			if !errors.As(err, &se) {
+				err = &SearchError{Searcher: s.Searcher, Err: err}
+			}
+			return fmt.Errorf("search augmentation: %w", err)
+		}
+		log.Printf("search augmentation: search failed, proceeding without context (mode=%s): %s", s.OnSearchError, redact.Scrub(err.Error()))
+		if res != nil {
+			res.Augmentation = AugmentationSkipped
+			res.SearchError = err.Error()
+		}
+		return s.Inner.Stream(ctx, prompt, handler)
+	}
+
+	observeSearch(ctx, prompt, results)
+
+	if len(results) == 0 {
+		if res != nil {
+			res.Augmentation = AugmentationNoResults
+		}
+		if s.NoResultsNote {
+			prompt = "No web search results were available for this question; answer from your own knowledge and say so if unsure.\n\nQuestion: " + prompt
+		}
+		return s.Inner.Stream(ctx, prompt, handler)
+	}
+
+	display := results
+	if s.InjectResults > 0 && len(results) > s.InjectResults {
+		results = results[:s.InjectResults]
+	}
+	if s.DisplayResults > 0 && len(display) > max(s.DisplayResults, len(results)) {
+		display = display[:max(s.DisplayResults, len(results))]
+	}
+
+	name := ProviderFrom(ctx)
+	results, cut := fitSearchResults(prompt, results, promptBudget(name), tokenizerFor(name))
+	if cut > 0 {
+		log.Printf("search augmentation: dropped results (%d characters) to fit prompt budget", cut)
+		markTruncated(ctx, cut)
+	}
+	if len(results) == 0 {
+		if res != nil {
+			res.Augmentation = AugmentationSkipped
+			res.SearchError = "search results exceed prompt budget"
+		}
+		return s.Inner.Stream(ctx, fitPrompt(ctx, prompt), handler)
+	}
+
+	if res != nil {
+		res.Augmentation = AugmentationApplied
+		for i, r := range display {
+			c := parseCitation(r)
+			c.Injected = i < len(results)
+			res.Citations = append(res.Citations, c)
+		}
+	}
+	return s.Inner.Stream(ctx, fitPrompt(ctx, buildSearchPrompt(prompt, results)), handler)
+}
+
+// buildSearchPrompt prepends search results as a context block to the prompt.
+func buildSearchPrompt(prompt string, results []string) string {
+	var b strings.Builder
+	b.WriteString("Use the following web search results as context when answering.\n\n")
+	for i, r := range results {
+		b.WriteString("[")
+		b.WriteString(strconv.Itoa(i + 1))
+		b.WriteString("] ")
+		b.WriteString(r)
+		b.WriteString("\n")
+	}
+	b.WriteString("\nQuestion: ")
+	b.WriteString(prompt)
+	return b.String()
+}
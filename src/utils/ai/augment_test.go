@@ -0,0 +1,191 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registerSearcher makes ws available as name for the duration of the test.
+func registerSearcher(t *testing.T, name string, ws WebSearcher) {
+	t.Helper()
+	RegisterWebSearcher(name, ws)
+	t.Cleanup(func() { delete(webSearchProviders, name) })
+}
+
+// promptRecorder streams "ok" and remembers the prompt it was given.
+func promptRecorder(sent *string) Provider {
+	return providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		*sent = prompt
+		handler("ok")
+		return nil
+	})
+}
+
+var errSearchDown = errors.New("searcher down")
+
+func TestSearchFailureAbort(t *testing.T) {
+	registerSearcher(t, "failing", WebSearcherFunc(func(context.Context, string) ([]string, error) {
+		return nil, errSearchDown
+	}))
+	called := false
+	inner := providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		called = true
+		return nil
+	})
+
+	var res Result
+	p := NewSearchAugmentedProvider(inner, "failing", SearchFailAbort)
+	err := p.Stream(WithResult(context.Background(), &res), "q", func(string) {})
+	var se *SearchError
+	if !errors.Is(err, errSearchDown) || !errors.As(err, &se) {
+		t.Fatalf("err = %v, want a SearchError wrapping the searcher's error", err)
+	}
+	if called {
+		t.Fatal("inner provider ran after the search failed in abort mode")
+	}
+	if res.Augmentation != AugmentationAborted || !strings.Contains(res.SearchError, "searcher down") {
+		t.Fatalf("result = %+v, want aborted with the search error", res)
+	}
+}
+
+func TestSearchFailureProceed(t *testing.T) {
+	registerSearcher(t, "failing", WebSearcherFunc(func(context.Context, string) ([]string, error) {
+		return nil, errSearchDown
+	}))
+	var sent string
+	var res Result
+	var got []string
+	p := NewSearchAugmentedProvider(promptRecorder(&sent), "failing", SearchFailProceed)
+	err := p.Stream(WithResult(context.Background(), &res), "q", func(c string) { got = append(got, c) })
+	if err != nil || joined(got) != "ok" {
+		t.Fatalf("Stream = %q, %v; want the inner provider's answer", joined(got), err)
+	}
+	if sent != "q" {
+		t.Fatalf("inner got %q, want the prompt without search context", sent)
+	}
+	if res.Augmentation != AugmentationSkipped || !strings.Contains(res.SearchError, "searcher down") {
+		t.Fatalf("result = %+v, want skipped with the search error", res)
+	}
+}
+
+func TestSearchAugmentationApplied(t *testing.T) {
+	registerSearcher(t, "fixed", WebSearcherFunc(func(context.Context, string) ([]string, error) {
+		return []string{"Go 1.24 released (https://go.dev/blog)", "another result"}, nil
+	}))
+	var sent string
+	var res Result
+	p := NewSearchAugmentedProvider(promptRecorder(&sent), "fixed", SearchFailAbort)
+	p.InjectResults = 1
+	if err := p.Stream(WithResult(context.Background(), &res), "what's new", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Use the following web search results as context when answering.\n\n[1] Go 1.24 released (https://go.dev/blog)\n\nQuestion: what's new"
+	if sent != want {
+		t.Fatalf("inner got %q, want %q", sent, want)
+	}
+	if res.Augmentation != AugmentationApplied || len(res.Citations) != 2 {
+		t.Fatalf("result = %+v, want applied with two citations", res)
+	}
+	if c := res.Citations[0]; c.Title != "Go 1.24 released" || c.URL != "https://go.dev/blog" || !c.Injected {
+		t.Fatalf("first citation = %+v", c)
+	}
+	if res.Citations[1].Injected {
+		t.Fatal("second citation marked injected past InjectResults")
+	}
+}
+
+func TestParseSearchFailureMode(t *testing.T) {
+	for in, want := range map[string]SearchFailureMode{
+		"abort": SearchFailAbort, " Strict ": SearchFailAbort, "fail": SearchFailAbort,
+		"proceed": SearchFailProceed, "": SearchFailProceed, "bogus": SearchFailProceed,
+	} {
+		if got := ParseSearchFailureMode(in); got != want {
+			t.Errorf("ParseSearchFailureMode(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestSearchTimeoutLeavesGenerationAlone(t *testing.T) {
+	registerSearcher(t, "slow", WebSearcherFunc(func(ctx context.Context, query string) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	var genErr error
+	inner := providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		genErr = ctx.Err()
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("the generation inherited the search timeout")
+		}
+		handler("answer")
+		return nil
+	})
+
+	var res Result
+	p := NewSearchAugmentedProvider(inner, "slow", SearchFailProceed)
+	p.SearchTimeout = 20 * time.Millisecond
+	start := time.Now()
+	var got []string
+	err := p.Stream(WithResult(context.Background(), &res), "q", func(c string) { got = append(got, c) })
+	if err != nil || genErr != nil || joined(got) != "answer" {
+		t.Fatalf("Stream = %q, %v (generation ctx %v); want the answer without search context", joined(got), err, genErr)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("search was not cut off, took %s", time.Since(start))
+	}
+	if res.Augmentation != AugmentationSkipped || !strings.Contains(res.SearchError, "timed out after 20ms") {
+		t.Fatalf("result = %+v, want skipped with the timeout", res)
+	}
+
+	// in abort mode the timeout fails the stream as a SearchError
+	p.OnSearchError = SearchFailAbort
+	err = p.Stream(context.Background(), "q", func(string) {})
+	var se *SearchError
+	if !errors.As(err, &se) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("abort mode err = %v, want a SearchError wrapping the deadline", err)
+	}
+}
+
+func TestSearchInjectAndDisplayCounts(t *testing.T) {
+	var found []string
+	for i := range 10 {
+		found = append(found, fmt.Sprintf("result %d (https://example.com/%d)", i, i))
+	}
+	registerSearcher(t, "ten", WebSearcherFunc(func(context.Context, string) ([]string, error) {
+		return found, nil
+	}))
+	tests := []struct {
+		inject, display int
+		injected, shown int
+	}{
+		{3, 0, 3, 10},
+		{3, 5, 3, 5},
+		// the displayed list never hides a source the model was given
+		{3, 2, 3, 3},
+		{0, 4, 10, 10},
+	}
+	for _, tt := range tests {
+		var sent string
+		var res Result
+		p := NewSearchAugmentedProvider(promptRecorder(&sent), "ten", SearchFailAbort)
+		p.InjectResults, p.DisplayResults = tt.inject, tt.display
+		if err := p.Stream(WithResult(context.Background(), &res), "q", func(string) {}); err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(sent, "\n["); n != tt.injected {
+			t.Errorf("inject %d display %d: %d results in the prompt, want %d", tt.inject, tt.display, n, tt.injected)
+		}
+		if len(res.Citations) != tt.shown {
+			t.Errorf("inject %d display %d: %d citations, want %d", tt.inject, tt.display, len(res.Citations), tt.shown)
+			continue
+		}
+		for i, c := range res.Citations {
+			if c.Injected != (i < tt.injected) {
+				t.Errorf("inject %d display %d: citation %d injected = %v", tt.inject, tt.display, i, c.Injected)
+			}
+		}
+	}
+}
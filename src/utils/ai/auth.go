@@ -0,0 +1,111 @@
+package ai
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AuthKind is how an HTTPProvider presents its API key.
+type AuthKind string
+
+const (
+	AuthBearer AuthKind = "bearer" // Authorization: Bearer <key> (the default)
+	AuthHeader AuthKind = "header" // <Name>: <key>, e.g. Anthropic's x-api-key
+	AuthQuery  AuthKind = "query"  // ?<Name>=<key>, e.g. Gemini's ?key=
+	AuthBasic  AuthKind = "basic"  // Authorization: Basic, with Username and the key as password
+)
+
+// AuthScheme configures where HTTPProvider puts the API key. The zero value is bearer auth.
+type AuthScheme struct {
+	Kind AuthKind
+	// Name is the header or query parameter for AuthHeader and AuthQuery; they default
+	// to "x-api-key" and "key".
+	Name string
+	// Username is sent with AuthBasic. When empty the key itself is taken as a
+	// "user:password" pair.
+	Username string
+}
+
+// ParseAuthScheme reads a scheme written as "bearer", "basic", "basic:<user>",
+// "header:<name>" or "query:<name>". Unknown kinds are bearer auth.
+func ParseAuthScheme(s string) AuthScheme {
+	kind, arg, _ := strings.Cut(strings.TrimSpace(s), ":")
+	switch AuthKind(strings.ToLower(kind)) {
+	case AuthHeader:
+		return AuthScheme{Kind: AuthHeader, Name: arg}
+	case AuthQuery:
+		return AuthScheme{Kind: AuthQuery, Name: arg}
+	case AuthBasic:
+		return AuthScheme{Kind: AuthBasic, Username: arg}
+	}
+	return AuthScheme{Kind: AuthBearer}
+}
+
+// apply adds key to req according to the scheme.
+func (a AuthScheme) apply(req *http.Request, key string) {
+	switch a.Kind {
+	case AuthHeader:
+		name := a.Name
+		if name == "" {
+			name = "x-api-key"
+		}
+		req.Header.Set(name, key)
+	case AuthQuery:
+		name := a.Name
+		if name == "" {
+			name = "key"
+		}
+		q := req.URL.Query()
+		q.Set(name, key)
+		req.URL.RawQuery = q.Encode()
+	case AuthBasic:
+		cred := key
+		if a.Username != "" {
+			cred = a.Username + ":" + key
+		}
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(cred)))
+	default:
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+}
+
+// authSchemesFromEnv applies AUTH_SCHEME_<NAME> to every registered HTTPProvider.
+func authSchemesFromEnv() {
+	for name, p := range providers {
+		h, ok := p.(*HTTPProvider)
+		if !ok {
+			continue
+		}
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if v := os.Getenv("AUTH_SCHEME_" + key); v != "" {
+			h.Auth = ParseAuthScheme(v)
+		}
+	}
+}
+
+type apiKeyKey struct{}
+
+// WithAPIKey returns a context whose HTTPProvider requests authenticate with key
+// instead of the provider's ApiKeyEnv, for clients that bring their own key. The key
+// lives only as long as ctx; it is never logged or registered with redact. An empty key
+// means the provider's own.
+func WithAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+// apiKeyFrom returns the request's own API key, or "".
+func apiKeyFrom(ctx context.Context) string {
+	k, _ := ctx.Value(apiKeyKey{}).(string)
+	return k
+}
+
+// scrubKey removes a request's own API key from s.
+func scrubKey(s, key string) string {
+	if key == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, key, "[secret]")
+}
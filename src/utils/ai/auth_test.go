@@ -0,0 +1,159 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseAuthScheme(t *testing.T) {
+	tests := []struct {
+		in   string
+		want AuthScheme
+	}{
+		{"", AuthScheme{Kind: AuthBearer}},
+		{"bearer", AuthScheme{Kind: AuthBearer}},
+		{"header:x-goog-api-key", AuthScheme{Kind: AuthHeader, Name: "x-goog-api-key"}},
+		{"query:key", AuthScheme{Kind: AuthQuery, Name: "key"}},
+		{"basic:admin", AuthScheme{Kind: AuthBasic, Username: "admin"}},
+		{"nonsense", AuthScheme{Kind: AuthBearer}},
+	}
+	for _, tt := range tests {
+		if got := ParseAuthScheme(tt.in); got != tt.want {
+			t.Errorf("ParseAuthScheme(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAuthSchemeApply(t *testing.T) {
+	tests := []struct {
+		scheme AuthScheme
+		check  func(*http.Request) string
+		want   string
+	}{
+		{AuthScheme{}, func(r *http.Request) string { return r.Header.Get("Authorization") }, "Bearer k1"},
+		{AuthScheme{Kind: AuthHeader}, func(r *http.Request) string { return r.Header.Get("x-api-key") }, "k1"},
+		{AuthScheme{Kind: AuthQuery, Name: "token"}, func(r *http.Request) string { return r.URL.Query().Get("token") }, "k1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "http://upstream/v1", nil)
+		tt.scheme.apply(req, "k1")
+		if got := tt.check(req); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.scheme, got, tt.want)
+		}
+	}
+	req := httptest.NewRequest("POST", "http://upstream/v1", nil)
+	AuthScheme{Kind: AuthBasic, Username: "u"}.apply(req, "pw")
+	if user, pass, ok := req.BasicAuth(); !ok || user != "u" || pass != "pw" {
+		t.Errorf("basic auth = %q %q %v", user, pass, ok)
+	}
+}
+
+func TestRequestAPIKeyOverridesEnvKey(t *testing.T) {
+	var gotAuth []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		gotAuth = append(gotAuth, auth)
+		if auth != "Bearer env-key-1234" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, `{"error":"invalid key %s"}`, strings.TrimPrefix(auth, "Bearer "))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer upstream.Close()
+	t.Setenv("AUTH_TEST_KEY", "env-key-1234")
+	h := NewHTTPProvider(upstream.URL, "AUTH_TEST_KEY", "", true)
+	h.Format = FormatRaw
+	register(t, "auth-test", h)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	prevDebug := DebugHTTP
+	DebugHTTP = true
+	defer func() { DebugHTTP = prevDebug }()
+
+	// enough failing requests with a client key to open the breaker, were they counted
+	ctx := WithAPIKey(context.Background(), "sk-tenant-secret")
+	for i := 0; i < BreakerThreshold+1; i++ {
+		_, err := collect(t, ctx, "auth-test", "hi")
+		if err == nil {
+			t.Fatal("want the upstream's 401")
+		}
+		if strings.Contains(err.Error(), "sk-tenant-secret") {
+			t.Fatalf("error echoes the request key: %v", err)
+		}
+	}
+	if gotAuth[0] != "Bearer sk-tenant-secret" {
+		t.Fatalf("upstream got %q, want the request's key", gotAuth[0])
+	}
+	if got := breakerFor("auth-test").State(); got != BreakerClosed {
+		t.Fatalf("breaker state after client-key failures = %s, want closed", got)
+	}
+
+	// without a request key the provider's own key is used again
+	chunks, err := collect(t, context.Background(), "auth-test", "hi")
+	if err != nil || joined(chunks) != "ok" {
+		t.Fatalf("env key request = %q, %v", joined(chunks), err)
+	}
+	if last := gotAuth[len(gotAuth)-1]; last != "Bearer env-key-1234" {
+		t.Fatalf("upstream got %q, want the env key", last)
+	}
+	if strings.Contains(logs.String(), "sk-tenant-secret") {
+		t.Fatalf("request key was logged:\n%s", logs.String())
+	}
+}
+
+func TestAuthSchemesEndToEnd(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		fmt.Fprintln(w, "ok")
+	}))
+	defer upstream.Close()
+	t.Setenv("AUTH_SCHEME_AUTH_E2E", "header:x-api-key")
+	t.Setenv("AUTH_E2E_KEY", "sk-e2e")
+	h := NewHTTPProvider(upstream.URL+"/v1beta/models/m:streamGenerateContent?alt=sse", "AUTH_E2E_KEY", "", true)
+	h.Format = FormatRaw
+	register(t, "auth-e2e", h)
+
+	// configured the way the env does it: Anthropic's x-api-key
+	authSchemesFromEnv()
+	if h.Auth != (AuthScheme{Kind: AuthHeader, Name: "x-api-key"}) {
+		t.Fatalf("Auth from AUTH_SCHEME_AUTH_E2E = %+v", h.Auth)
+	}
+	tests := []struct {
+		scheme string
+		check  func(*http.Request) bool
+	}{
+		{"header:x-api-key", func(r *http.Request) bool {
+			return r.Header.Get("x-api-key") == "sk-e2e" && r.Header.Get("Authorization") == ""
+		}},
+		// Gemini's ?key=, added to the endpoint's own query
+		{"query:key", func(r *http.Request) bool {
+			q := r.URL.Query()
+			return q.Get("key") == "sk-e2e" && q.Get("alt") == "sse" && r.Header.Get("Authorization") == ""
+		}},
+		{"basic:admin", func(r *http.Request) bool {
+			user, pass, ok := r.BasicAuth()
+			return ok && user == "admin" && pass == "sk-e2e"
+		}},
+		{"bearer", func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer sk-e2e" }},
+	}
+	for _, tt := range tests {
+		h.Auth = ParseAuthScheme(tt.scheme)
+		if _, err := collect(t, context.Background(), "auth-e2e", "hi"); err != nil {
+			t.Fatalf("%s: %v", tt.scheme, err)
+		}
+		if r := <-requests; !tt.check(r) {
+			t.Errorf("%s: credential not where it belongs: %s %v", tt.scheme, r.URL, r.Header)
+		}
+	}
+}
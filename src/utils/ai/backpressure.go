@@ -0,0 +1,57 @@
+package ai
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// Backpressure
+//
+// StreamHandler calls are synchronous: a provider does not read more from its upstream
+// until the handler returns. A handler that blocks therefore pauses the provider — for
+// HTTPProvider the response body stops being read and TCP flow control slows the
+// upstream down. Nothing is buffered behind a slow handler, so memory stays bounded.
+//
+// BufferedHandler keeps that guarantee while letting a provider run a few chunks ahead
+// of a consumer whose speed varies, such as a WebSocket client.
+
+// BufferedHandler returns a handler for the provider that queues up to size chunks for
+// consumer, which runs on its own goroutine. When the queue is full the provider blocks
+// until consumer catches up or ctx is done; after ctx is done further chunks are dropped.
+// Call wait after Stream returns to deliver the remaining chunks and stop the goroutine.
+// A panic in consumer is logged and the remaining chunks are discarded.
+func BufferedHandler(ctx context.Context, size int, consumer StreamHandler) (handler StreamHandler, wait func()) {
+	if size < 1 {
+		size = 1
+	}
+	ch := make(chan string, size)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if v := recover(); v != nil {
+				log.Printf("buffered stream handler panicked (request=%s): %v\n%s", RequestIDFrom(ctx), v, debug.Stack())
+				for range ch {
+				}
+			}
+		}()
+		for chunk := range ch {
+			consumer(chunk)
+		}
+	}()
+
+	var once sync.Once
+	handler = func(chunk string) {
+		select {
+		case ch <- chunk:
+		case <-ctx.Done():
+		}
+	}
+	wait = func() {
+		once.Do(func() { close(ch) })
+		<-done
+	}
+	return handler, wait
+}
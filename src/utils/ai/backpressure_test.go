@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBufferedHandlerBlocksProviderForSlowConsumer(t *testing.T) {
+	const size = 4
+	var produced, consumed atomic.Int32
+	var got []string
+	handler, wait := BufferedHandler(context.Background(), size, func(c string) {
+		time.Sleep(2 * time.Millisecond)
+		got = append(got, c)
+		consumed.Add(1)
+	})
+
+	var want []string
+	lead := int32(0)
+	for i := range 50 {
+		c := fmt.Sprint(i)
+		want = append(want, c)
+		handler(c)
+		produced.Add(1)
+		lead = max(lead, produced.Load()-consumed.Load())
+	}
+	wait()
+
+	// the queue, plus the chunk the consumer is working on
+	if lead > size+1 {
+		t.Fatalf("provider ran %d chunks ahead of the consumer, want at most %d", lead, size+1)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("consumer got %q, want every chunk in order", got)
+	}
+}
+
+func TestBufferedHandlerStopsBlockingWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	handler, wait := BufferedHandler(ctx, 1, func(string) { <-release })
+
+	handler("a") // taken by the consumer, which blocks
+	handler("b") // queued
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		handler("c") // the queue is full, but ctx is done
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler blocked after its context was cancelled")
+	}
+	close(release)
+	wait()
+}
+
+func TestBufferedHandlerConsumerPanic(t *testing.T) {
+	var calls atomic.Int32
+	handler, wait := BufferedHandler(context.Background(), 8, func(string) {
+		if calls.Add(1) == 2 {
+			panic("consumer failed")
+		}
+	})
+	for range 5 {
+		handler("x")
+	}
+	wait()
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("consumer called %d times, want the chunks after its panic discarded", n)
+	}
+}
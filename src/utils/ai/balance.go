@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// BalancePolicy selects how LoadBalancedProvider picks a provider for each request.
+type BalancePolicy int
+
+const (
+	// BalanceRoundRobin takes the providers in turn.
+	BalanceRoundRobin BalancePolicy = iota
+	// BalanceLeastInFlight takes the provider with the fewest streams running, taking
+	// them in turn among equals.
+	BalanceLeastInFlight
+)
+
+// ParseBalancePolicy maps a config value ("round-robin", "least-in-flight") to a
+// BalancePolicy. Unknown or empty values default to BalanceRoundRobin.
+func ParseBalancePolicy(s string) BalancePolicy {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "least-in-flight", "least_in_flight", "least":
+		return BalanceLeastInFlight
+	default:
+		return BalanceRoundRobin
+	}
+}
+
+func (p BalancePolicy) String() string {
+	if p == BalanceLeastInFlight {
+		return "least-in-flight"
+	}
+	return "round-robin"
+}
+
+// LoadBalancedProvider spreads requests over the named providers, such as several
+// replicas of one model. Providers whose breaker is open are skipped until it half-opens;
+// if every breaker is open the pick is made among all of them and the breaker rejects it.
+// Requests run through Stream, so each provider's concurrency limit and breaker apply,
+// and a failed request is not retried elsewhere (wrap it in a FallbackProvider for that).
+type LoadBalancedProvider struct {
+	Providers []string
+	Policy    BalancePolicy
+
+	next atomic.Uint64
+}
+
+// NewLoadBalancedProvider creates a balancer over the named providers.
+func NewLoadBalancedProvider(policy BalancePolicy, providers ...string) *LoadBalancedProvider {
+	return &LoadBalancedProvider{Providers: providers, Policy: policy}
+}
+
+func (b *LoadBalancedProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name, err := b.pick()
+	if err != nil {
+		return err
+	}
+	return Stream(ctx, name, prompt, handler)
+}
+
+// pick chooses the provider for the next request.
+func (b *LoadBalancedProvider) pick() (string, error) {
+	n := uint64(len(b.Providers))
+	if n == 0 {
+		return "", errors.New("load balancer: no providers configured")
+	}
+	healthy := Healthy
+
+	if b.Policy != BalanceLeastInFlight {
+		// advance past unhealthy providers so the healthy ones still alternate evenly
+		for range n {
+			if name := b.Providers[(b.next.Add(1)-1)%n]; healthy(name) {
+				return name, nil
+			}
+		}
+		return b.Providers[(b.next.Add(1)-1)%n], nil
+	}
+
+	// start from the next healthy provider, as round-robin would, so that equals
+	// alternate evenly around unhealthy ones
+	start := b.next.Add(1) - 1
+	for i := uint64(1); i < n && !healthy(b.Providers[start%n]); i++ {
+		start = b.next.Add(1) - 1
+	}
+	best, least := "", int64(0)
+	for i := range n {
+		name := b.Providers[(start+i)%n]
+		if !healthy(name) {
+			continue
+		}
+		if l := limiterFor(name).inFlight.Load(); best == "" || l < least {
+			best, least = name, l
+		}
+	}
+	if best == "" {
+		return b.Providers[start%n], nil
+	}
+	return best, nil
+}
+
+func (b *LoadBalancedProvider) Capabilities() Capabilities {
+	if len(b.Providers) == 0 {
+		return Capabilities{}
+	}
+	return ProviderCapabilities(b.Providers[0])
+}
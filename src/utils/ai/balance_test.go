@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// replicas registers providers that answer with their own name.
+func replicas(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		register(t, name, &ScriptedProvider{Chunks: []string{name}})
+	}
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	replicas(t, "lb-a", "lb-b", "lb-c")
+	b := NewLoadBalancedProvider(BalanceRoundRobin, "lb-a", "lb-b", "lb-c")
+
+	counts := map[string]int{}
+	for range 9 {
+		var got []string
+		if err := b.Stream(context.Background(), "hi", func(c string) { got = append(got, c) }); err != nil {
+			t.Fatal(err)
+		}
+		counts[joined(got)]++
+	}
+	for _, name := range b.Providers {
+		if counts[name] != 3 {
+			t.Fatalf("requests per replica = %v, want 3 each", counts)
+		}
+	}
+}
+
+func TestLoadBalancerSkipsUnhealthy(t *testing.T) {
+	replicas(t, "lb-a", "lb-b", "lb-c")
+	ReportHealth("lb-b", errors.New("connection refused"))
+	t.Cleanup(func() { ReportHealth("lb-b", nil) })
+
+	for _, policy := range []BalancePolicy{BalanceRoundRobin, BalanceLeastInFlight} {
+		b := NewLoadBalancedProvider(policy, "lb-a", "lb-b", "lb-c")
+		counts := map[string]int{}
+		for range 6 {
+			var got []string
+			if err := b.Stream(context.Background(), "hi", func(c string) { got = append(got, c) }); err != nil {
+				t.Fatal(err)
+			}
+			counts[joined(got)]++
+		}
+		if counts["lb-b"] != 0 || counts["lb-a"] != 3 || counts["lb-c"] != 3 {
+			t.Fatalf("%s: requests per replica = %v, want lb-b skipped and the rest even", policy, counts)
+		}
+	}
+}
+
+func TestLoadBalancerLeastInFlight(t *testing.T) {
+	busy := &gatedProvider{release: make(chan struct{})}
+	register(t, "lb-busy", busy)
+	replicas(t, "lb-idle")
+	b := NewLoadBalancedProvider(BalanceLeastInFlight, "lb-busy", "lb-idle")
+
+	// a long stream ties up lb-busy; everything after it goes to lb-idle
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Stream(context.Background(), "lb-busy", "hi", func(string) {})
+	}()
+	eventually(t, "the busy stream to start", func() bool { return busy.running.Load() == 1 })
+	for range 3 {
+		var got []string
+		if err := b.Stream(context.Background(), "hi", func(c string) { got = append(got, c) }); err != nil {
+			t.Fatal(err)
+		}
+		if joined(got) != "lb-idle" {
+			t.Fatalf("request went to %q while lb-busy had a stream running", joined(got))
+		}
+	}
+	close(busy.release)
+	wg.Wait()
+}
+
+func TestParseBalancePolicy(t *testing.T) {
+	for in, want := range map[string]BalancePolicy{
+		"round-robin": BalanceRoundRobin, "": BalanceRoundRobin, "bogus": BalanceRoundRobin,
+		"least-in-flight": BalanceLeastInFlight, " Least ": BalanceLeastInFlight,
+	} {
+		if got := ParseBalancePolicy(in); got != want {
+			t.Errorf("ParseBalancePolicy(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package ai
+
+// The BenchmarkStream* benchmarks measure the per-chunk overhead of the streaming
+// pipeline. Each streams 1000 short chunks from a ScriptedProvider through Stream and
+// one stage of the handler pipeline, reporting time and allocations per stream:
+//
+//	go test ./src/utils/ai -run '^$' -bench Stream
+//	go test ./src/utils/ai -run '^$' -bench StreamStop -benchtime 5s -count 6 > new.txt
+//
+// Compare runs before and after a change on the same machine, e.g. with benchstat
+// old.txt new.txt; absolute numbers depend on the hardware. On a single-core Xeon VM,
+// per stream of 1000 chunks:
+//
+//	StreamDirect           ~40µs    22 allocs
+//	StreamRuneBoundaries   ~60µs   520 allocs (coalescing chunks split mid-rune)
+//	StreamStopSequences   ~130µs  1030 allocs (one concatenation per chunk)
+//	StreamStrip           ~170µs    43 allocs (held-back token prefixes)
+//	StreamDedup            ~20µs    24 allocs (all but the first chunk dropped)
+//	StreamBuffered        ~140µs    29 allocs (channel handoff per chunk)
+//	StreamTeeTTS          ~270µs   890 allocs (sentence splitting)
+
+import (
+	"context"
+	"io"
+	"j-project/src/utils/tts"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const benchChunks = 1000
+
+// benchProvider registers a provider streaming benchChunks chunks of words and sentence
+// ends, as an LLM emits them, free of the default inactivity timer.
+func benchProvider(b *testing.B, name string, chunk func(i int) string) {
+	chunks := make([]string, benchChunks)
+	for i := range chunks {
+		chunks[i] = chunk(i)
+	}
+	register(b, name, &ScriptedProvider{Chunks: chunks})
+	SetProviderTimeout(name, 0)
+	b.Cleanup(func() {
+		timeoutsMu.Lock()
+		delete(timeouts, name)
+		timeoutsMu.Unlock()
+	})
+}
+
+func words(i int) string {
+	if i%12 == 11 {
+		return "end. "
+	}
+	return "word "
+}
+
+// benchStream streams the named provider b.N times through handler.
+func benchStream(b *testing.B, ctx context.Context, name string, handler StreamHandler) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Stream(ctx, name, "x", handler); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N*benchChunks)/b.Elapsed().Seconds(), "chunks/s")
+}
+
+func BenchmarkStreamDirect(b *testing.B) {
+	benchProvider(b, "bench-direct", words)
+	benchStream(b, context.Background(), "bench-direct", func(string) {})
+}
+
+func BenchmarkStreamRuneBoundaries(b *testing.B) {
+	// every other chunk ends halfway through "é" and the next one completes it
+	benchProvider(b, "bench-runes", func(i int) string {
+		if i%2 == 0 {
+			return "caf\xc3"
+		}
+		return "\xa9 "
+	})
+	benchStream(b, context.Background(), "bench-runes", func(string) {})
+}
+
+func BenchmarkStreamStopSequences(b *testing.B) {
+	benchProvider(b, "bench-stop", words)
+	ctx := WithOptions(context.Background(), Options{StopSequences: []string{"</answer>"}})
+	benchStream(b, ctx, "bench-stop", func(string) {})
+}
+
+func BenchmarkStreamStrip(b *testing.B) {
+	benchProvider(b, "bench-strip", words)
+	SetStripPatterns("bench-strip", StripPatterns{Tokens: []string{"<|assistant|>", "<|end|>"}, Prefix: regexp.MustCompile(`^Sure[!.,]\s*`)})
+	b.Cleanup(func() { SetStripPatterns("bench-strip", StripPatterns{}) })
+	benchStream(b, context.Background(), "bench-strip", func(string) {})
+}
+
+func BenchmarkStreamDedup(b *testing.B) {
+	benchProvider(b, "bench-dedup", func(i int) string { return "a repeated sentence. " })
+	SetChunkDedup("bench-dedup", DefaultDedupMinLength)
+	b.Cleanup(func() { SetChunkDedup("bench-dedup", 0) })
+	benchStream(b, context.Background(), "bench-dedup", func(string) {})
+}
+
+func BenchmarkStreamBuffered(b *testing.B) {
+	benchProvider(b, "bench-buffered", words)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ctx := context.Background()
+		h, wait := BufferedHandler(ctx, 64, func(string) {})
+		if err := Stream(ctx, "bench-buffered", "x", h); err != nil {
+			b.Fatal(err)
+		}
+		wait()
+	}
+	b.ReportMetric(float64(b.N*benchChunks)/b.Elapsed().Seconds(), "chunks/s")
+}
+
+// BenchmarkStreamTeeTTS sends every chunk both to the client and to speech, as the
+// WebSocket handler does, so it includes the TTS sentence buffering.
+func BenchmarkStreamTeeTTS(b *testing.B) {
+	benchProvider(b, "bench-tts", words)
+	// the TTS path logs every sentence when espeak isn't installed
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var client strings.Builder
+		s := tts.NewStream("bench")
+		err := Stream(context.Background(), "bench-tts", "x", func(chunk string) {
+			client.WriteString(chunk)
+			s.Write(chunk)
+		})
+		s.Close()
+		s.Wait()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N*benchChunks)/b.Elapsed().Seconds(), "chunks/s")
+}
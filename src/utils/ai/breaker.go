@@ -0,0 +1,151 @@
+package ai
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Stream while a provider's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // requests flow normally
+	BreakerOpen                         // requests fail fast until the cooldown elapses
+	BreakerHalfOpen                     // a single trial request is allowed through
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker opens after Threshold consecutive failures and fails fast for Cooldown,
+// then lets one trial request through: success closes it, failure re-opens it.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial request is in flight
+	now      func() time.Time
+}
+
+// NewCircuitBreaker creates a closed breaker. A threshold <= 0 disables it.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports whether a request may proceed, returning ErrCircuitOpen if not.
+// Every allowed request must be followed by a call to Record or Release.
+func (b *CircuitBreaker) Allow() error {
+	if b.Threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return nil
+	case BreakerHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+		return nil
+	}
+	return nil
+}
+
+// Record reports the outcome of an allowed request.
+func (b *CircuitBreaker) Record(failed bool) {
+	if b.Threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Release ends an allowed request without recording an outcome, for requests that
+// say nothing about the provider (e.g. cancelled by the caller). A half-open breaker
+// lets the next request through as its trial.
+func (b *CircuitBreaker) Release() {
+	if b.Threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// State returns the current state without changing it.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Default breaker settings applied to every registered provider.
+var (
+	BreakerThreshold = 5
+	BreakerCooldown  = 30 * time.Second
+)
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*CircuitBreaker{}
+)
+
+// breakerFor returns the breaker for a provider name, creating it on first use.
+func breakerFor(name string) *CircuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = NewCircuitBreaker(BreakerThreshold, BreakerCooldown)
+		breakers[name] = b
+	}
+	return b
+}
+
+// BreakerStates returns the breaker state of every provider that has been used.
+func BreakerStates() map[string]string {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	out := make(map[string]string, len(breakers))
+	for name, b := range breakers {
+		out[name] = b.State().String()
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a controllable time source for breakers.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	b := NewCircuitBreaker(threshold, cooldown)
+	b.now = clock.now
+	return b, clock
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b, clock := newTestBreaker(2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("closed breaker refused request %d: %v", i, err)
+		}
+		b.Record(true)
+	}
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("after 2 failures state = %s, want open", got)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker Allow = %v, want ErrCircuitOpen", err)
+	}
+
+	clock.advance(time.Minute)
+	if got := b.State(); got != BreakerHalfOpen {
+		t.Fatalf("after cooldown state = %s, want half-open", got)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("half-open breaker refused the trial: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second request during the trial = %v, want ErrCircuitOpen", err)
+	}
+	b.Record(false)
+	if got := b.State(); got != BreakerClosed {
+		t.Fatalf("after a successful trial state = %s, want closed", got)
+	}
+}
+
+func TestCircuitBreakerFailedTrialReopens(t *testing.T) {
+	b, clock := newTestBreaker(1, time.Minute)
+	b.Allow()
+	b.Record(true)
+	clock.advance(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(true)
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("after a failed trial state = %s, want open", got)
+	}
+}
+
+func TestCircuitBreakerRelease(t *testing.T) {
+	b, clock := newTestBreaker(1, time.Minute)
+	b.Allow()
+	b.Record(true)
+	clock.advance(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Release()
+	if got := b.State(); got != BreakerHalfOpen {
+		t.Fatalf("after a released trial state = %s, want half-open", got)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("released trial did not free the slot: %v", err)
+	}
+}
+
+func TestStreamBreakerIgnoresCallerFailures(t *testing.T) {
+	failing := &ScriptedProvider{Err: &ProviderError{Msg: "down"}}
+	slow := &ScriptedProvider{Chunks: []string{"a"}, Delay: time.Second}
+	empty := providerFunc(func(context.Context, string, StreamHandler) error { return ErrEmptyPrompt })
+	register(t, "breaker-test", failing)
+	b, _ := newTestBreaker(2, time.Minute)
+	breakersMu.Lock()
+	breakers["breaker-test"] = b
+	breakersMu.Unlock()
+
+	if _, err := collect(t, context.Background(), "breaker-test", "hi"); err == nil {
+		t.Fatal("want an error from the failing provider")
+	}
+
+	// neither a cancelled stream nor an empty prompt may reset or add to the count
+	providers["breaker-test"] = slow
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	collect(t, ctx, "breaker-test", "hi")
+	providers["breaker-test"] = empty
+	collect(t, context.Background(), "breaker-test", "hi")
+	if got := b.State(); got != BreakerClosed {
+		t.Fatalf("state = %s, want closed", got)
+	}
+
+	providers["breaker-test"] = failing
+	collect(t, context.Background(), "breaker-test", "hi")
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("two real failures around caller failures: state = %s, want open", got)
+	}
+}
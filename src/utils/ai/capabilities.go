@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported is wrapped by CheckCapabilities when a provider lacks a feature.
+var ErrUnsupported = errors.New("not supported by provider")
+
+// Capabilities describes what a provider can do. MaxContext is in tokens; zero means
+// unknown. Messages providers take a conversation's history as chat messages (see
+// MessagesFrom); others are sent it as one transcript.
+type Capabilities struct {
+	Streaming  bool `json:"streaming"`
+	Tools      bool `json:"tools"`
+	Images     bool `json:"images"`
+	JSONMode   bool `json:"json_mode"`
+	Messages   bool `json:"messages"`
+	MaxContext int  `json:"max_context,omitempty"`
+}
+
+// CapabilityReporter is implemented by providers that describe their capabilities.
+// Providers that don't are assumed to stream plain text and nothing more.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// ProviderCapabilities returns the capabilities of the provider Stream would use for
+// name, following the same fallback to the mock provider.
+func ProviderCapabilities(name string) Capabilities {
+	if name == "" {
+		name = DefaultProvider()
+	}
+	if resolved, err := resolveAlias(name); err == nil {
+		name = resolved
+	}
+	p, ok := providers[name]
+	if !ok {
+		p = &MockProvider{}
+	}
+	return capabilitiesOf(p)
+}
+
+func capabilitiesOf(p Provider) Capabilities {
+	if r, ok := p.(CapabilityReporter); ok {
+		return r.Capabilities()
+	}
+	return Capabilities{Streaming: true}
+}
+
+// CheckCapabilities returns an error naming every feature in need that the provider
+// lacks, or nil if it supports them all. Only the boolean features are checked.
+func CheckCapabilities(name string, need Capabilities) error {
+	have := ProviderCapabilities(name)
+	var missing []string
+	if need.Streaming && !have.Streaming {
+		missing = append(missing, "streaming")
+	}
+	if need.Tools && !have.Tools {
+		missing = append(missing, "tools")
+	}
+	if need.Images && !have.Images {
+		missing = append(missing, "images")
+	}
+	if need.JSONMode && !have.JSONMode {
+		missing = append(missing, "JSON mode")
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("provider %s: %s %w", name, strings.Join(missing, ", "), ErrUnsupported)
+}
+
+func (m *MockProvider) Capabilities() Capabilities {
+	return Capabilities{Streaming: true, Messages: true}
+}
+
+// Capabilities reports Caps with Streaming taken from StreamEnabled.
+func (h *HTTPProvider) Capabilities() Capabilities {
+	c := h.Caps
+	c.Streaming = h.StreamEnabled
+	return c
+}
+
+func (s *SearchAugmentedProvider) Capabilities() Capabilities { return capabilitiesOf(s.Inner) }
+
+func (r *RAGProvider) Capabilities() Capabilities { return capabilitiesOf(r.Inner) }
+
+func (s *ShadowProvider) Capabilities() Capabilities { return capabilitiesOf(s.Primary) }
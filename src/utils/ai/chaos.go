@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ChaosEnabled gates all fault injection. It is only ever set from CHAOS_ENABLED=true;
+// without it ChaosProvider passes requests straight through whatever its settings, so
+// a chaos setting left in a production config does nothing.
+var ChaosEnabled = os.Getenv("CHAOS_ENABLED") == "true"
+
+// ErrChaos is the error injected by ChaosProvider.
+var ErrChaos = errors.New("chaos: injected failure")
+
+// ChaosConfig describes the faults to inject.
+type ChaosConfig struct {
+	Jitter    time.Duration // random delay of up to Jitter before each chunk
+	ErrorRate float64       // fraction of requests that fail part-way through
+	DropRate  float64       // fraction of chunks silently dropped
+}
+
+type chaosKey struct{}
+
+// WithChaos returns a context whose requests use cfg instead of the ChaosProvider's own
+// settings, e.g. from request headers. It has no effect unless ChaosEnabled is set.
+func WithChaos(ctx context.Context, cfg ChaosConfig) context.Context {
+	return context.WithValue(ctx, chaosKey{}, cfg)
+}
+
+// ChaosProvider injects latency, failures and dropped chunks into Inner's stream, for
+// testing how clients cope. A failing request delivers a few chunks and then returns
+// ErrChaos. Nothing is injected unless ChaosEnabled is set.
+type ChaosProvider struct {
+	Inner Provider
+	ChaosConfig
+	Rand func() float64 // source of randomness in [0,1); defaults to math/rand
+}
+
+func (c *ChaosProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.Inner == nil {
+		return errors.New("chaos: inner provider is nil")
+	}
+	if !ChaosEnabled {
+		return c.Inner.Stream(ctx, prompt, handler)
+	}
+	cfg := c.ChaosConfig
+	if override, ok := ctx.Value(chaosKey{}).(ChaosConfig); ok {
+		cfg = override
+	}
+	random := c.Rand
+	if random == nil {
+		random = rand.Float64
+	}
+
+	failAfter := -1
+	if random() < cfg.ErrorRate {
+		failAfter = int(random() * 4) // fail after 0-3 chunks
+	}
+	if failAfter == 0 {
+		return ErrChaos
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	delivered, failed := 0, false
+	wrapped := func(chunk string) {
+		if failed {
+			return
+		}
+		if cfg.Jitter > 0 && !sleepCtx(ctx, time.Duration(random()*float64(cfg.Jitter))) {
+			return
+		}
+		if random() < cfg.DropRate {
+			return
+		}
+		handler(chunk)
+		delivered++
+		if failAfter > 0 && delivered >= failAfter {
+			failed = true
+			cancel()
+		}
+	}
+	err := c.Inner.Stream(ctx, prompt, wrapped)
+	if failed || failAfter > 0 {
+		return ErrChaos
+	}
+	return err
+}
+
+func (c *ChaosProvider) Capabilities() Capabilities { return capabilitiesOf(c.Inner) }
+
+func (c *ChaosProvider) Validate() error { return validateInner(c.Inner) }
+
+// chaosFromEnv wraps every registered provider in a ChaosProvider configured from
+// CHAOS_JITTER, CHAOS_ERROR_RATE and CHAOS_DROP_RATE, when CHAOS_ENABLED=true.
+// Fallback chains and load balancers are left alone; the providers they call are wrapped.
+func chaosFromEnv() {
+	if !ChaosEnabled {
+		return
+	}
+	var cfg ChaosConfig
+	cfg.Jitter, _ = time.ParseDuration(os.Getenv("CHAOS_JITTER"))
+	cfg.ErrorRate, _ = strconv.ParseFloat(os.Getenv("CHAOS_ERROR_RATE"), 64)
+	cfg.DropRate, _ = strconv.ParseFloat(os.Getenv("CHAOS_DROP_RATE"), 64)
+	for name, p := range providers {
+		switch p.(type) {
+		case *FallbackProvider, *LoadBalancedProvider:
+			continue
+		}
+		providers[name] = &ChaosProvider{Inner: p, ChaosConfig: cfg}
+	}
+	log.Printf("CHAOS ENABLED: injecting faults into every provider (jitter=%s, error rate=%g, drop rate=%g); never run this in production",
+		cfg.Jitter, cfg.ErrorRate, cfg.DropRate)
+}
@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+// enableChaos turns fault injection on for the duration of the test.
+func enableChaos(t *testing.T) {
+	t.Helper()
+	prev := ChaosEnabled
+	ChaosEnabled = true
+	t.Cleanup(func() { ChaosEnabled = prev })
+}
+
+func TestChaosErrorRate(t *testing.T) {
+	enableChaos(t)
+	c := &ChaosProvider{
+		Inner:       &ScriptedProvider{Chunks: []string{"a", "b", "c", "d", "e"}},
+		ChaosConfig: ChaosConfig{ErrorRate: 0.3},
+		Rand:        rand.New(rand.NewPCG(1, 2)).Float64,
+	}
+	const requests = 2000
+	failed := 0
+	for range requests {
+		var got []string
+		err := c.Stream(context.Background(), "hi", func(s string) { got = append(got, s) })
+		switch {
+		case errors.Is(err, ErrChaos):
+			failed++
+			if len(got) > 3 {
+				t.Fatalf("failed request delivered %d chunks, want at most 3", len(got))
+			}
+		case err != nil:
+			t.Fatal(err)
+		case joined(got) != "abcde":
+			t.Fatalf("successful request delivered %q", joined(got))
+		}
+	}
+	if rate := float64(failed) / requests; rate < 0.25 || rate > 0.35 {
+		t.Fatalf("error rate %.3f over %d requests, want about 0.3", rate, requests)
+	}
+}
+
+func TestChaosDropRate(t *testing.T) {
+	enableChaos(t)
+	chunks := make([]string, 1000)
+	for i := range chunks {
+		chunks[i] = "x"
+	}
+	c := &ChaosProvider{
+		Inner:       &ScriptedProvider{Chunks: chunks},
+		ChaosConfig: ChaosConfig{DropRate: 0.5},
+		Rand:        rand.New(rand.NewPCG(3, 4)).Float64,
+	}
+	delivered := 0
+	if err := c.Stream(context.Background(), "hi", func(string) { delivered++ }); err != nil {
+		t.Fatal(err)
+	}
+	if delivered < 400 || delivered > 600 {
+		t.Fatalf("%d of 1000 chunks delivered at a 50%% drop rate", delivered)
+	}
+}
+
+func TestChaosGatedAndOverridden(t *testing.T) {
+	c := &ChaosProvider{
+		Inner:       &ScriptedProvider{Chunks: []string{"ok"}},
+		ChaosConfig: ChaosConfig{ErrorRate: 1, DropRate: 1},
+	}
+	// without CHAOS_ENABLED the settings do nothing
+	prev := ChaosEnabled
+	ChaosEnabled = false
+	t.Cleanup(func() { ChaosEnabled = prev })
+	var got []string
+	if err := c.Stream(context.Background(), "hi", func(s string) { got = append(got, s) }); err != nil || joined(got) != "ok" {
+		t.Fatalf("disabled chaos: %q, %v; want the request untouched", joined(got), err)
+	}
+
+	// a per-request config replaces the provider's own
+	ChaosEnabled = true
+	got = nil
+	ctx := WithChaos(context.Background(), ChaosConfig{})
+	if err := c.Stream(ctx, "hi", func(s string) { got = append(got, s) }); err != nil || joined(got) != "ok" {
+		t.Fatalf("overridden chaos: %q, %v; want no faults", joined(got), err)
+	}
+	if err := c.Stream(context.Background(), "hi", func(string) {}); !errors.Is(err, ErrChaos) {
+		t.Fatalf("err = %v at error rate 1, want ErrChaos", err)
+	}
+}
@@ -0,0 +1,92 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// limiter bounds concurrent streams for one provider and counts those in flight.
+type limiter struct {
+	sem      chan struct{} // nil means unlimited
+	inFlight atomic.Int64
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*limiter{}
+)
+
+func limiterFor(name string) *limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[name]
+	if !ok {
+		l = &limiter{}
+		limiters[name] = l
+	}
+	return l
+}
+
+// SetProviderConcurrency limits how many streams may run against a provider at once.
+// Further calls to Stream block until a slot frees or their context is done.
+// n <= 0 removes the limit. Streams already running keep the slot they hold.
+func SetProviderConcurrency(name string, n int) {
+	l := limiterFor(name)
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if n <= 0 {
+		l.sem = nil
+		return
+	}
+	l.sem = make(chan struct{}, n)
+}
+
+// acquire waits for a slot on the named provider. The returned release must be called
+// once the stream ends.
+func acquire(ctx context.Context, name string) (release func(), err error) {
+	l := limiterFor(name)
+	limitersMu.Lock()
+	sem := l.sem
+	limitersMu.Unlock()
+
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	l.inFlight.Add(1)
+	return func() {
+		l.inFlight.Add(-1)
+		if sem != nil {
+			<-sem
+		}
+	}, nil
+}
+
+// InFlight returns the number of streams currently running per provider.
+func InFlight() map[string]int64 {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	out := make(map[string]int64, len(limiters))
+	for name, l := range limiters {
+		out[name] = l.inFlight.Load()
+	}
+	return out
+}
+
+// concurrencyFromEnv applies PROVIDER_CONCURRENCY_<NAME> (e.g. PROVIDER_CONCURRENCY_OLLAMA=1)
+// for every registered provider.
+func concurrencyFromEnv() {
+	for name := range providers {
+		key := "PROVIDER_CONCURRENCY_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+			SetProviderConcurrency(name, n)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedProvider blocks every stream until release is closed, counting how many run at once.
+type gatedProvider struct {
+	release chan struct{}
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (g *gatedProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	n := g.running.Add(1)
+	defer g.running.Add(-1)
+	for {
+		p := g.peak.Load()
+		if n <= p || g.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	select {
+	case <-g.release:
+		handler("done")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setConcurrency limits name to n streams for the duration of the test.
+func setConcurrency(t *testing.T, name string, n int) {
+	t.Helper()
+	SetProviderConcurrency(name, n)
+	t.Cleanup(func() {
+		limitersMu.Lock()
+		delete(limiters, name)
+		limitersMu.Unlock()
+	})
+}
+
+// eventually fails the test if cond doesn't hold within a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestProviderConcurrencyLimit(t *testing.T) {
+	gated := &gatedProvider{release: make(chan struct{})}
+	register(t, "conc-slow", gated)
+	register(t, "conc-other", &ScriptedProvider{Chunks: []string{"free"}})
+	setConcurrency(t, "conc-slow", 2)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := collect(t, context.Background(), "conc-slow", "hi")
+			errs <- err
+		}()
+	}
+	eventually(t, "two streams to start", func() bool { return gated.running.Load() == 2 })
+	time.Sleep(20 * time.Millisecond) // give the others a chance to get past the limit
+	if n := gated.running.Load(); n != 2 {
+		t.Fatalf("%d streams running with a limit of 2", n)
+	}
+	if n := InFlight()["conc-slow"]; n != 2 {
+		t.Fatalf("InFlight = %d, want the 2 holding a slot", n)
+	}
+
+	// a caller waiting for a slot gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := collect(t, ctx, "conc-slow", "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waiting stream err = %v, want its deadline", err)
+	}
+	// other providers are not held up
+	if chunks, err := collect(t, context.Background(), "conc-other", "hi"); err != nil || joined(chunks) != "free" {
+		t.Fatalf("other provider = %q, %v while conc-slow was full", joined(chunks), err)
+	}
+
+	close(gated.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("queued stream failed: %v", err)
+		}
+	}
+	if p := gated.peak.Load(); p != 2 {
+		t.Fatalf("peak concurrency %d, want 2", p)
+	}
+	if n := InFlight()["conc-slow"]; n != 0 {
+		t.Fatalf("InFlight = %d after every stream ended", n)
+	}
+}
@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+)
+
+// Validator is implemented by providers that can check their configuration without
+// making a request.
+type Validator interface {
+	Validate() error
+}
+
+// Validate checks the configuration of every registered provider and returns all
+// problems joined into one error, each prefixed with the provider name, or nil.
+func Validate() error {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if v, ok := providers[name].(Validator); ok {
+			err := v.Validate()
+			if err == nil {
+				continue
+			}
+			problems := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				problems = joined.Unwrap()
+			}
+			for _, p := range problems {
+				errs = append(errs, fmt.Errorf("provider %s: %w", name, p))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks that the endpoint is an absolute http(s) URL and, when
+// RequireAPIKey is set, that the API key environment variable is non-empty.
+func (h *HTTPProvider) Validate() error {
+	var errs []error
+	if h.Endpoint == "" {
+		errs = append(errs, errors.New("endpoint is empty"))
+	} else if u, err := url.Parse(h.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("endpoint %q is not an http(s) URL", h.Endpoint))
+	}
+	if h.RequireAPIKey {
+		if h.ApiKeyEnv == "" {
+			errs = append(errs, errors.New("API key required but no ApiKeyEnv set"))
+		} else if os.Getenv(h.ApiKeyEnv) == "" {
+			errs = append(errs, fmt.Errorf("API key required but %s is not set", h.ApiKeyEnv))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *SearchAugmentedProvider) Validate() error { return validateInner(s.Inner) }
+
+func (r *RAGProvider) Validate() error { return validateInner(r.Inner) }
+
+func (s *ShadowProvider) Validate() error {
+	// a broken shadow never affects clients, so only the primary matters
+	return validateInner(s.Primary)
+}
+
+func validateInner(p Provider) error {
+	if p == nil {
+		return errors.New("inner provider is nil")
+	}
+	if v, ok := p.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
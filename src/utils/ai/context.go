@@ -0,0 +1,140 @@
+package ai
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Options are per-request generation settings. Nil fields use the provider's defaults.
+type Options struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	// StopSequences end the response at the first match. Stream enforces them on the
+	// output itself; HTTPProvider also forwards them so the upstream can stop early.
+	StopSequences []string `json:"stop,omitempty"`
+}
+
+// withDefaults fills the fields o leaves unset from d.
+func (o Options) withDefaults(d Options) Options {
+	if o.Temperature == nil {
+		o.Temperature = d.Temperature
+	}
+	if o.MaxTokens == nil {
+		o.MaxTokens = d.MaxTokens
+	}
+	if len(o.StopSequences) == 0 {
+		o.StopSequences = d.StopSequences
+	}
+	return o
+}
+
+// optionsFromEnv reads a provider's default options from <prefix>_TEMPERATURE and
+// <prefix>_MAX_TOKENS. Invalid values are logged and left unset.
+func optionsFromEnv(prefix string) Options {
+	var opts Options
+	if v := os.Getenv(prefix + "_TEMPERATURE"); v != "" {
+		if t, err := strconv.ParseFloat(v, 64); err != nil || t < 0 || t > 2 {
+			log.Printf("ai: ignoring %s_TEMPERATURE=%q: must be a number between 0 and 2", prefix, v)
+		} else {
+			opts.Temperature = &t
+		}
+	}
+	if v := os.Getenv(prefix + "_MAX_TOKENS"); v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 {
+			log.Printf("ai: ignoring %s_MAX_TOKENS=%q: must be a positive integer", prefix, v)
+		} else {
+			opts.MaxTokens = &n
+		}
+	}
+	return opts
+}
+
+// Context keys set by Stream and by callers for the duration of a request:
+//
+//   - providerKey holds the provider name Stream resolved for the request. A nested
+//     Stream call with an empty provider name reuses it, so tools and sub-generations
+//     stay on the same provider as their parent.
+//   - optionsKey holds the request's Options, applied by HTTPProvider to its body.
+//   - requestIDKey holds the caller's ID for the request, used in log lines.
+type (
+	providerKey  struct{}
+	optionsKey   struct{}
+	requestIDKey struct{}
+)
+
+// WithProvider returns a context carrying the provider name for nested calls.
+func WithProvider(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, providerKey{}, name)
+}
+
+// ProviderFrom returns the provider name of the current request, or "" if none.
+func ProviderFrom(ctx context.Context) string {
+	name, _ := ctx.Value(providerKey{}).(string)
+	return name
+}
+
+// WithRequestID returns a context carrying an ID that identifies the request in logs.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID set with WithRequestID, or "" if none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithOptions returns a context carrying generation options for the request.
+func WithOptions(ctx context.Context, opts Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+// OptionsFrom returns the generation options of the current request.
+func OptionsFrom(ctx context.Context) Options {
+	opts, _ := ctx.Value(optionsKey{}).(Options)
+	return opts
+}
+
+// applyOptions adds opts to a request body. Ollama takes them under "options";
+// everything else gets OpenAI-style top-level fields, with the Responses API's
+// spelling for its format. Keys already set by a body builder are left alone.
+func applyOptions(body map[string]any, opts Options, format Format) {
+	if opts.Temperature == nil && opts.MaxTokens == nil && len(opts.StopSequences) == 0 {
+		return
+	}
+	ollama := format == FormatOllama
+	target := body
+	if ollama {
+		o, ok := body["options"].(map[string]any)
+		if !ok {
+			o = map[string]any{}
+			body["options"] = o
+		}
+		target = o
+	}
+	if opts.Temperature != nil {
+		if _, ok := target["temperature"]; !ok {
+			target["temperature"] = *opts.Temperature
+		}
+	}
+	if opts.MaxTokens != nil {
+		key := "max_tokens"
+		switch format {
+		case FormatOllama:
+			key = "num_predict"
+		case FormatOpenAIResponses:
+			key = "max_output_tokens"
+		}
+		if _, ok := target[key]; !ok {
+			target[key] = *opts.MaxTokens
+		}
+	}
+	// the Responses API has no stop parameter; Stream still enforces the sequences
+	if len(opts.StopSequences) > 0 && format != FormatOpenAIResponses {
+		if _, ok := target["stop"]; !ok {
+			target["stop"] = opts.StopSequences
+		}
+	}
+}
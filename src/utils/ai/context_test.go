@@ -0,0 +1,71 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEnvDefaultsInRequestBody(t *testing.T) {
+	bodies := make(chan map[string]any, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Errorf("body %q: %v", b, err)
+		}
+		bodies <- body
+		fmt.Fprintln(w, `{"response":"ok","done":true}`)
+	}))
+	defer upstream.Close()
+	t.Setenv("OLLAMA_TEMPERATURE", "0.3")
+	t.Setenv("OLLAMA_MAX_TOKENS", "128")
+	h := rawProvider(t, "env-options-test", upstream.URL)
+	h.Format = FormatOllama
+	h.Defaults = optionsFromEnv("OLLAMA")
+
+	options := func(ctx context.Context) map[string]any {
+		t.Helper()
+		if _, err := collect(t, ctx, "env-options-test", "hi"); err != nil {
+			t.Fatal(err)
+		}
+		o, _ := (<-bodies)["options"].(map[string]any)
+		return o
+	}
+	if o := options(context.Background()); o["temperature"] != 0.3 || o["num_predict"] != 128.0 {
+		t.Fatalf("options = %v, want the environment's temperature and num_predict", o)
+	}
+
+	// a request's own options win over the defaults, field by field
+	temp := 1.5
+	if o := options(WithOptions(context.Background(), Options{Temperature: &temp})); o["temperature"] != 1.5 || o["num_predict"] != 128.0 {
+		t.Fatalf("options = %v, want the request's temperature and the default num_predict", o)
+	}
+
+	// out-of-range and malformed values are logged and left to the upstream
+	t.Setenv("OLLAMA_TEMPERATURE", "5")
+	t.Setenv("OLLAMA_MAX_TOKENS", "lots")
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	h.Defaults = optionsFromEnv("OLLAMA")
+	if h.Defaults.Temperature != nil || h.Defaults.MaxTokens != nil {
+		t.Fatalf("defaults = %+v, want invalid values ignored", h.Defaults)
+	}
+	for _, want := range []string{`OLLAMA_TEMPERATURE="5"`, `OLLAMA_MAX_TOKENS="lots"`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log %q does not mention %s", logs.String(), want)
+		}
+	}
+	if o := options(context.Background()); o != nil {
+		t.Fatalf("options = %v, want none sent without valid defaults", o)
+	}
+}
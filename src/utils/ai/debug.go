@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"j-project/src/utils/redact"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DebugHTTP turns on logging of HTTPProvider request bodies and response prefixes.
+// It is off by default and enabled with LOG_LEVEL=debug. Bodies contain the full
+// prompt, so use it only while debugging an integration; registered secrets are still
+// scrubbed and the Authorization header is never logged.
+var DebugHTTP = strings.EqualFold(os.Getenv("LOG_LEVEL"), "debug")
+
+// DebugBodyLimit caps how many bytes of each request and response body are logged.
+// Set with LOG_DEBUG_BODY_LIMIT.
+var DebugBodyLimit = debugBodyLimit()
+
+func debugBodyLimit() int {
+	if n, err := strconv.Atoi(os.Getenv("LOG_DEBUG_BODY_LIMIT")); err == nil && n > 0 {
+		return n
+	}
+	return 2048
+}
+
+// debugRequest logs an outgoing request with its body. requestKey, if set, is the
+// request's own API key (see WithAPIKey) and is scrubbed too.
+func debugRequest(req *http.Request, body []byte, requestKey string) {
+	var headers []string
+	for k, v := range req.Header {
+		if strings.EqualFold(k, "Authorization") {
+			v = []string{"[redacted]"}
+		}
+		headers = append(headers, k+": "+strings.Join(v, ","))
+	}
+	log.Printf("http provider debug: %s %s headers={%s} body=%s",
+		req.Method, scrubKey(redact.Scrub(req.URL.Redacted()), requestKey),
+		scrubKey(redact.Scrub(strings.Join(headers, "; ")), requestKey), redact.Scrub(capped(body)))
+}
+
+// debugBody wraps a response body so that its first DebugBodyLimit bytes are logged
+// once the returned log function is called. requestKey is scrubbed as in debugRequest.
+func debugBody(resp *http.Response, body io.Reader, requestKey string) (io.Reader, func()) {
+	rec := &prefixRecorder{r: body, limit: DebugBodyLimit}
+	return rec, func() {
+		log.Printf("http provider debug: response status=%d content-type=%q body=%s",
+			resp.StatusCode, resp.Header.Get("Content-Type"), scrubKey(redact.Scrub(capped(rec.buf)), requestKey))
+	}
+}
+
+// prefixRecorder passes reads through while keeping the first limit bytes (plus one,
+// to tell whether there was more).
+type prefixRecorder struct {
+	r     io.Reader
+	limit int
+	buf   []byte
+}
+
+func (p *prefixRecorder) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if room := p.limit + 1 - len(p.buf); room > 0 {
+		p.buf = append(p.buf, b[:min(n, room)]...)
+	}
+	return n, err
+}
+
+// capped renders b up to DebugBodyLimit bytes, noting when it was cut.
+func capped(b []byte) string {
+	if len(b) <= DebugBodyLimit {
+		return string(b)
+	}
+	cut := DebugBodyLimit
+	for cut > 0 && !utf8.RuneStart(b[cut]) {
+		cut--
+	}
+	return string(b[:cut]) + "…(truncated)"
+}
+
+// PromptObserver is told the prompt a provider is about to send upstream, after
+// augmentation, templating and truncation. For bodies carrying a chat "messages" or
+// Responses "input" list it gets that list as JSON instead.
+type PromptObserver func(prompt string)
+
+type promptObserverKey struct{}
+
+// WithPromptObserver returns a context whose upstream prompts are reported to fn. A
+// fallback or retry reports each attempt.
+func WithPromptObserver(ctx context.Context, fn PromptObserver) context.Context {
+	return context.WithValue(ctx, promptObserverKey{}, fn)
+}
+
+// observePrompt reports prompt to the request's observer, if any.
+func observePrompt(ctx context.Context, prompt string) {
+	if fn, _ := ctx.Value(promptObserverKey{}).(PromptObserver); fn != nil {
+		fn(prompt)
+	}
+}
+
+// upstreamPrompt is what observePrompt reports for a request body built from prompt.
+func upstreamPrompt(body map[string]any, prompt string) string {
+	for _, field := range []string{"messages", "input"} {
+		if v, ok := body[field]; ok {
+			if s, ok := v.(string); ok {
+				return s
+			}
+			if b, err := json.Marshal(v); err == nil {
+				return string(b)
+			}
+		}
+	}
+	return prompt
+}
@@ -0,0 +1,68 @@
+package ai
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultDedupMinLength is the shortest chunk the de-duplication filter compares when
+// it is turned on with DEDUP_<NAME>=true rather than a length.
+const DefaultDedupMinLength = 16
+
+var (
+	dedupMu sync.RWMutex
+	dedups  = map[string]int{}
+)
+
+// SetChunkDedup turns on suppression of a chunk that exactly repeats the one before it,
+// as sent by providers (or buggy retries) that emit content twice. Only chunks of at
+// least minLen bytes, ignoring surrounding whitespace, are compared, so repeated short
+// tokens such as "the" or "very" in normal text pass through. minLen <= 0 turns it off.
+func SetChunkDedup(name string, minLen int) {
+	dedupMu.Lock()
+	defer dedupMu.Unlock()
+	if minLen <= 0 {
+		delete(dedups, name)
+		return
+	}
+	dedups[name] = minLen
+}
+
+func chunkDedup(name string) int {
+	dedupMu.RLock()
+	defer dedupMu.RUnlock()
+	return dedups[name]
+}
+
+// withDedup drops a chunk identical to the previous one when it is at least minLen long.
+func withDedup(minLen int, handler StreamHandler) StreamHandler {
+	var last string
+	return func(chunk string) {
+		if chunk == last && len(strings.TrimSpace(chunk)) >= minLen {
+			return
+		}
+		last = chunk
+		handler(chunk)
+	}
+}
+
+// dedupFromEnv applies DEDUP_<NAME> for every registered provider: "true" uses
+// DefaultDedupMinLength, a number sets the minimum length.
+func dedupFromEnv() {
+	for name := range providers {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		v := os.Getenv("DEDUP_" + key)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			if b, _ := strconv.ParseBool(v); b {
+				n = DefaultDedupMinLength
+			}
+		}
+		SetChunkDedup(name, n)
+	}
+}
@@ -0,0 +1,66 @@
+package ai
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestDedupDropsRepeatedChunk(t *testing.T) {
+	dup := "The capital of France is Paris. "
+	register(t, "dedup-test", &ScriptedProvider{Chunks: []string{dup, dup, "It is on the Seine.", "It is on the Seine."}})
+
+	chunks, err := collect(t, context.Background(), "dedup-test", "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 4 {
+		t.Fatalf("without dedup got %d chunks, want all 4", len(chunks))
+	}
+
+	SetChunkDedup("dedup-test", DefaultDedupMinLength)
+	t.Cleanup(func() { SetChunkDedup("dedup-test", 0) })
+	chunks, err = collect(t, context.Background(), "dedup-test", "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{dup, "It is on the Seine."}; !slices.Equal(chunks, want) {
+		t.Fatalf("chunks = %q, want %q", chunks, want)
+	}
+}
+
+func TestDedupKeepsLegitimateRepetition(t *testing.T) {
+	var out []string
+	h := withDedup(DefaultDedupMinLength, func(c string) { out = append(out, c) })
+	in := []string{
+		"very", " very", " very", " good",
+		// short repeats are words, not a duplicated chunk
+		"no", "no", " ", " ",
+		// a long chunk repeated later, but not right after itself
+		"and the results were in line with ", "expectations; ", "and the results were in line with ",
+	}
+	for _, c := range in {
+		h(c)
+	}
+	if !slices.Equal(out, in) {
+		t.Fatalf("chunks = %q, want every chunk kept", out)
+	}
+}
+
+func TestDedupFromEnv(t *testing.T) {
+	register(t, "dedup-env", &ScriptedProvider{})
+	register(t, "dedup-env-len", &ScriptedProvider{})
+	t.Setenv("DEDUP_DEDUP_ENV", "true")
+	t.Setenv("DEDUP_DEDUP_ENV_LEN", "40")
+	t.Cleanup(func() {
+		SetChunkDedup("dedup-env", 0)
+		SetChunkDedup("dedup-env-len", 0)
+	})
+	dedupFromEnv()
+	if n := chunkDedup("dedup-env"); n != DefaultDedupMinLength {
+		t.Fatalf("DEDUP_DEDUP_ENV=true set min length %d, want %d", n, DefaultDedupMinLength)
+	}
+	if n := chunkDedup("dedup-env-len"); n != 40 {
+		t.Fatalf("DEDUP_DEDUP_ENV_LEN=40 set min length %d", n)
+	}
+}
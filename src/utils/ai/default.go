@@ -0,0 +1,45 @@
+package ai
+
+import (
+	"j-project/src/utils/events"
+	"log"
+	"os"
+	"sync"
+)
+
+var (
+	defaultMu   sync.RWMutex
+	defaultName = "mock"
+)
+
+// DefaultProvider returns the provider Stream uses when a request names none.
+func DefaultProvider() string {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultName
+}
+
+// SetDefaultProvider changes the provider used for requests that name none. The name
+// must be registered. Streams already running keep their provider.
+func SetDefaultProvider(name string) error {
+	if _, err := Lookup(name); err != nil {
+		return err
+	}
+	defaultMu.Lock()
+	prev := defaultName
+	defaultName = name
+	defaultMu.Unlock()
+	events.Publish(events.Event{Type: events.ProviderDefault, Provider: name, Fields: map[string]any{"previous": prev}})
+	return nil
+}
+
+// defaultProviderFromEnv applies DEFAULT_PROVIDER once every provider is registered.
+func defaultProviderFromEnv() {
+	name := os.Getenv("DEFAULT_PROVIDER")
+	if name == "" {
+		return
+	}
+	if err := SetDefaultProvider(name); err != nil {
+		log.Printf("DEFAULT_PROVIDER: %v, keeping %q", err, DefaultProvider())
+	}
+}
@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStreamWithDoneContext(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer upstream.Close()
+	var calls atomic.Int32
+	inner := providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		calls.Add(1)
+		handler("inner")
+		return nil
+	})
+	var searches atomic.Int32
+	registerSearcher(t, "done-counting", WebSearcherFunc(func(context.Context, string) ([]string, error) {
+		searches.Add(1)
+		return []string{"result"}, nil
+	}))
+	// the interceptor runs before the client would notice the context itself
+	h := NewHTTPProvider(upstream.URL, "", "", true)
+	h.RequestInterceptor = func(*http.Request) error { hits.Add(1); return nil }
+	register(t, "done-inner", inner)
+	register(t, "done-http", h)
+
+	providers := map[string]Provider{
+		"mock":     &MockProvider{},
+		"scripted": &ScriptedProvider{Chunks: []string{"a", "b"}},
+		"http":     h,
+		"search":   NewSearchAugmentedProvider(inner, "done-counting", SearchFailProceed),
+		"rag":      NewRAGProvider(inner, NewKeywordRetriever([]string{"doc"}), 1),
+		"chaos":    &ChaosProvider{Inner: inner},
+		"shadow":   NewShadowProvider(inner, inner, 1),
+		"fallback": NewFallbackProvider(0, 1, "done-inner"),
+		"balanced": NewLoadBalancedProvider(BalanceRoundRobin, "done-inner"),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, p := range providers {
+		var chunks []string
+		if err := p.Stream(ctx, "hello", func(c string) { chunks = append(chunks, c) }); !errors.Is(err, context.Canceled) || len(chunks) != 0 {
+			t.Errorf("%s: %d chunks, err %v; want context.Canceled and no output", name, len(chunks), err)
+		}
+	}
+	for _, name := range []string{"done-inner", "done-http", "no-such-provider"} {
+		if chunks, err := collect(t, ctx, name, "hello"); !errors.Is(err, context.Canceled) || len(chunks) != 0 {
+			t.Errorf("Stream(%q): %d chunks, err %v; want context.Canceled and no output", name, len(chunks), err)
+		}
+	}
+	if calls.Load() != 0 || searches.Load() != 0 || hits.Load() != 0 {
+		t.Fatalf("%d inner calls, %d searches, %d requests built; want no work for a done context",
+			calls.Load(), searches.Load(), hits.Load())
+	}
+}
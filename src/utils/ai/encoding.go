@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// decodedBody returns the response body with any Content-Encoding removed.
+//
+// net/http only decompresses transparently when it added Accept-Encoding itself, so a
+// gateway that compresses on its own leaves us with raw gzip/deflate bytes. Both
+// decompressors return data as soon as a compressed block is complete, so streaming
+// still works as long as the upstream flushes its compressor per chunk; if it doesn't,
+// chunks simply arrive in larger batches.
+func decodedBody(resp *http.Response) (io.Reader, error) {
+	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch enc {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, &ProviderError{Msg: "gzip body", Err: err}
+		}
+		return zr, nil
+	case "deflate":
+		// "deflate" is specified as zlib-wrapped, but some servers send raw deflate
+		br := bufio.NewReader(resp.Body)
+		if hdr, err := br.Peek(2); err == nil && isZlibHeader(hdr) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, &ProviderError{Msg: "deflate body", Err: err}
+			}
+			return zr, nil
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, &ProviderError{Msg: "unsupported Content-Encoding " + enc}
+	}
+}
+
+// isZlibHeader reports whether b starts with a valid zlib header (RFC 1950).
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// utf8Body transcodes body to UTF-8 from charset, or when that is empty from the
+// charset declared in the response's Content-Type. Bodies without one are taken to be
+// UTF-8 already, as are bodies in a charset we don't know (which is logged).
+// Single-byte charsets decode byte by byte, so streaming is unaffected.
+func utf8Body(resp *http.Response, body io.Reader, charset string) io.Reader {
+	if charset == "" {
+		if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+			charset = params["charset"]
+		}
+	}
+	if charset == "" {
+		return body
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		log.Printf("http provider: unknown charset %q, reading the body as UTF-8", charset)
+		return body
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return body
+	}
+	return enc.NewDecoder().Reader(body)
+}
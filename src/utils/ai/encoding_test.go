@@ -0,0 +1,121 @@
+package ai
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// ndjsonLines is an Ollama-style streamed response.
+var ndjsonLines = []string{
+	`{"response":"Hel","done":false}`,
+	`{"response":"lo, ","done":false}`,
+	`{"response":"world","done":false}`,
+	`{"response":"","done":true}`,
+}
+
+// compressedUpstream streams ndjsonLines compressed with the given encoding, flushing
+// after every line as a streaming gateway does.
+func compressedUpstream(t *testing.T, encoding string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", encoding)
+		var zw interface {
+			io.Writer
+			Flush() error
+			Close() error
+		}
+		switch encoding {
+		case "gzip":
+			zw = gzip.NewWriter(w)
+		case "deflate":
+			zw = zlib.NewWriter(w)
+		case "raw-deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			zw, _ = flate.NewWriter(w, flate.DefaultCompression)
+		}
+		for _, line := range ndjsonLines {
+			io.WriteString(zw, line+"\n")
+			zw.Flush()
+			w.(http.Flusher).Flush()
+		}
+		zw.Close()
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestCompressedStreams(t *testing.T) {
+	for _, enc := range []string{"gzip", "deflate", "raw-deflate"} {
+		t.Run(enc, func(t *testing.T) {
+			upstream := compressedUpstream(t, enc)
+			h := NewHTTPProvider(upstream.URL, "", "", true)
+			h.Format = FormatNDJSON
+			// a transport that leaves Content-Encoding to the provider, as it is when the
+			// gateway compresses without being asked
+			h.Client = &http.Client{Transport: &http.Transport{DisableCompression: true}}
+			register(t, "encoding-test", h)
+
+			chunks, err := collect(t, context.Background(), "encoding-test", "hi")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"Hel", "lo, ", "world"}; !slices.Equal(chunks, want) {
+				t.Fatalf("chunks = %q, want %q", chunks, want)
+			}
+		})
+	}
+}
+
+func TestUnsupportedContentEncoding(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Content-Encoding": {"br"}}, Body: io.NopCloser(strings.NewReader(""))}
+	if _, err := decodedBody(resp); err == nil || !strings.Contains(err.Error(), "unsupported Content-Encoding br") {
+		t.Fatalf("decodedBody with br = %v, want an unsupported encoding error", err)
+	}
+}
+
+func TestResponseCharset(t *testing.T) {
+	// "Café à la crème" in ISO-8859-1, and in Shift_JIS "日本"
+	latin1 := "{\"response\":\"Caf\xe9 \xe0 la cr\xe8me\"}\n"
+	sjis := "{\"response\":\"\x93\xfa\x96\x7b\"}\n"
+	tests := []struct {
+		name        string
+		contentType string
+		charset     string
+		body        string
+		want        string
+	}{
+		{"declared latin-1", "application/x-ndjson; charset=ISO-8859-1", "", latin1, "Café à la crème"},
+		{"declared shift_jis", "application/x-ndjson; charset=shift_jis", "", sjis, "日本"},
+		{"utf-8 by default", "application/x-ndjson", "", "{\"response\":\"Café\"}\n", "Café"},
+		// the configured charset wins over a wrong declaration
+		{"configured", "application/x-ndjson; charset=utf-8", "latin1", latin1, "Café à la crème"},
+		{"unknown charset read as utf-8", "application/x-ndjson; charset=x-bogus", "", "{\"response\":\"Café\"}\n", "Café"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+			defer upstream.Close()
+			h := rawProvider(t, "charset-test", upstream.URL)
+			h.Format, h.Charset = FormatNDJSON, tt.charset
+
+			chunks, err := collect(t, context.Background(), "charset-test", "hi")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := joined(chunks); got != tt.want {
+				t.Fatalf("decoded %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package ai
+
+import (
+	"errors"
+	"strconv"
+)
+
+var (
+	// ErrProviderNotFound is returned by Lookup for names that aren't registered.
+	ErrProviderNotFound = errors.New("provider not found")
+	// ErrEmptyPrompt is returned by providers given a blank prompt.
+	ErrEmptyPrompt = errors.New("empty prompt")
+	// ErrLineTooLong is wrapped when a streamed record exceeds the provider's limit.
+	ErrLineTooLong = errors.New("stream line too long")
+	// ErrResponseTooLarge is wrapped when a non-streamed body exceeds the provider's limit.
+	ErrResponseTooLarge = errors.New("response too large")
+	// ErrHandlerPanic is returned by Stream when the caller's handler panicked.
+	ErrHandlerPanic = errors.New("stream handler panicked")
+	// ErrSearchBlocked is wrapped when a searcher answers with something other than
+	// results, typically a rate-limit or captcha page.
+	ErrSearchBlocked = errors.New("search rate-limited or blocked")
+	// ErrShuttingDown is the cause of web searches cancelled by Shutdown.
+	ErrShuttingDown = errors.New("shutting down")
+)
+
+// ProviderError is a failure reported by or while talking to an upstream provider.
+// StatusCode and Body are set when the upstream answered with an HTTP error; a 200
+// response carrying an error field has StatusCode 200.
+type ProviderError struct {
+	Provider   string // registered provider name; filled in by Stream when known
+	StatusCode int
+	Body       string
+	Msg        string
+	Err        error // underlying cause, if any
+}
+
+func (e *ProviderError) Error() string {
+	s := "provider"
+	if e.Provider != "" {
+		s += " " + e.Provider
+	}
+	if e.Msg != "" {
+		s += ": " + e.Msg
+	}
+	if e.StatusCode != 0 && e.StatusCode != 200 {
+		s += " (status " + strconv.Itoa(e.StatusCode) + ")"
+	}
+	if e.Body != "" {
+		s += " body: " + e.Body
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+// SearchError is a failure from a web searcher.
+type SearchError struct {
+	Searcher   string
+	StatusCode int
+	Body       string
+	Msg        string
+	Err        error
+}
+
+func (e *SearchError) Error() string {
+	s := "search"
+	if e.Searcher != "" {
+		s += " " + e.Searcher
+	}
+	if e.Msg != "" {
+		s += ": " + e.Msg
+	}
+	if e.StatusCode != 0 {
+		s += " (status " + strconv.Itoa(e.StatusCode) + ")"
+	}
+	if e.Body != "" {
+		s += " body: " + e.Body
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *SearchError) Unwrap() error { return e.Err }
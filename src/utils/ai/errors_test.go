@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupUnknownProvider(t *testing.T) {
+	_, err := Lookup("no-such-provider")
+	if !errors.Is(err, ErrProviderNotFound) {
+		t.Fatalf("Lookup = %v, want ErrProviderNotFound", err)
+	}
+}
+
+func TestEmptyPromptError(t *testing.T) {
+	if _, err := collect(t, context.Background(), "mock", "  \n"); !errors.Is(err, ErrEmptyPrompt) {
+		t.Fatalf("blank prompt err = %v, want ErrEmptyPrompt", err)
+	}
+}
+
+func TestProviderErrorFromBadStatus(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, "slow down")
+	}))
+	defer upstream.Close()
+	rawProvider(t, "status-test", upstream.URL)
+
+	_, err := collect(t, context.Background(), "status-test", "hi")
+	var pe *ProviderError
+	if !errors.As(fmt.Errorf("wrapped: %w", err), &pe) {
+		t.Fatalf("err = %v, want a ProviderError", err)
+	}
+	if pe.Provider != "status-test" || pe.StatusCode != http.StatusTooManyRequests || pe.Body != "slow down" {
+		t.Fatalf("ProviderError = %+v", pe)
+	}
+	if want := "provider status-test: bad status (status 429) body: slow down"; pe.Error() != want {
+		t.Fatalf("Error() = %q, want %q", pe.Error(), want)
+	}
+}
+
+func TestSearchErrorUnwraps(t *testing.T) {
+	err := fmt.Errorf("search augmentation: %w", &SearchError{Searcher: "duckduckgo", Msg: "got an HTML page instead of JSON", Err: ErrSearchBlocked})
+	var se *SearchError
+	if !errors.As(err, &se) || se.Searcher != "duckduckgo" || !errors.Is(err, ErrSearchBlocked) {
+		t.Fatalf("err = %v, want a SearchError wrapping ErrSearchBlocked", err)
+	}
+	if want := "search duckduckgo: got an HTML page instead of JSON: search rate-limited or blocked"; se.Error() != want {
+		t.Fatalf("Error() = %q, want %q", se.Error(), want)
+	}
+}
@@ -0,0 +1,145 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"j-project/src/utils/events"
+	"j-project/src/utils/redact"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrBudgetExhausted is returned by FallbackProvider when its retry budget runs out
+// before any provider succeeds.
+var ErrBudgetExhausted = errors.New("fallback budget exhausted")
+
+// FallbackProvider tries the named providers in order, retrying each up to Retries
+// times before moving to the next. Providers that aren't Healthy (breaker open or a
+// failing health check) are moved to the end, so the chain starts with the first
+// healthy one and keeps the configured order among the healthy ones. All attempts
+// share one budget: Budget caps the total time across the whole chain and MaxAttempts
+// the total number of attempts, so retries on an early provider can't multiply the
+// latency of the fallback. Once output has reached the client a failure is returned
+// as is, since switching providers mid-answer would repeat or garble it.
+//
+// Attempts run through Stream, so breakers and concurrency limits apply per provider.
+// With a Budget the attempts carry a deadline, which replaces the providers' own
+// inactivity timeouts.
+type FallbackProvider struct {
+	Providers   []string
+	Retries     int           // extra attempts per provider
+	Budget      time.Duration // total time for all attempts; zero means no cap
+	MaxAttempts int           // total attempts across the chain; zero means no cap
+}
+
+// NewFallbackProvider creates a chain over the named providers.
+func NewFallbackProvider(budget time.Duration, retries int, providers ...string) *FallbackProvider {
+	return &FallbackProvider{Providers: providers, Retries: retries, Budget: budget}
+}
+
+func (f *FallbackProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(f.Providers) == 0 {
+		return errors.New("fallback: no providers configured")
+	}
+	if f.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Budget)
+		defer cancel()
+	}
+	emitted := false
+	counting := func(chunk string) {
+		emitted = true
+		handler(chunk)
+	}
+
+	order := healthFirst(f.Providers)
+	var lastErr error
+	attempts := 0
+	for i, name := range order {
+		for try := 0; try <= f.Retries; try++ {
+			if f.MaxAttempts > 0 && attempts >= f.MaxAttempts {
+				return fmt.Errorf("%w after %d attempts: %w", ErrBudgetExhausted, attempts, lastErr)
+			}
+			if try > 0 && !sleepCtx(ctx, time.Duration(try)*100*time.Millisecond) {
+				break
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			attempts++
+			if res := ResultFrom(ctx); res != nil {
+				res.FinishReason = "" // don't carry a failed attempt's reason over
+			}
+			err := Stream(ctx, name, prompt, counting)
+			if err == nil || emitted {
+				return err
+			}
+			lastErr = err
+			log.Printf("fallback: %s attempt %d failed: %s", name, try+1, redact.Scrub(err.Error()))
+		}
+		if i+1 < len(order) && ctx.Err() == nil {
+			events.Publish(events.Event{Type: events.ProviderSwitch, Provider: order[i+1], RequestID: RequestIDFrom(ctx),
+				Fields: map[string]any{"from": name}})
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %d attempts in %s: %w", ErrBudgetExhausted, attempts, f.Budget, lastErr)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return lastErr
+}
+
+// healthFirst returns names with the healthy providers first, each group in its
+// original order.
+func healthFirst(names []string) []string {
+	out := make([]string, 0, len(names))
+	var sick []string
+	for _, name := range names {
+		if target, err := resolveAlias(name); err == nil && Healthy(target) {
+			out = append(out, name)
+		} else {
+			sick = append(sick, name)
+		}
+	}
+	return append(out, sick...)
+}
+
+// splitList splits a comma-separated list, dropping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// sleepCtx waits for d and reports false if ctx ended first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (f *FallbackProvider) Capabilities() Capabilities {
+	if len(f.Providers) == 0 {
+		return Capabilities{}
+	}
+	return ProviderCapabilities(f.Providers[0])
+}
@@ -0,0 +1,140 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingProvider fails every stream after delay, counting the attempts.
+func failingProvider(delay time.Duration, calls *atomic.Int32) Provider {
+	return providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		calls.Add(1)
+		if !sleepCtx(ctx, delay) {
+			return ctx.Err()
+		}
+		return &ProviderError{StatusCode: 500, Msg: "bad status"}
+	})
+}
+
+func TestFallbackMovesDownTheChain(t *testing.T) {
+	var first atomic.Int32
+	register(t, "fb-first", failingProvider(0, &first))
+	register(t, "fb-second", &ScriptedProvider{Chunks: []string{"second"}})
+
+	var got []string
+	err := NewFallbackProvider(0, 1, "fb-first", "fb-second").Stream(context.Background(), "hi", func(c string) { got = append(got, c) })
+	if err != nil || joined(got) != "second" {
+		t.Fatalf("Stream = %q, %v; want the second provider's answer", joined(got), err)
+	}
+	if n := first.Load(); n != 2 {
+		t.Fatalf("first provider tried %d times, want 1 + 1 retry", n)
+	}
+}
+
+func TestFallbackTimeBudget(t *testing.T) {
+	var a, b atomic.Int32
+	register(t, "fb-slow-a", failingProvider(40*time.Millisecond, &a))
+	register(t, "fb-slow-b", failingProvider(40*time.Millisecond, &b))
+
+	f := NewFallbackProvider(100*time.Millisecond, 5, "fb-slow-a", "fb-slow-b")
+	start := time.Now()
+	err := f.Stream(context.Background(), "hi", func(string) {})
+	elapsed := time.Since(start)
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("err = %v, want ErrBudgetExhausted", err)
+	}
+	// the budget stops the retries long before 2 providers x 6 attempts
+	if n := a.Load() + b.Load(); n > 3 {
+		t.Fatalf("%d attempts within a 100ms budget", n)
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("fallback took %s with a 100ms budget", elapsed)
+	}
+}
+
+func TestFallbackMaxAttempts(t *testing.T) {
+	var a, b atomic.Int32
+	register(t, "fb-a", failingProvider(0, &a))
+	register(t, "fb-b", failingProvider(0, &b))
+
+	f := NewFallbackProvider(0, 2, "fb-a", "fb-b")
+	f.MaxAttempts = 4
+	err := f.Stream(context.Background(), "hi", func(string) {})
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("err = %v, want ErrBudgetExhausted", err)
+	}
+	var pe *ProviderError
+	if !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want the last provider error kept", err)
+	}
+	if a.Load() != 3 || b.Load() != 1 {
+		t.Fatalf("attempts = %d + %d, want 3 on the first and 1 on the second", a.Load(), b.Load())
+	}
+}
+
+func TestFallbackAfterOutputReturnsError(t *testing.T) {
+	var second atomic.Int32
+	register(t, "fb-partial", &ScriptedProvider{Chunks: []string{"half an answer"}, Err: errors.New("dropped")})
+	register(t, "fb-unused", failingProvider(0, &second))
+
+	var got []string
+	err := NewFallbackProvider(0, 2, "fb-partial", "fb-unused").Stream(context.Background(), "hi", func(c string) { got = append(got, c) })
+	if err == nil || joined(got) != "half an answer" {
+		t.Fatalf("Stream = %q, %v; want the partial answer and its error", joined(got), err)
+	}
+	if second.Load() != 0 {
+		t.Fatal("fell back after output had reached the client")
+	}
+}
+
+// openBreaker trips name's breaker.
+func openBreaker(name string) {
+	b := breakerFor(name)
+	for range BreakerThreshold {
+		b.Allow()
+		b.Record(true)
+	}
+}
+
+func TestFallbackSkipsUnhealthyFirst(t *testing.T) {
+	var tripped, failing, second atomic.Int32
+	register(t, "fb-tripped", failingProvider(0, &tripped))
+	register(t, "fb-failing-check", failingProvider(0, &failing))
+	register(t, "fb-healthy", providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		second.Add(1)
+		handler("healthy")
+		return nil
+	}))
+	openBreaker("fb-tripped")
+	ReportHealth("fb-failing-check", errors.New("health check failed"))
+	t.Cleanup(func() { ReportHealth("fb-failing-check", nil) })
+
+	var got []string
+	f := NewFallbackProvider(0, 2, "fb-tripped", "fb-failing-check", "fb-healthy")
+	if err := f.Stream(context.Background(), "hi", func(c string) { got = append(got, c) }); err != nil || joined(got) != "healthy" {
+		t.Fatalf("Stream = %q, %v; want the healthy provider's answer", joined(got), err)
+	}
+	if tripped.Load() != 0 || failing.Load() != 0 || second.Load() != 1 {
+		t.Fatalf("calls = %d, %d, %d; want the chain to go straight to the healthy provider",
+			tripped.Load(), failing.Load(), second.Load())
+	}
+}
+
+func TestHealthFirstKeepsOrder(t *testing.T) {
+	for _, name := range []string{"hf-a", "hf-b", "hf-c", "hf-d"} {
+		register(t, name, &ScriptedProvider{})
+	}
+	withAlias(t, "hf-alias", "hf-c")
+	openBreaker("hf-a")
+	openBreaker("hf-c")
+
+	got := healthFirst([]string{"hf-a", "hf-b", "hf-alias", "hf-d"})
+	// healthy in their order, then the unhealthy ones, an alias judged by its target
+	if want := []string{"hf-b", "hf-d", "hf-a", "hf-alias"}; !slices.Equal(got, want) {
+		t.Fatalf("healthFirst = %q, want %q", got, want)
+	}
+}
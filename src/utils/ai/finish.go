@@ -0,0 +1,61 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// FinishReason says why a response ended, in one vocabulary across providers.
+type FinishReason string
+
+const (
+	FinishStop          FinishReason = "stop"           // the model finished, or a stop sequence was hit
+	FinishLength        FinishReason = "length"         // the token limit was reached
+	FinishContentFilter FinishReason = "content_filter" // the provider withheld the rest
+	FinishError         FinishReason = "error"          // the stream failed
+)
+
+// NormalizeFinishReason maps a provider's spelling (OpenAI chat completions and
+// Responses, Anthropic, Ollama) onto a FinishReason. Unknown non-empty values are
+// reported as FinishStop, empty ones as "".
+func NormalizeFinishReason(s string) FinishReason {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return ""
+	case "length", "max_tokens", "max_output_tokens":
+		return FinishLength
+	case "content_filter", "refusal", "safety":
+		return FinishContentFilter
+	case "error":
+		return FinishError
+	default: // stop, end_turn, stop_sequence, tool_calls, tool_use, completed, ...
+		return FinishStop
+	}
+}
+
+// setFinishReason records the finish reason a provider reported for the request.
+func setFinishReason(ctx context.Context, reason string) {
+	if res := ResultFrom(ctx); res != nil {
+		if r := NormalizeFinishReason(reason); r != "" {
+			res.FinishReason = r
+		}
+	}
+}
+
+// finishResult settles the request's finish reason once the stream is over. A failure
+// keeps a length or content_filter reason the provider reported, since that explains
+// it; any other failure is FinishError. A success without a reported reason is FinishStop.
+func finishResult(ctx context.Context, err error) {
+	res := ResultFrom(ctx)
+	if res == nil {
+		return
+	}
+	switch {
+	case err != nil && !errors.Is(err, context.Canceled) && (res.FinishReason == FinishLength || res.FinishReason == FinishContentFilter):
+	case err != nil:
+		res.FinishReason = FinishError
+	case res.FinishReason == "" || res.FinishReason == FinishError:
+		res.FinishReason = FinishStop
+	}
+}
@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Format names the wire format of an HTTPProvider's streamed responses.
+type Format string
+
+const (
+	// FormatOllama is Ollama's /api/generate NDJSON: content in "response", reasoning in
+	// "thinking". Generation options are sent under "options".
+	FormatOllama Format = "ollama"
+	// FormatNDJSON is one JSON object per line with the content in "response",
+	// "content" or "text", whichever is present.
+	FormatNDJSON Format = "ndjson"
+	// FormatOpenAISSE is an OpenAI-style chat completions server-sent event stream.
+	FormatOpenAISSE Format = "openai-sse"
+	// FormatOpenAIResponses is an OpenAI Responses API event stream
+	// (response.output_text.delta and friends).
+	FormatOpenAIResponses Format = "openai-responses"
+	// FormatRaw passes every non-empty line through as a chunk.
+	FormatRaw Format = "raw"
+)
+
+// format returns the provider's Format. When Format is unset it falls back to the old
+// endpoint heuristic: URLs containing "ollama" or port 11434 are treated as Ollama and
+// everything else as raw lines.
+//
+// The heuristic is deprecated; set Format explicitly, since sniffing misfires for gateways on
+// those ports and for Ollama behind a custom URL.
+func (h *HTTPProvider) format() Format {
+	if h.Format != "" {
+		return h.Format
+	}
+	ep := strings.ToLower(h.Endpoint)
+	if strings.Contains(ep, "ollama") || strings.Contains(ep, "11434") {
+		return FormatOllama
+	}
+	return FormatRaw
+}
+
+// parseNDJSONLine extracts the content of one generic JSON line. Lines that aren't
+// JSON objects are ignored.
+func parseNDJSONLine(line string) (string, bool, error) {
+	var v struct {
+		Response *string `json:"response"`
+		Content  *string `json:"content"`
+		Text     *string `json:"text"`
+		Done     bool    `json:"done"`
+	}
+	if err := json.Unmarshal([]byte(line), &v); err != nil {
+		return "", false, nil
+	}
+	for _, s := range []*string{v.Response, v.Content, v.Text} {
+		if s != nil {
+			return *s, v.Done, nil
+		}
+	}
+	return "", v.Done, nil
+}
+
+// FormBodyEncoder is a BodyEncoder for endpoints that take form posts. It sends the
+// body as application/x-www-form-urlencoded; strings, numbers and booleans become
+// plain values and anything else (nested options, lists) is JSON-encoded.
+func FormBodyEncoder(body map[string]any) ([]byte, string, error) {
+	form := url.Values{}
+	for k, v := range body {
+		switch v := v.(type) {
+		case string:
+			form.Set(k, v)
+		case bool, int, int64, float64:
+			form.Set(k, fmt.Sprint(v))
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, "", fmt.Errorf("field %s: %w", k, err)
+			}
+			form.Set(k, string(b))
+		}
+	}
+	return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+}
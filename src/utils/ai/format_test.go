@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFormatHeuristic(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		format   Format
+		want     Format
+	}{
+		{"http://localhost:11434/api/generate", "", FormatOllama},
+		{"https://ollama.internal/api/generate", "", FormatOllama},
+		{"https://gateway.example/v1/generate", "", FormatRaw},
+		// an explicit Format wins over what the URL looks like
+		{"http://gateway:11434/v1/chat/completions", FormatOpenAISSE, FormatOpenAISSE},
+		{"https://models.example/ollama", FormatRaw, FormatRaw},
+	}
+	for _, tt := range tests {
+		h := &HTTPProvider{Endpoint: tt.endpoint, Format: tt.format}
+		if got := h.format(); got != tt.want {
+			t.Errorf("format(%q, %q) = %q, want %q", tt.endpoint, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestStreamFormats(t *testing.T) {
+	tests := []struct {
+		format    Format
+		body      string
+		want      []string
+		reasoning string
+	}{
+		{FormatOllama, `{"thinking":"hmm","response":""}` + "\n" + `{"response":"Hi"}` + "\n" + `{"response":" there","done":true,"done_reason":"stop"}`,
+			[]string{"Hi", " there"}, "hmm"},
+		{FormatNDJSON, `{"content":"Hi"}` + "\n" + `{"text":" there"}` + "\n" + `not json`,
+			[]string{"Hi", " there"}, ""},
+		{FormatOpenAISSE, `data: {"choices":[{"delta":{"content":"Hi"}}]}` + "\n\n" + `data: {"choices":[{"delta":{"content":" there"}}]}` + "\n\ndata: [DONE]\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"ignored\"}}]}",
+			[]string{"Hi", " there"}, ""},
+		{FormatOpenAIResponses, "event: response.output_text.delta\n" + `data: {"type":"response.reasoning_text.delta","delta":"hmm"}` + "\n" +
+			`data: {"type":"response.output_text.delta","delta":"Hi"}` + "\n" + `data: {"type":"response.output_text.delta","delta":" there"}` + "\n" + `data: {"type":"response.completed"}`,
+			[]string{"Hi", " there"}, "hmm"},
+		{FormatRaw, "Hi\n\n there", []string{"Hi", "there"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var sent map[string]any
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&sent)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer upstream.Close()
+			h := NewHTTPProvider(upstream.URL, "", "m", true)
+			h.Format = tt.format
+			register(t, "format-test", h)
+
+			var reasoning strings.Builder
+			ctx := WithReasoning(context.Background(), func(c string) { reasoning.WriteString(c) })
+			chunks, err := collect(t, ctx, "format-test", "hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(chunks, tt.want) {
+				t.Fatalf("chunks = %q, want %q", chunks, tt.want)
+			}
+			if reasoning.String() != tt.reasoning {
+				t.Fatalf("reasoning = %q, want %q", reasoning.String(), tt.reasoning)
+			}
+			if sent["prompt"] != "hello" || sent["model"] != "m" || sent["stream"] != true {
+				t.Fatalf("request body = %v", sent)
+			}
+		})
+	}
+}
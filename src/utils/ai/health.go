@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"j-project/src/utils/redact"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthChecker is implemented by providers that can check their upstream without
+// running a prompt.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+var (
+	healthMu  sync.RWMutex
+	unhealthy = map[string]error{}
+)
+
+// ReportHealth records the outcome of a health check on the named provider. A non-nil
+// err marks it unhealthy until a later check passes.
+func ReportHealth(name string, err error) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	prev, was := unhealthy[name]
+	if err == nil {
+		delete(unhealthy, name)
+		if was {
+			log.Printf("health: %s recovered", name)
+		}
+		return
+	}
+	unhealthy[name] = err
+	if !was || prev.Error() != err.Error() {
+		log.Printf("health: %s unhealthy: %s", name, redact.Scrub(err.Error()))
+	}
+}
+
+// Healthy reports whether the named provider's breaker is not open and its last
+// health check, if any, passed.
+func Healthy(name string) bool {
+	if breakerFor(name).State() == BreakerOpen {
+		return false
+	}
+	healthMu.RLock()
+	defer healthMu.RUnlock()
+	_, bad := unhealthy[name]
+	return !bad
+}
+
+// CheckHealth runs the health check of every registered HealthChecker and records the
+// results with ReportHealth.
+func CheckHealth(ctx context.Context) {
+	checkers := map[string]HealthChecker{}
+	for name, p := range providers {
+		if hc, ok := p.(HealthChecker); ok {
+			checkers[name] = hc
+		}
+	}
+	var wg sync.WaitGroup
+	for name, hc := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ReportHealth(name, hc.CheckHealth(ctx))
+		}()
+	}
+	wg.Wait()
+}
+
+// RunHealthChecks calls CheckHealth every interval, each round bounded by the interval,
+// until ctx ends.
+func RunHealthChecks(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		CheckHealth(checkCtx)
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// CheckHealth sends a GET to HealthEndpoint and expects a 2xx answer. Without a
+// HealthEndpoint the provider is always healthy.
+func (h *HTTPProvider) CheckHealth(ctx context.Context) error {
+	if h.HealthEndpoint == "" {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.HealthEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	client := h.Client
+	if client == nil {
+		client = sharedHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check: status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// register makes p available as name for the duration of the test.
+func register(t testing.TB, name string, p Provider) {
+	t.Helper()
+	prev, had := providers[name]
+	Register(name, p)
+	t.Cleanup(func() {
+		if had {
+			providers[name] = prev
+		} else {
+			delete(providers, name)
+		}
+		breakersMu.Lock()
+		delete(breakers, name)
+		breakersMu.Unlock()
+	})
+}
+
+// collect streams prompt through the named provider and returns the chunks.
+func collect(t *testing.T, ctx context.Context, name, prompt string) ([]string, error) {
+	t.Helper()
+	var chunks []string
+	err := Stream(ctx, name, prompt, func(c string) { chunks = append(chunks, c) })
+	return chunks, err
+}
+
+// joined is the concatenated output of chunks.
+func joined(chunks []string) string { return strings.Join(chunks, "") }
+
+// providerFunc adapts a function to Provider.
+type providerFunc func(ctx context.Context, prompt string, handler StreamHandler) error
+
+func (f providerFunc) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	return f(ctx, prompt, handler)
+}
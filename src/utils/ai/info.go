@@ -0,0 +1,59 @@
+package ai
+
+// ProviderInfo describes the provider Stream would use for a name, without calling it.
+type ProviderInfo struct {
+	Requested string `json:"requested"`
+	Name      string `json:"provider"` // resolved provider name
+	Fallback  bool   `json:"fallback"` // the requested name wasn't registered
+	Model     string `json:"model,omitempty"`
+	Streaming bool   `json:"streaming"`
+}
+
+// Info resolves a provider name the same way Stream does and describes the result.
+func Info(providerName string) ProviderInfo {
+	info := ProviderInfo{Requested: providerName, Name: providerName}
+	if info.Name == "" {
+		info.Name = DefaultProvider()
+	}
+	if resolved, err := resolveAlias(info.Name); err == nil {
+		info.Name = resolved
+	}
+	p, ok := providers[info.Name]
+	if !ok {
+		info.Name, info.Fallback = "mock", true
+		p = &MockProvider{}
+	}
+	info.Model, info.Streaming = describe(p)
+	return info
+}
+
+// describe reports the model and streaming support of a provider, looking through wrappers.
+func describe(p Provider) (model string, streaming bool) {
+	switch p := p.(type) {
+	case *HTTPProvider:
+		return p.Model, p.StreamEnabled
+	case *SearchAugmentedProvider:
+		return describe(p.Inner)
+	case *RAGProvider:
+		return describe(p.Inner)
+	case *ShadowProvider:
+		return describe(p.Primary)
+	case *ChaosProvider:
+		return describe(p.Inner)
+	case *FallbackProvider:
+		if len(p.Providers) > 0 {
+			if inner, ok := providers[p.Providers[0]]; ok {
+				return describe(inner)
+			}
+		}
+	case *LoadBalancedProvider:
+		if len(p.Providers) > 0 {
+			if inner, ok := providers[p.Providers[0]]; ok {
+				return describe(inner)
+			}
+		}
+	case *MockProvider:
+		return "mock", true
+	}
+	return "", false
+}
@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// NewJetifyProvider returns an HTTPProvider configured for Jetify's AI API.
+// Jetify exposes an OpenAI-compatible chat completions endpoint, so the prompt is sent
+// as the latest user message, after any conversation history (see WithMessages), and
+// the server-sent event stream is parsed for content deltas.
+// The API key is read from JETIFY_API_KEY.
+func NewJetifyProvider(endpoint, model string) *HTTPProvider {
+	h := NewHTTPProvider(endpoint, "JETIFY_API_KEY", model, true)
+	h.Format = FormatOpenAISSE
+	h.RequireAPIKey = true
+	h.BuildBody = chatCompletionsBody
+	h.Caps = Capabilities{Tools: true, JSONMode: true, Messages: true}
+	return h
+}
+
+// jetifyFromEnv builds the Jetify provider from JETIFY_ENDPOINT, JETIFY_MODEL and the
+// JETIFY_* generation options. ok is false when no endpoint is set, since Jetify has
+// no public default to fall back to.
+func jetifyFromEnv() (h *HTTPProvider, ok bool) {
+	endpoint := os.Getenv("JETIFY_ENDPOINT")
+	if endpoint == "" {
+		return nil, false
+	}
+	h = NewJetifyProvider(endpoint, os.Getenv("JETIFY_MODEL"))
+	h.Defaults = optionsFromEnv("JETIFY")
+	return h, true
+}
+
+// chatCompletionsBody builds an OpenAI-style chat completions request body.
+func chatCompletionsBody(h *HTTPProvider, prompt string) map[string]any {
+	body := map[string]any{
+		"messages": []map[string]string{{"role": "user", "content": prompt}},
+	}
+	if h.Model != "" {
+		body["model"] = h.Model
+	}
+	if h.StreamEnabled {
+		body["stream"] = true
+	}
+	if defs := toolDefinitions(); defs != nil && h.Caps.Tools {
+		body["tools"] = defs
+	}
+	return body
+}
+
+// newChatCompletionsParser returns a parser for one OpenAI-style chat completions SSE
+// stream. Content deltas are returned as chunks. Tool call arguments arrive as
+// fragments spread over many deltas; they are accumulated until the choice finishes,
+// the stream sends [DONE] or finish is called at the end of the body, then dispatched
+// to the registered tools and recorded on the request's Result.
+func newChatCompletionsParser(ctx context.Context) (parse LineParser, finish func()) {
+	var acc toolCallAccumulator
+	complete := func() {
+		calls := acc.flush()
+		if len(calls) == 0 {
+			return
+		}
+		calls = DispatchToolCalls(ctx, calls)
+		if res := ResultFrom(ctx); res != nil {
+			res.ToolCalls = append(res.ToolCalls, calls...)
+		}
+	}
+	parse = func(line string) (string, bool, error) {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			// event names, comments and keep-alives carry no content
+			return "", false, nil
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			complete()
+			return "", true, nil
+		}
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content   string          `json:"content"`
+					ToolCalls []toolCallDelta `json:"tool_calls"`
+					// reasoning tokens; "reasoning_content" is the DeepSeek/vLLM spelling
+					Reasoning        string `json:"reasoning"`
+					ReasoningContent string `json:"reasoning_content"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return "", false, nil
+		}
+		if event.Error != nil {
+			return "", false, &ProviderError{StatusCode: 200, Msg: "upstream error: " + event.Error.Message}
+		}
+		var b strings.Builder
+		for _, c := range event.Choices {
+			emitReasoning(ctx, c.Delta.Reasoning+c.Delta.ReasoningContent)
+			b.WriteString(c.Delta.Content)
+			for _, d := range c.Delta.ToolCalls {
+				acc.add(d)
+			}
+			// some upstreams end tool call deltas with "stop" rather than "tool_calls"
+			if c.FinishReason != "" {
+				setFinishReason(ctx, c.FinishReason)
+				complete()
+			}
+		}
+		return b.String(), false, nil
+	}
+	return parse, complete
+}
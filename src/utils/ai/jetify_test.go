@@ -0,0 +1,143 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJetifyFromEnv(t *testing.T) {
+	t.Setenv("JETIFY_ENDPOINT", "")
+	if _, ok := jetifyFromEnv(); ok {
+		t.Fatal("registered without JETIFY_ENDPOINT")
+	}
+
+	t.Setenv("JETIFY_ENDPOINT", "https://jetify.example/v1/chat/completions")
+	t.Setenv("JETIFY_MODEL", "m1")
+	t.Setenv("JETIFY_MAX_TOKENS", "64")
+	t.Setenv("JETIFY_API_KEY", "jk-test")
+	h, ok := jetifyFromEnv()
+	if !ok {
+		t.Fatal("not registered with JETIFY_ENDPOINT set")
+	}
+	if h.Endpoint != "https://jetify.example/v1/chat/completions" || h.Model != "m1" || h.Defaults.MaxTokens == nil || *h.Defaults.MaxTokens != 64 {
+		t.Fatalf("provider = %+v", h)
+	}
+	if err := h.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	t.Setenv("JETIFY_API_KEY", "")
+	if err := h.Validate(); err == nil || !strings.Contains(err.Error(), "JETIFY_API_KEY") {
+		t.Fatalf("Validate without a key = %v", err)
+	}
+	t.Setenv("JETIFY_ENDPOINT", "jetify.example")
+	if h, _ := jetifyFromEnv(); h.Validate() == nil {
+		t.Fatal("Validate accepted an endpoint without a scheme")
+	}
+}
+
+func TestChatCompletionsParser(t *testing.T) {
+	var res Result
+	parse, _ := newChatCompletionsParser(WithResult(context.Background(), &res))
+	var out strings.Builder
+	for _, line := range []string{
+		"event: message",
+		": keep-alive",
+		`data: {"choices":[{"delta":{"content":"Hel"}}]}`,
+		`data: {"choices":[{"delta":{"content":"lo"}}]}`,
+		`data: not json`,
+		`data: {"choices":[{"delta":{},"finish_reason":"length"}]}`,
+	} {
+		chunk, done, err := parse(line)
+		if err != nil || done {
+			t.Fatalf("parse(%q) = %q, %v, %v", line, chunk, done, err)
+		}
+		out.WriteString(chunk)
+	}
+	if _, done, _ := parse("data: [DONE]"); !done {
+		t.Fatal("[DONE] did not end the stream")
+	}
+	if out.String() != "Hello" || res.FinishReason != FinishLength {
+		t.Fatalf("content %q, finish reason %q", out.String(), res.FinishReason)
+	}
+
+	_, _, err := parse(`data: {"error":{"message":"overloaded"}}`)
+	if err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Fatalf("error event = %v", err)
+	}
+}
+
+func TestJetifyStreamsAndCallsTools(t *testing.T) {
+	RegisterTool(Tool{Name: "jetify-test-add", Call: func(ctx context.Context, args json.RawMessage) (string, error) {
+		var in struct{ A, B int }
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+		return fmt.Sprint(in.A + in.B), nil
+	}})
+	t.Cleanup(func() {
+		toolsMu.Lock()
+		delete(tools, "jetify-test-add")
+		toolsMu.Unlock()
+	})
+
+	var body map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		// the arguments arrive in fragments, as OpenAI-style APIs stream them
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"Adding."}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"c1","function":{"name":"jetify-test-add","arguments":"{\"A\":2,"}}]}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"B\":3}"}}]},"finish_reason":"tool_calls"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+	t.Setenv("JETIFY_API_KEY", "jk-test")
+	register(t, "jetify-test", NewJetifyProvider(upstream.URL, "m1"))
+
+	var res Result
+	chunks, err := collect(t, WithResult(context.Background(), &res), "jetify-test", "what is 2+3?")
+	if err != nil || joined(chunks) != "Adding." {
+		t.Fatalf("stream = %q, %v", joined(chunks), err)
+	}
+	if body["model"] != "m1" || body["stream"] != true || body["tools"] == nil {
+		t.Fatalf("request body = %v", body)
+	}
+	if len(res.ToolCalls) != 1 || res.ToolCalls[0].Output != "5" || res.ToolCalls[0].ID != "c1" {
+		t.Fatalf("tool calls = %+v, want one returning 5", res.ToolCalls)
+	}
+}
+
+func TestJetifyToolCallsWithoutDone(t *testing.T) {
+	registerTool(t, Tool{Name: "jetify-test-echo", Call: func(ctx context.Context, args json.RawMessage) (string, error) {
+		return string(args), nil
+	}})
+	fragments := `data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"c1","function":{"name":"jetify-test-echo","arguments":"{\"x\":"}}]}}]}` + "\n\n" +
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]}%s}]}`
+	tests := map[string]string{
+		// the connection closes after the last delta, with or without its newline
+		"eof":            fmt.Sprintf(fragments, "") + "\n\n",
+		"eof mid-record": fmt.Sprintf(fragments, ""),
+		// the upstream finishes the tool call deltas with "stop"
+		"stop": fmt.Sprintf(fragments, `,"finish_reason":"stop"`) + "\n\n" + "data: [DONE]\n\n",
+	}
+	for name, stream := range tests {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, stream)
+		}))
+		register(t, "jetify-test", NewJetifyProvider(upstream.URL, "m1"))
+
+		var res Result
+		if _, err := collect(t, WithResult(context.Background(), &res), "jetify-test", "hi"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if len(res.ToolCalls) != 1 || res.ToolCalls[0].Output != `{"x":1}` {
+			t.Errorf("%s: tool calls = %+v, want the accumulated call dispatched", name, res.ToolCalls)
+		}
+		upstream.Close()
+	}
+}
@@ -0,0 +1,75 @@
+package ai
+
+import (
+	"context"
+	"strings"
+)
+
+// Message is one entry of a chat conversation.
+type Message struct {
+	Role    string `json:"role"` // RoleSystem, RoleUser or RoleAssistant
+	Content string `json:"content"`
+}
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type messagesKey struct{}
+
+// WithMessages attaches the conversation leading up to a request's prompt: any system
+// message and the earlier turns, oldest first. Stream sends the prompt as the latest
+// user message after them, dropping the oldest turns when they don't fit the
+// provider's prompt budget (see SetPromptBudget).
+func WithMessages(ctx context.Context, history []Message) context.Context {
+	return context.WithValue(ctx, messagesKey{}, history)
+}
+
+// MessagesFrom returns the history attached with WithMessages, or nil.
+func MessagesFrom(ctx context.Context) []Message {
+	history, _ := ctx.Value(messagesKey{}).([]Message)
+	return history
+}
+
+// prependHistory puts history ahead of the messages of a chat request body built by
+// BuildBody. Bodies without a messages list are left alone.
+func prependHistory(body map[string]any, history []Message) {
+	msgs, ok := body["messages"].([]map[string]string)
+	if !ok || len(history) == 0 {
+		return
+	}
+	out := make([]map[string]string, 0, len(history)+len(msgs))
+	for _, m := range history {
+		out = append(out, map[string]string{"role": m.Role, "content": m.Content})
+	}
+	body["messages"] = append(out, msgs...)
+}
+
+// Transcript renders history followed by prompt as the single prompt string providers
+// take, ending with an open assistant turn. Without history the prompt is returned
+// unchanged.
+func Transcript(history []Message, prompt string) string {
+	if len(history) == 0 {
+		return prompt
+	}
+	var b strings.Builder
+	for _, m := range history {
+		switch m.Role {
+		case RoleSystem:
+			b.WriteString("System: ")
+		case RoleAssistant:
+			b.WriteString("Assistant: ")
+		default:
+			b.WriteString("User: ")
+		}
+		b.WriteString(m.Content)
+		b.WriteString("\n")
+	}
+	b.WriteString("User: ")
+	b.WriteString(prompt)
+	b.WriteString("\nAssistant:")
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testHistory = []Message{
+	{Role: RoleSystem, Content: "Be brief."},
+	{Role: RoleUser, Content: "hi"},
+	{Role: RoleAssistant, Content: "hello"},
+}
+
+func TestTranscript(t *testing.T) {
+	if got := Transcript(nil, "just this"); got != "just this" {
+		t.Fatalf("Transcript without history = %q", got)
+	}
+	want := "System: Be brief.\nUser: hi\nAssistant: hello\nUser: and now?\nAssistant:"
+	if got := Transcript(testHistory, "and now?"); got != want {
+		t.Fatalf("Transcript = %q, want %q", got, want)
+	}
+}
+
+// upstreamBody records the JSON body of every request and answers with an OpenAI-style
+// event stream.
+func upstreamBody(t *testing.T) (*httptest.Server, *[]map[string]any) {
+	var bodies []map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		bodies = append(bodies, body)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &bodies
+}
+
+func TestStreamSendsHistoryAsMessages(t *testing.T) {
+	ts, bodies := upstreamBody(t)
+	t.Setenv("JETIFY_API_KEY", "test-key")
+	register(t, "messages-chat", NewJetifyProvider(ts.URL, "m1"))
+	raw := NewHTTPProvider(ts.URL, "", "m1", false)
+	raw.Format = FormatRaw
+	register(t, "messages-raw", raw)
+
+	ctx := WithMessages(context.Background(), testHistory)
+	if _, err := collect(t, ctx, "messages-chat", "and now?"); err != nil {
+		t.Fatal(err)
+	}
+	var got []Message
+	b, _ := json.Marshal((*bodies)[0]["messages"])
+	json.Unmarshal(b, &got)
+	want := append(slices.Clone(testHistory), Message{Role: RoleUser, Content: "and now?"})
+	if !slices.Equal(got, want) {
+		t.Fatalf("chat provider got messages %+v, want %+v", got, want)
+	}
+
+	// a provider without message support gets the conversation as one prompt
+	if _, err := collect(t, ctx, "messages-raw", "and now?"); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*bodies)[1]["prompt"]; got != Transcript(testHistory, "and now?") {
+		t.Fatalf("raw provider got prompt %q", got)
+	}
+	if _, ok := (*bodies)[1]["messages"]; ok {
+		t.Fatal("raw provider was sent messages")
+	}
+}
+
+func TestMockRepliesToHistory(t *testing.T) {
+	ctx := WithMessages(context.Background(), testHistory)
+	chunks, err := collect(t, ctx, "mock", "what next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the mock sends groups of words without the space between them
+	if got, want := strings.Join(chunks, " "), "You said what next; this is turn 2."; got != want {
+		t.Fatalf("mock reply = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// ProviderConfig is one HTTP provider defined in the PROVIDERS_CONFIG file, e.g.
+//
+//	{"name": "groq", "endpoint": "https://api.groq.com/openai/v1/chat/completions",
+//	 "format": "openai-sse", "model": "llama3-8b-8192", "api_key_env": "GROQ_API_KEY",
+//	 "auth": "bearer", "headers": {"X-Team": "search"}}
+type ProviderConfig struct {
+	Name          string            `json:"name"`
+	Endpoint      string            `json:"endpoint"`
+	Format        Format            `json:"format"`
+	Model         string            `json:"model"`
+	APIKeyEnv     string            `json:"api_key_env"`
+	RequireAPIKey bool              `json:"require_api_key"`
+	Auth          string            `json:"auth"` // as for ParseAuthScheme; empty is bearer
+	Headers       map[string]string `json:"headers"`
+	Stream        *bool             `json:"stream"` // defaults to true
+}
+
+// knownFormats are the Format values a config entry may name.
+var knownFormats = []Format{FormatOllama, FormatNDJSON, FormatOpenAISSE, FormatOpenAIResponses, FormatRaw}
+
+// provider validates c and builds its HTTPProvider.
+func (c ProviderConfig) provider() (*HTTPProvider, error) {
+	if c.Name == "" {
+		return nil, errors.New("name is empty")
+	}
+	if c.Name == AutoProvider {
+		return nil, fmt.Errorf("name %q is reserved", c.Name)
+	}
+	if _, ok := providers[c.Name]; ok {
+		return nil, fmt.Errorf("provider %q is already registered", c.Name)
+	}
+	known := c.Format == ""
+	for _, f := range knownFormats {
+		known = known || c.Format == f
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown format %q (want one of %v)", c.Format, knownFormats)
+	}
+	stream := true
+	if c.Stream != nil {
+		stream = *c.Stream
+	}
+	h := NewHTTPProvider(c.Endpoint, c.APIKeyEnv, c.Model, stream)
+	h.Format = c.Format
+	if h.Format == "" {
+		h.Format = FormatRaw
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	// checked afterwards so a key that is missing right now is reported by Validate at
+	// startup instead of dropping the provider
+	h.RequireAPIKey = c.RequireAPIKey
+	if c.Auth != "" {
+		h.Auth = ParseAuthScheme(c.Auth)
+	}
+	if len(c.Headers) > 0 {
+		headers := c.Headers
+		h.RequestInterceptor = func(req *http.Request) error {
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			return nil
+		}
+	}
+	return h, nil
+}
+
+// LoadProviderConfig registers the providers defined in the JSON array at path and
+// returns their names. Entries that are malformed or clash with a registered name are
+// logged and skipped; an unreadable file or one that isn't an array is an error.
+func LoadProviderConfig(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var names []string
+	for i, raw := range entries {
+		var c ProviderConfig
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			log.Printf("ai: %s: skipping entry %d: %v", path, i, err)
+			continue
+		}
+		h, err := c.provider()
+		if err != nil {
+			log.Printf("ai: %s: skipping entry %d (%s): %v", path, i, c.Name, err)
+			continue
+		}
+		Register(c.Name, h)
+		names = append(names, c.Name)
+	}
+	return names, nil
+}
+
+// providersFromConfig loads PROVIDERS_CONFIG, if set.
+func providersFromConfig() {
+	path := os.Getenv("PROVIDERS_CONFIG")
+	if path == "" {
+		return
+	}
+	names, err := LoadProviderConfig(path)
+	if err != nil {
+		log.Printf("PROVIDERS_CONFIG: %v", err)
+		return
+	}
+	log.Printf("ai: registered %d providers from %s: %v", len(names), path, names)
+}
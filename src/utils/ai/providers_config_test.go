@@ -0,0 +1,88 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a PROVIDERS_CONFIG file and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "providers.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProviderConfig(t *testing.T) {
+	var got *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"hi"}}]}`+"\n\ndata: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+	t.Setenv("CFG_TEST_KEY", "sk-cfg")
+
+	path := writeConfig(t, `[
+		{"name": "cfg-sse", "endpoint": "`+upstream.URL+`", "format": "openai-sse", "model": "m1",
+		 "api_key_env": "CFG_TEST_KEY", "auth": "header:x-api-key", "headers": {"X-Team": "search"}},
+		{"name": "cfg-plain", "endpoint": "`+upstream.URL+`", "stream": false},
+		{"name": "cfg-typo", "endpoint": "`+upstream.URL+`", "fromat": "raw"},
+		{"name": "cfg-bad-format", "endpoint": "`+upstream.URL+`", "format": "xml"},
+		{"name": "", "endpoint": "`+upstream.URL+`"},
+		{"name": "mock", "endpoint": "`+upstream.URL+`"},
+		{"name": "cfg-no-endpoint"}
+	]`)
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	names, err := LoadProviderConfig(path)
+	t.Cleanup(func() {
+		for _, name := range names {
+			delete(providers, name)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"cfg-sse", "cfg-plain"}) {
+		t.Fatalf("registered %q, want only the two valid entries", names)
+	}
+	if n := strings.Count(logs.String(), "skipping entry"); n != 5 {
+		t.Fatalf("%d entries skipped, want 5:\n%s", n, logs.String())
+	}
+
+	h := providers["cfg-sse"].(*HTTPProvider)
+	if h.Model != "m1" || h.Format != FormatOpenAISSE || !h.StreamEnabled || h.Auth.Kind != AuthHeader {
+		t.Fatalf("cfg-sse = %+v", h)
+	}
+	if p := providers["cfg-plain"].(*HTTPProvider); p.StreamEnabled || p.Format != FormatRaw {
+		t.Fatalf("cfg-plain = %+v, want stream off and the raw format", p)
+	}
+	chunks, err := collect(t, context.Background(), "cfg-sse", "hello")
+	if err != nil || joined(chunks) != "hi" {
+		t.Fatalf("stream = %q, %v", joined(chunks), err)
+	}
+	if got.Header.Get("X-Team") != "search" || got.Header.Get("x-api-key") != "sk-cfg" {
+		t.Fatalf("upstream headers = %v, want the configured header and key", got.Header)
+	}
+}
+
+func TestLoadProviderConfigErrors(t *testing.T) {
+	if _, err := LoadProviderConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("a missing file loaded")
+	}
+	if _, err := LoadProviderConfig(writeConfig(t, `{"name": "not-an-array"}`)); err == nil {
+		t.Fatal("a config that isn't an array loaded")
+	}
+}
@@ -0,0 +1,173 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Retriever returns up to k documents relevant to a query, most relevant first.
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, k int) ([]string, error)
+}
+
+// RAGProvider retrieves documents for the prompt and prepends them as context
+// before delegating to the inner provider.
+type RAGProvider struct {
+	Inner     Provider
+	Retriever Retriever
+	K         int // number of documents to include; defaults to 3
+}
+
+// NewRAGProvider wraps inner with retrieval over r.
+func NewRAGProvider(inner Provider, r Retriever, k int) *RAGProvider {
+	return &RAGProvider{Inner: inner, Retriever: r, K: k}
+}
+
+func (p *RAGProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.Inner == nil || p.Retriever == nil {
+		return errors.New("rag: inner provider and retriever are required")
+	}
+	k := p.K
+	if k <= 0 {
+		k = 3
+	}
+	docs, err := p.Retriever.Retrieve(ctx, prompt, k)
+	if err != nil {
+		return fmt.Errorf("rag: retrieve: %w", err)
+	}
+	if len(docs) == 0 {
+		return p.Inner.Stream(ctx, prompt, handler)
+	}
+	return p.Inner.Stream(ctx, buildRAGPrompt(prompt, docs), handler)
+}
+
+// buildRAGPrompt prepends retrieved documents as a context block to the prompt.
+func buildRAGPrompt(prompt string, docs []string) string {
+	var b strings.Builder
+	b.WriteString("Answer using the following documents as context.\n\n")
+	for i, d := range docs {
+		b.WriteString("[Document ")
+		b.WriteString(strconv.Itoa(i + 1))
+		b.WriteString("]\n")
+		b.WriteString(strings.TrimSpace(d))
+		b.WriteString("\n\n")
+	}
+	b.WriteString("Question: ")
+	b.WriteString(prompt)
+	return b.String()
+}
+
+// KeywordRetriever is an in-memory BM25 retriever over a fixed document set.
+type KeywordRetriever struct {
+	docs   []string
+	terms  []map[string]int // term frequencies per document
+	lens   []int
+	avgLen float64
+	df     map[string]int // number of documents containing each term
+}
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// NewKeywordRetriever indexes docs for retrieval.
+func NewKeywordRetriever(docs []string) *KeywordRetriever {
+	r := &KeywordRetriever{docs: docs, df: map[string]int{}}
+	total := 0
+	for _, d := range docs {
+		tf := map[string]int{}
+		toks := tokenize(d)
+		for _, t := range toks {
+			tf[t]++
+		}
+		for t := range tf {
+			r.df[t]++
+		}
+		r.terms = append(r.terms, tf)
+		r.lens = append(r.lens, len(toks))
+		total += len(toks)
+	}
+	if len(docs) > 0 {
+		r.avgLen = float64(total) / float64(len(docs))
+	}
+	return r
+}
+
+// LoadKeywordRetriever indexes every .txt and .md file in dir.
+func LoadKeywordRetriever(dir string) (*KeywordRetriever, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var docs []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".txt" && ext != ".md") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(b))
+	}
+	return NewKeywordRetriever(docs), nil
+}
+
+func (r *KeywordRetriever) Retrieve(ctx context.Context, query string, k int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type scored struct {
+		idx   int
+		score float64
+	}
+	n := float64(len(r.docs))
+	var hits []scored
+	qterms := tokenize(query)
+	for i, tf := range r.terms {
+		score := 0.0
+		for _, t := range qterms {
+			f := float64(tf[t])
+			if f == 0 {
+				continue
+			}
+			df := float64(r.df[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := 1 - bm25B + bm25B*float64(r.lens[i])/r.avgLen
+			score += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+		if score > 0 {
+			hits = append(hits, scored{i, score})
+		}
+	}
+	sort.SliceStable(hits, func(a, b int) bool { return hits[a].score > hits[b].score })
+	if k > 0 && len(hits) > k {
+		hits = hits[:k]
+	}
+	out := make([]string, len(hits))
+	for i, h := range hits {
+		out[i] = r.docs[h.idx]
+	}
+	return out, nil
+}
+
+// tokenize lower-cases text and splits it into letter/digit runs.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type retrieverFunc func(ctx context.Context, query string, k int) ([]string, error)
+
+func (f retrieverFunc) Retrieve(ctx context.Context, query string, k int) ([]string, error) {
+	return f(ctx, query, k)
+}
+
+func TestKeywordRetriever(t *testing.T) {
+	r := NewKeywordRetriever([]string{
+		"Go channels pass values between goroutines.",
+		"The kettle boils water for tea.",
+		"Goroutines are scheduled by the Go runtime; channels synchronise them.",
+	})
+	docs, err := r.Retrieve(context.Background(), "how do goroutines use channels", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || strings.Contains(strings.Join(docs, ""), "kettle") {
+		t.Fatalf("Retrieve = %q, want the two Go documents", docs)
+	}
+	if docs, _ := r.Retrieve(context.Background(), "unrelated words", 2); len(docs) != 0 {
+		t.Fatalf("Retrieve with no matching terms = %q", docs)
+	}
+}
+
+func TestRAGProviderPrependsDocuments(t *testing.T) {
+	var sent string
+	inner := providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		sent = prompt
+		return nil
+	})
+	r := retrieverFunc(func(ctx context.Context, query string, k int) ([]string, error) {
+		if k != 3 {
+			t.Errorf("k = %d, want the default of 3", k)
+		}
+		return []string{"  doc one ", "doc two"}, nil
+	})
+	if err := NewRAGProvider(inner, r, 0).Stream(context.Background(), "the question", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	want := "Answer using the following documents as context.\n\n[Document 1]\ndoc one\n\n[Document 2]\ndoc two\n\nQuestion: the question"
+	if sent != want {
+		t.Fatalf("inner got %q, want %q", sent, want)
+	}
+}
+
+func TestRAGProviderWrapsRetrieveError(t *testing.T) {
+	r := retrieverFunc(func(ctx context.Context, query string, k int) ([]string, error) {
+		return nil, context.DeadlineExceeded
+	})
+	err := NewRAGProvider(&ScriptedProvider{}, r, 1).Stream(context.Background(), "q", func(string) {})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.HasPrefix(err.Error(), "rag: retrieve: ") {
+		t.Fatalf("err = %v, want the retriever's error wrapped", err)
+	}
+}
@@ -0,0 +1,29 @@
+package ai
+
+import "context"
+
+// reasoningKey holds the request's reasoning handler.
+type reasoningKey struct{}
+
+// WithReasoning returns a context whose streams pass reasoning ("thinking") tokens to
+// h, separately from the answer content given to the StreamHandler. Without one,
+// providers drop reasoning tokens, so callers that don't ask for them see no change.
+func WithReasoning(ctx context.Context, h StreamHandler) context.Context {
+	return context.WithValue(ctx, reasoningKey{}, h)
+}
+
+// ReasoningFrom returns the reasoning handler of the request, or nil.
+func ReasoningFrom(ctx context.Context) StreamHandler {
+	h, _ := ctx.Value(reasoningKey{}).(StreamHandler)
+	return h
+}
+
+// emitReasoning passes a reasoning chunk to the request's handler, if any.
+func emitReasoning(ctx context.Context, chunk string) {
+	if chunk == "" {
+		return
+	}
+	if h := ReasoningFrom(ctx); h != nil {
+		h(chunk)
+	}
+}
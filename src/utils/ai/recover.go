@@ -0,0 +1,48 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// withRecover guards handler against panics. A panic is logged with the request ID and
+// stack, the returned context is cancelled so the provider stops, and later chunks are
+// dropped. The returned recovered function reports the panic as an error wrapping
+// ErrHandlerPanic, or nil.
+func withRecover(ctx context.Context, provider string, handler StreamHandler) (context.Context, StreamHandler, func() error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	var (
+		mu       sync.Mutex
+		panicked error
+	)
+	wrapped := func(chunk string) {
+		mu.Lock()
+		failed := panicked != nil
+		mu.Unlock()
+		if failed {
+			return
+		}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			err := fmt.Errorf("%w: %v", ErrHandlerPanic, v)
+			log.Printf("stream handler panicked (request=%s, provider=%s): %v\n%s", RequestIDFrom(ctx), provider, v, debug.Stack())
+			mu.Lock()
+			panicked = err
+			mu.Unlock()
+			cancel(err)
+		}()
+		handler(chunk)
+	}
+	recovered := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return panicked
+	}
+	return ctx, wrapped, recovered
+}
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHandlerPanicBecomesError(t *testing.T) {
+	providerStopped := false
+	register(t, "panic-test", providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		for i := 0; i < 1000 && ctx.Err() == nil; i++ {
+			handler("chunk ")
+		}
+		providerStopped = ctx.Err() != nil
+		return ctx.Err()
+	}))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for range BreakerThreshold + 1 {
+		calls := 0
+		err := Stream(WithRequestID(context.Background(), "req-42"), "panic-test", "hi", func(string) {
+			calls++
+			if calls == 2 {
+				var closed chan string
+				close(closed) // a handler bug: panics
+			}
+		})
+		if !errors.Is(err, ErrHandlerPanic) {
+			t.Fatalf("err = %v, want ErrHandlerPanic", err)
+		}
+		if calls != 2 {
+			t.Fatalf("handler called %d times, want none after it panicked", calls)
+		}
+		if !providerStopped {
+			t.Fatal("the provider's context was not cancelled after the panic")
+		}
+	}
+	if !strings.Contains(logs.String(), "stream handler panicked (request=req-42, provider=panic-test)") {
+		t.Fatalf("log = %q, want the panic logged with the request ID", logs.String())
+	}
+	// the handler's bug says nothing about the provider
+	if s := breakerFor("panic-test").State(); s != BreakerClosed {
+		t.Fatalf("breaker %s after handler panics, want closed", s)
+	}
+}
@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// NewOpenAIResponsesProvider returns an HTTPProvider for OpenAI's Responses API
+// (POST /v1/responses). The API key is read from OPENAI_API_KEY.
+func NewOpenAIResponsesProvider(endpoint, model string) *HTTPProvider {
+	h := NewHTTPProvider(endpoint, "OPENAI_API_KEY", model, true)
+	h.Format = FormatOpenAIResponses
+	h.RequireAPIKey = true
+	h.BuildBody = responsesBody
+	h.Caps = Capabilities{JSONMode: true, Images: true}
+	return h
+}
+
+// responsesBody builds a Responses API request body.
+func responsesBody(h *HTTPProvider, prompt string) map[string]any {
+	body := map[string]any{"input": prompt}
+	if h.Model != "" {
+		body["model"] = h.Model
+	}
+	if h.StreamEnabled {
+		body["stream"] = true
+	}
+	return body
+}
+
+// newResponsesParser returns a parser for one Responses API event stream. Every SSE
+// data line carries its event type in "type", so the "event:" lines are not needed.
+// Text deltas become chunks, reasoning deltas go to the reasoning channel, and
+// response.completed ends the stream. response.failed, response.incomplete and error
+// events fail it.
+func newResponsesParser(ctx context.Context) LineParser {
+	return func(line string) (string, bool, error) {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			return "", false, nil
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return "", true, nil
+		}
+		var event struct {
+			Type     string `json:"type"`
+			Delta    string `json:"delta"`
+			Message  string `json:"message"`
+			Response struct {
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+				IncompleteDetails *struct {
+					Reason string `json:"reason"`
+				} `json:"incomplete_details"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return "", false, nil
+		}
+		switch event.Type {
+		case "response.output_text.delta":
+			return event.Delta, false, nil
+		case "response.reasoning_text.delta", "response.reasoning_summary_text.delta":
+			emitReasoning(ctx, event.Delta)
+		case "response.completed":
+			setFinishReason(ctx, "stop")
+			return "", true, nil
+		case "response.failed":
+			msg := "response failed"
+			if e := event.Response.Error; e != nil && e.Message != "" {
+				msg = e.Message
+			}
+			return "", false, &ProviderError{StatusCode: 200, Msg: "upstream error: " + msg}
+		case "response.incomplete":
+			msg := "response incomplete"
+			if d := event.Response.IncompleteDetails; d != nil && d.Reason != "" {
+				msg += ": " + d.Reason
+				setFinishReason(ctx, d.Reason)
+			}
+			return "", false, &ProviderError{StatusCode: 200, Msg: "upstream error: " + msg}
+		case "error":
+			return "", false, &ProviderError{StatusCode: 200, Msg: "upstream error: " + event.Message}
+		}
+		return "", false, nil
+	}
+}
@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"context"
+	"strings"
+)
+
+// Augmentation records which search augmentation path a stream took.
+type Augmentation string
+
+const (
+	AugmentationNone      Augmentation = ""           // no augmentation configured
+	AugmentationApplied   Augmentation = "applied"    // search results were added to the prompt
+	AugmentationNoResults Augmentation = "no-results" // search returned nothing, no context added
+	AugmentationSkipped   Augmentation = "skipped"    // search failed, prompt sent without context
+	AugmentationAborted   Augmentation = "aborted"    // search failed, stream was not started
+)
+
+// Result carries metadata about a stream that providers and wrappers fill in while streaming.
+// Callers attach one with WithResult and inspect it after Stream returns.
+type Result struct {
+	Augmentation Augmentation `json:"augmentation,omitempty"`
+	SearchError  string       `json:"search_error,omitempty"`
+	Citations    []Citation   `json:"citations,omitempty"`  // sources found, see Citation.Injected
+	ToolCalls    []ToolCall   `json:"tool_calls,omitempty"` // function calls the model made
+	// Truncated is set when the prompt was cut to fit the provider's budget
+	// (see SetPromptBudget); TruncatedChars is how many characters were removed.
+	Truncated      bool `json:"truncated,omitempty"`
+	TruncatedChars int  `json:"truncated_chars,omitempty"`
+	// FinishReason is why the response ended, as reported by the provider where it
+	// says so; Stream always sets it.
+	FinishReason FinishReason `json:"finish_reason,omitempty"`
+}
+
+// Citation is a source used to augment a prompt.
+type Citation struct {
+	Title string `json:"title"`
+	URL   string `json:"url,omitempty"`
+	// Injected is set for sources that were added to the prompt; the others were only
+	// found (see SearchAugmentedProvider.DisplayResults).
+	Injected bool `json:"injected"`
+}
+
+// parseCitation splits a search result of the form "text (url)" into a Citation.
+// Results without a trailing URL become a Citation with only a title.
+func parseCitation(result string) Citation {
+	result = strings.TrimSpace(result)
+	if strings.HasSuffix(result, ")") {
+		if i := strings.LastIndex(result, " ("); i >= 0 {
+			u := result[i+2 : len(result)-1]
+			if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+				return Citation{Title: result[:i], URL: u}
+			}
+		}
+	}
+	return Citation{Title: result}
+}
+
+type resultKey struct{}
+
+// WithResult returns a context that collects stream metadata into res.
+func WithResult(ctx context.Context, res *Result) context.Context {
+	return context.WithValue(ctx, resultKey{}, res)
+}
+
+// ResultFrom returns the Result attached to ctx, or nil if there is none.
+func ResultFrom(ctx context.Context) *Result {
+	res, _ := ctx.Value(resultKey{}).(*Result)
+	return res
+}
+
+// SearchObserver is told about every web search run to augment a prompt, before the
+// augmented prompt is sent.
+type SearchObserver func(query string, results []string)
+
+type searchObserverKey struct{}
+
+// WithSearchObserver returns a context whose search-augmented streams report their
+// query and raw results to fn.
+func WithSearchObserver(ctx context.Context, fn SearchObserver) context.Context {
+	return context.WithValue(ctx, searchObserverKey{}, fn)
+}
+
+// observeSearch reports a search to the request's observer, if any.
+func observeSearch(ctx context.Context, query string, results []string) {
+	if fn, _ := ctx.Value(searchObserverKey{}).(SearchObserver); fn != nil {
+		fn(query, results)
+	}
+}
@@ -0,0 +1,49 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"j-project/src/utils/redact"
+	"log"
+	"time"
+)
+
+// interruptedError marks a connection that failed or dropped before the response
+// completed, as opposed to an upstream that answered with an error.
+type interruptedError struct{ err error }
+
+func (e *interruptedError) Error() string { return e.err.Error() }
+func (e *interruptedError) Unwrap() error { return e.err }
+
+// sendResumable is send with retries on interrupted connections (see ResumeAttempts).
+func (h *HTTPProvider) sendResumable(ctx context.Context, b encodedBody, format Format, handler StreamHandler) error {
+	emitted := 0
+	for attempt := 1; ; attempt++ {
+		skip := emitted
+		err := h.send(ctx, b, format, func(chunk string) {
+			if skip > 0 {
+				if len(chunk) <= skip {
+					skip -= len(chunk)
+					return
+				}
+				chunk, skip = chunk[skip:], 0
+			}
+			emitted += len(chunk)
+			handler(chunk)
+		})
+		var ie *interruptedError
+		if err == nil || ctx.Err() != nil || !errors.As(err, &ie) {
+			return err
+		}
+		if attempt > h.ResumeAttempts || emitted > h.ResumeMaxBytes {
+			return err
+		}
+		log.Printf("http provider: connection interrupted after %d bytes, retrying (%d/%d): %s",
+			emitted, attempt, h.ResumeAttempts, redact.Scrub(err.Error()))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+		}
+	}
+}
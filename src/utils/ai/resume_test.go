@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// flakyUpstream drops the connection on the first `drops` requests, after sending
+// partial, and answers the rest with full.
+func flakyUpstream(t *testing.T, drops int32, partial, full string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > drops {
+			fmt.Fprint(w, full)
+			return
+		}
+		if partial != "" {
+			fmt.Fprint(w, partial)
+			w.(http.Flusher).Flush()
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+func TestResumeAfterResetBeforeAnyChunk(t *testing.T) {
+	upstream, requests := flakyUpstream(t, 1, "", "Hello\n")
+	h := rawProvider(t, "resume-test", upstream.URL)
+
+	// off by default: the reset fails the request
+	if _, err := collect(t, context.Background(), "resume-test", "hi"); err == nil {
+		t.Fatal("a dropped connection succeeded without ResumeAttempts")
+	}
+
+	requests.Store(0)
+	h.ResumeAttempts = 2
+	chunks, err := collect(t, context.Background(), "resume-test", "hi")
+	if err != nil || joined(chunks) != "Hello" {
+		t.Fatalf("stream = %q, %v; want the retry's answer", joined(chunks), err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("upstream saw %d requests, want 2", n)
+	}
+}
+
+func TestResumeMidStreamSkipsDeliveredOutput(t *testing.T) {
+	upstream, requests := flakyUpstream(t, 1, "Hel\n", "Hel\nlo\n")
+	h := rawProvider(t, "resume-test", upstream.URL)
+	h.ResumeAttempts, h.ResumeMaxBytes = 1, 16
+
+	chunks, err := collect(t, context.Background(), "resume-test", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Hel", "lo"}; !slices.Equal(chunks, want) {
+		t.Fatalf("chunks = %q, want %q without repeating what was sent", chunks, want)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("upstream saw %d requests, want 2", n)
+	}
+}
+
+func TestResumeGivesUp(t *testing.T) {
+	// more output than ResumeMaxBytes was already delivered
+	upstream, requests := flakyUpstream(t, 1, "Hello there\n", "Hello there\n")
+	h := rawProvider(t, "resume-test", upstream.URL)
+	h.ResumeAttempts, h.ResumeMaxBytes = 3, 4
+	chunks, err := collect(t, context.Background(), "resume-test", "hi")
+	var ie *interruptedError
+	if !errors.As(err, &ie) || joined(chunks) != "Hello there" || requests.Load() != 1 {
+		t.Fatalf("stream = %q, %v after %d requests; want no retry past ResumeMaxBytes", joined(chunks), err, requests.Load())
+	}
+
+	// the attempt budget runs out
+	upstream, requests = flakyUpstream(t, 10, "", "never")
+	h = rawProvider(t, "resume-test", upstream.URL)
+	h.ResumeAttempts = 2
+	if _, err := collect(t, context.Background(), "resume-test", "hi"); err == nil || requests.Load() != 3 {
+		t.Fatalf("err = %v after %d requests, want failure after 1 try and 2 retries", err, requests.Load())
+	}
+}
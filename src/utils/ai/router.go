@@ -0,0 +1,97 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AutoProvider is the provider name that asks the configured Router to pick one.
+const AutoProvider = "auto"
+
+// Router chooses a provider for a prompt sent to AutoProvider. The name it returns
+// may be an alias.
+type Router interface {
+	Route(ctx context.Context, prompt string) (providerName string, err error)
+}
+
+var (
+	routerMu sync.RWMutex
+	router   Router
+)
+
+// SetRouter installs the Router used for AutoProvider; nil removes it.
+func SetRouter(r Router) {
+	routerMu.Lock()
+	defer routerMu.Unlock()
+	router = r
+}
+
+// route asks the Router for the provider of an AutoProvider request.
+func route(ctx context.Context, prompt string) (string, error) {
+	routerMu.RLock()
+	r := router
+	routerMu.RUnlock()
+	if r == nil {
+		return "", fmt.Errorf("%w: %s (no router configured)", ErrProviderNotFound, AutoProvider)
+	}
+	name, err := r.Route(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("router: %w", err)
+	}
+	if name == AutoProvider {
+		return "", fmt.Errorf("router: chose %q for itself", AutoProvider)
+	}
+	return name, nil
+}
+
+// RuleRouter sends short, simple prompts to Fast and the rest to Powerful. A prompt is
+// complex when it is longer than MaxFastLength characters or mentions one of Keywords
+// (matched case-insensitively).
+type RuleRouter struct {
+	Fast          string
+	Powerful      string
+	MaxFastLength int
+	Keywords      []string
+}
+
+// DefaultRouterKeywords mark a prompt as complex for a RuleRouter built from env
+// without ROUTER_KEYWORDS.
+var DefaultRouterKeywords = []string{"explain", "analyze", "analyse", "compare", "prove", "step by step", "code", "debug"}
+
+func (r *RuleRouter) Route(ctx context.Context, prompt string) (string, error) {
+	if r.MaxFastLength > 0 && len([]rune(prompt)) > r.MaxFastLength {
+		return r.Powerful, nil
+	}
+	lower := strings.ToLower(prompt)
+	for _, k := range r.Keywords {
+		if k != "" && strings.Contains(lower, strings.ToLower(k)) {
+			return r.Powerful, nil
+		}
+	}
+	return r.Fast, nil
+}
+
+// routerFromEnv installs a RuleRouter when ROUTER_POWERFUL is set: ROUTER_FAST (default
+// ollama) takes prompts up to ROUTER_MAX_FAST_LENGTH characters (default 280) that
+// mention none of ROUTER_KEYWORDS (comma-separated, default DefaultRouterKeywords).
+func routerFromEnv() {
+	powerful := os.Getenv("ROUTER_POWERFUL")
+	if powerful == "" {
+		return
+	}
+	r := &RuleRouter{Fast: os.Getenv("ROUTER_FAST"), Powerful: powerful, MaxFastLength: 280, Keywords: DefaultRouterKeywords}
+	if r.Fast == "" {
+		r.Fast = "ollama"
+	}
+	if n, err := strconv.Atoi(os.Getenv("ROUTER_MAX_FAST_LENGTH")); err == nil {
+		r.MaxFastLength = n
+	}
+	if v, ok := os.LookupEnv("ROUTER_KEYWORDS"); ok {
+		r.Keywords = splitList(v)
+	}
+	SetRouter(r)
+}
@@ -0,0 +1,81 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// routerFunc adapts a function to Router.
+type routerFunc func(ctx context.Context, prompt string) (string, error)
+
+func (f routerFunc) Route(ctx context.Context, prompt string) (string, error) { return f(ctx, prompt) }
+
+// withRouter installs r for the duration of the test.
+func withRouter(t *testing.T, r Router) {
+	t.Helper()
+	SetRouter(r)
+	t.Cleanup(func() { SetRouter(nil) })
+}
+
+// nameEcho answers with the name of the provider the request ran on.
+func nameEcho() Provider {
+	return providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		handler(ProviderFrom(ctx))
+		return nil
+	})
+}
+
+func TestAutoRoutesByPrompt(t *testing.T) {
+	register(t, "route-fast", nameEcho())
+	register(t, "route-big", nameEcho())
+	withRouter(t, &RuleRouter{Fast: "route-fast", Powerful: "route-big", MaxFastLength: 40, Keywords: []string{"Explain"}})
+
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"hi there", "route-fast"},
+		{"what's 2+2?", "route-fast"},
+		{strings.Repeat("a long prompt ", 5), "route-big"},
+		{"explain monads", "route-big"},
+		// length is counted in characters, not bytes
+		{strings.Repeat("é", 40), "route-fast"},
+	}
+	for _, tt := range tests {
+		chunks, err := collect(t, context.Background(), AutoProvider, tt.prompt)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.prompt, err)
+		}
+		if got := joined(chunks); got != tt.want {
+			t.Errorf("%q routed to %q, want %q", tt.prompt, got, tt.want)
+		}
+	}
+}
+
+func TestAutoRoutingErrors(t *testing.T) {
+	if _, err := collect(t, context.Background(), AutoProvider, "hi"); !errors.Is(err, ErrProviderNotFound) {
+		t.Fatalf("auto without a router = %v, want ErrProviderNotFound", err)
+	}
+
+	errNoRoute := errors.New("no route")
+	withRouter(t, routerFunc(func(context.Context, string) (string, error) { return "", errNoRoute }))
+	if _, err := collect(t, context.Background(), AutoProvider, "hi"); !errors.Is(err, errNoRoute) {
+		t.Fatalf("err = %v, want the router's error", err)
+	}
+
+	withRouter(t, routerFunc(func(context.Context, string) (string, error) { return AutoProvider, nil }))
+	if _, err := collect(t, context.Background(), AutoProvider, "hi"); err == nil {
+		t.Fatal("a router choosing auto for itself was accepted")
+	}
+}
+
+func TestAutoRoutesThroughAlias(t *testing.T) {
+	register(t, "route-target", nameEcho())
+	withAlias(t, "route-alias", "route-target")
+	withRouter(t, routerFunc(func(context.Context, string) (string, error) { return "route-alias", nil }))
+	if chunks, err := collect(t, context.Background(), AutoProvider, "hi"); err != nil || joined(chunks) != "route-target" {
+		t.Fatalf("routed to %q, %v; want the alias resolved", joined(chunks), err)
+	}
+}
@@ -0,0 +1,54 @@
+package ai
+
+import (
+	"context"
+	"j-project/src/utils/redact"
+	"log"
+	"time"
+)
+
+// WebSearcherFunc adapts a function to the WebSearcher interface.
+type WebSearcherFunc func(ctx context.Context, query string) ([]string, error)
+
+func (f WebSearcherFunc) Search(ctx context.Context, query string) ([]string, error) {
+	return f(ctx, query)
+}
+
+// SearchMiddleware wraps a WebSearcher with cross-cutting behaviour.
+type SearchMiddleware func(WebSearcher) WebSearcher
+
+// ChainSearch wraps ws with the middlewares; the first one is the outermost.
+// The result can be passed straight to RegisterWebSearcher.
+func ChainSearch(ws WebSearcher, mws ...SearchMiddleware) WebSearcher {
+	for i := len(mws) - 1; i >= 0; i-- {
+		ws = mws[i](ws)
+	}
+	return ws
+}
+
+// LoggingSearchMiddleware logs each search with its duration, result count and error.
+func LoggingSearchMiddleware(name string) SearchMiddleware {
+	return func(next WebSearcher) WebSearcher {
+		return WebSearcherFunc(func(ctx context.Context, query string) ([]string, error) {
+			start := time.Now()
+			results, err := next.Search(ctx, query)
+			if err != nil {
+				log.Printf("search %s: query=%s failed after %s: %s", name, redact.SafeString(query), time.Since(start), redact.Scrub(err.Error()))
+			} else {
+				log.Printf("search %s: query=%s returned %d results in %s", name, redact.SafeString(query), len(results), time.Since(start))
+			}
+			return results, err
+		})
+	}
+}
+
+// TimeoutSearchMiddleware bounds each search to d.
+func TimeoutSearchMiddleware(d time.Duration) SearchMiddleware {
+	return func(next WebSearcher) WebSearcher {
+		return WebSearcherFunc(func(ctx context.Context, query string) ([]string, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next.Search(ctx, query)
+		})
+	}
+}
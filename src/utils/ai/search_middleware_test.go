@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tagging is a middleware that records when it runs and marks the results it returns.
+func tagging(tag string, trace *[]string) SearchMiddleware {
+	return func(next WebSearcher) WebSearcher {
+		return WebSearcherFunc(func(ctx context.Context, query string) ([]string, error) {
+			*trace = append(*trace, tag)
+			results, err := next.Search(ctx, query)
+			for i := range results {
+				results[i] = tag + "(" + results[i] + ")"
+			}
+			return results, err
+		})
+	}
+}
+
+func TestChainSearchOrder(t *testing.T) {
+	var trace []string
+	ws := ChainSearch(&MockWebSearcher{}, tagging("outer", &trace), tagging("inner", &trace))
+	registerSearcher(t, "chained", ws)
+
+	results, err := SearchWeb(context.Background(), "chained", "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"outer(inner(This is a mock search result for: go))"}; !slices.Equal(results, want) {
+		t.Fatalf("results = %q, want %q", results, want)
+	}
+	if want := []string{"outer", "inner"}; !slices.Equal(trace, want) {
+		t.Fatalf("middlewares ran %q, want the first one outermost", trace)
+	}
+}
+
+func TestLoggingAndTimeoutMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	slow := WebSearcherFunc(func(ctx context.Context, query string) ([]string, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return []string{"too late"}, nil
+		}
+	})
+	ws := ChainSearch(slow, LoggingSearchMiddleware("slow"), TimeoutSearchMiddleware(20*time.Millisecond))
+
+	start := time.Now()
+	_, err := ws.Search(context.Background(), "query")
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Fatalf("err = %v after %s, want the timeout's deadline", err, time.Since(start))
+	}
+	if !strings.Contains(logs.String(), "search slow: query=") || !strings.Contains(logs.String(), "failed after") {
+		t.Fatalf("log = %q, want the failed search logged", logs.String())
+	}
+
+	logs.Reset()
+	ws = ChainSearch(&MockWebSearcher{}, LoggingSearchMiddleware("mock"), TimeoutSearchMiddleware(time.Second))
+	if results, err := ws.Search(context.Background(), "query"); err != nil || len(results) != 1 {
+		t.Fatalf("Search = %q, %v", results, err)
+	}
+	if !strings.Contains(logs.String(), "returned 1 results") {
+		t.Fatalf("log = %q, want the result count", logs.String())
+	}
+}
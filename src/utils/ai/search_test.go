@@ -0,0 +1,70 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// redirectTransport sends every request to target instead of its own host.
+type redirectTransport struct{ target *url.URL }
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// fakeDuckDuckGo points the default HTTP client at handler for the duration of the test.
+func fakeDuckDuckGo(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	target, _ := url.Parse(ts.URL)
+	prev := http.DefaultClient.Transport
+	http.DefaultClient.Transport = redirectTransport{target}
+	t.Cleanup(func() { http.DefaultClient.Transport = prev })
+}
+
+func TestDuckDuckGoHTMLIsBlocked(t *testing.T) {
+	page := "<!DOCTYPE html><html><body>If this error persists, please let us know</body></html>"
+	for _, contentType := range []string{"text/html; charset=utf-8", "application/x-javascript"} {
+		fakeDuckDuckGo(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Write([]byte(page))
+		})
+		_, err := NewDuckDuckGoWebSearcher("", "").Search(context.Background(), "golang")
+		var se *SearchError
+		if !errors.Is(err, ErrSearchBlocked) || !errors.As(err, &se) {
+			t.Fatalf("%s: err = %v, want a SearchError wrapping ErrSearchBlocked", contentType, err)
+		}
+		if strings.Contains(err.Error(), "invalid character") {
+			t.Fatalf("%s: err = %q, want the friendly error rather than the JSON parse error", contentType, err)
+		}
+	}
+}
+
+func TestDuckDuckGoResults(t *testing.T) {
+	var query url.Values
+	fakeDuckDuckGo(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/x-javascript")
+		w.Write([]byte(`{"AbstractText":"Go is a language","AbstractURL":"https://go.dev",
+			"RelatedTopics":[{"Text":"Gopher","FirstURL":"https://go.dev/gopher"},{"Text":"no url"}]}`))
+	})
+	got, err := NewDuckDuckGoWebSearcher("de-de", "strict").Search(context.Background(), "golang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Go is a language (https://go.dev)", "Gopher (https://go.dev/gopher)"}; !slices.Equal(got, want) {
+		t.Fatalf("results = %q, want %q", got, want)
+	}
+	if query.Get("q") != "golang" || query.Get("kl") != "de-de" || query.Get("kp") != "1" || query.Get("format") != "json" {
+		t.Fatalf("query = %v", query)
+	}
+}
@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"context"
+	"j-project/src/utils/redact"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// ShadowTimeout bounds a shadow stream. Shadows outlive the client's request, so they
+// need a deadline of their own.
+var ShadowTimeout = 2 * time.Minute
+
+// ShadowResult holds the outcome of one shadowed request.
+type ShadowResult struct {
+	Prompt          string
+	Primary         string
+	PrimaryErr      error
+	PrimaryDuration time.Duration
+	Shadow          string
+	ShadowErr       error
+	ShadowDuration  time.Duration
+	ShadowToolCalls []ToolCall // the tools the shadow asked for; they are never run
+}
+
+// ShadowProvider streams from Primary to the client and, for a sampled fraction of
+// requests, sends the same prompt to Shadow in the background. The shadow's output is
+// never shown to the client; both responses are passed to OnResult once both finish,
+// for logging or offline comparison. Shadow failures, slowness or panics never affect
+// the primary stream, and the shadow's tool calls are recorded but not run, since the
+// primary already runs them for real.
+type ShadowProvider struct {
+	Primary  Provider
+	Shadow   Provider
+	Rate     float64 // fraction of requests shadowed, 0..1
+	OnResult func(ShadowResult)
+}
+
+// NewShadowProvider shadows primary with shadow for the given fraction of requests.
+func NewShadowProvider(primary, shadow Provider, rate float64) *ShadowProvider {
+	return &ShadowProvider{Primary: primary, Shadow: shadow, Rate: rate}
+}
+
+func (s *ShadowProvider) Stream(ctx context.Context, prompt string, handler StreamHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.Shadow == nil || s.Rate <= 0 || rand.Float64() >= s.Rate {
+		return s.Primary.Stream(ctx, prompt, handler)
+	}
+
+	shadowDone := make(chan ShadowResult, 1)
+	go func() {
+		var r ShadowResult
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("shadow: panic: %v", p)
+			}
+			shadowDone <- r
+		}()
+		// detach from the client's cancellation but not from its values
+		sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ShadowTimeout)
+		defer cancel()
+		// the shadow must not write into the primary's result, reasoning, tool or
+		// prompt frames, nor send a client's own key to another upstream, nor repeat
+		// the side effects of the primary's tool calls
+		var res Result
+		sctx = WithPromptObserver(WithToolObserver(WithReasoning(WithResult(sctx, &res), nil), nil), nil)
+		sctx = withoutToolDispatch(WithAPIKey(sctx, ""))
+		var b strings.Builder
+		start := time.Now()
+		r.ShadowErr = s.Shadow.Stream(sctx, prompt, func(chunk string) { b.WriteString(chunk) })
+		r.ShadowDuration, r.Shadow = time.Since(start), b.String()
+		r.ShadowToolCalls = res.ToolCalls
+	}()
+
+	var b strings.Builder
+	start := time.Now()
+	err := s.Primary.Stream(ctx, prompt, func(chunk string) {
+		b.WriteString(chunk)
+		handler(chunk)
+	})
+	primary, primaryDuration := b.String(), time.Since(start)
+
+	go func() {
+		r := <-shadowDone
+		r.Prompt, r.Primary, r.PrimaryErr, r.PrimaryDuration = prompt, primary, err, primaryDuration
+		if r.ShadowErr != nil {
+			log.Printf("shadow: shadow stream failed: %s", redact.Scrub(r.ShadowErr.Error()))
+		}
+		if s.OnResult != nil {
+			s.OnResult(r)
+		}
+	}()
+	return err
+}
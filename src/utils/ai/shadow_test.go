@@ -0,0 +1,138 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// toolCallingProvider answers with text after asking for the named tool, as a parser
+// for a function-calling API does.
+func toolCallingProvider(tool, text string) Provider {
+	return providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		calls := DispatchToolCalls(ctx, []ToolCall{{Name: tool, Arguments: json.RawMessage(`{}`)}})
+		if res := ResultFrom(ctx); res != nil {
+			res.ToolCalls = append(res.ToolCalls, calls...)
+		}
+		handler(text)
+		return nil
+	})
+}
+
+func TestShadowDoesNotRunTools(t *testing.T) {
+	var runs atomic.Int32
+	RegisterTool(Tool{Name: "shadow-test-tool", Call: func(context.Context, json.RawMessage) (string, error) {
+		runs.Add(1)
+		return "done", nil
+	}})
+	t.Cleanup(func() {
+		toolsMu.Lock()
+		delete(tools, "shadow-test-tool")
+		toolsMu.Unlock()
+	})
+
+	results := make(chan ShadowResult, 1)
+	s := NewShadowProvider(toolCallingProvider("shadow-test-tool", "primary"), toolCallingProvider("shadow-test-tool", "shadow"), 1)
+	s.OnResult = func(r ShadowResult) { results <- r }
+
+	var res Result
+	var got []string
+	err := s.Stream(WithResult(context.Background(), &res), "hi", func(c string) { got = append(got, c) })
+	if err != nil || joined(got) != "primary" {
+		t.Fatalf("primary stream = %q, %v", joined(got), err)
+	}
+	var r ShadowResult
+	select {
+	case r = <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no shadow result")
+	}
+
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("tool ran %d times, want once for the primary only", n)
+	}
+	if len(res.ToolCalls) != 1 || res.ToolCalls[0].Output != "done" {
+		t.Fatalf("primary tool calls = %+v, want one that ran", res.ToolCalls)
+	}
+	if len(r.ShadowToolCalls) != 1 || r.ShadowToolCalls[0].Output != "" || r.ShadowToolCalls[0].Error == "" {
+		t.Fatalf("shadow tool calls = %+v, want one recorded but not run", r.ShadowToolCalls)
+	}
+	if r.Primary != "primary" || r.Shadow != "shadow" {
+		t.Fatalf("shadow result = %+v", r)
+	}
+}
+
+func TestShadowFailureLeavesPrimaryAlone(t *testing.T) {
+	results := make(chan ShadowResult, 1)
+	shadow := providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		if apiKeyFrom(ctx) != "" {
+			t.Error("shadow was given the client's API key")
+		}
+		panic("shadow blew up")
+	})
+	s := NewShadowProvider(&ScriptedProvider{Chunks: []string{"fine"}}, shadow, 1)
+	s.OnResult = func(r ShadowResult) { results <- r }
+
+	var got []string
+	err := s.Stream(WithAPIKey(context.Background(), "sk-client"), "hi", func(c string) { got = append(got, c) })
+	if err != nil || joined(got) != "fine" {
+		t.Fatalf("primary stream = %q, %v", joined(got), err)
+	}
+	select {
+	case r := <-results:
+		if r.Primary != "fine" || r.Shadow != "" {
+			t.Fatalf("shadow result = %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no shadow result after a shadow panic")
+	}
+
+	// a failing primary is reported as such
+	s = NewShadowProvider(&ScriptedProvider{Err: errors.New("primary down")}, &ScriptedProvider{}, 1)
+	if err := s.Stream(context.Background(), "hi", func(string) {}); err == nil {
+		t.Fatal("want the primary's error")
+	}
+}
+
+func TestShadowSamplingAndSlowShadow(t *testing.T) {
+	var shadowed atomic.Int32
+	release := make(chan struct{})
+	shadow := providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		shadowed.Add(1)
+		<-release
+		handler("late")
+		return nil
+	})
+	primary := &ScriptedProvider{Chunks: []string{"now"}}
+
+	off := NewShadowProvider(primary, shadow, 0)
+	for range 50 {
+		if err := off.Stream(context.Background(), "hi", func(string) {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := shadowed.Load(); n != 0 {
+		t.Fatalf("shadow ran %d times at rate 0", n)
+	}
+
+	// a shadow that hasn't answered yet doesn't hold up the client
+	results := make(chan ShadowResult, 1)
+	on := NewShadowProvider(primary, shadow, 1)
+	on.OnResult = func(r ShadowResult) { results <- r }
+	var got []string
+	if err := on.Stream(context.Background(), "hi", func(c string) { got = append(got, c) }); err != nil || joined(got) != "now" {
+		t.Fatalf("primary stream = %q, %v", joined(got), err)
+	}
+	close(release)
+	select {
+	case r := <-results:
+		if r.Primary != "now" || r.Shadow != "late" || r.Prompt != "hi" {
+			t.Fatalf("shadow result = %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no shadow result")
+	}
+}
@@ -0,0 +1,30 @@
+package ai
+
+import "context"
+
+// shutdownCtx ends when Shutdown is called. Work with no deadline of its own, like web
+// searches, is tied to it so that it can't hold up a graceful shutdown.
+var shutdownCtx, shutdown = context.WithCancelCause(context.Background())
+
+// Shutdown cancels the outstanding web searches and makes new ones fail at once with
+// ErrShuttingDown. Streams keep running; a search-augmented stream whose search was cut
+// off follows its SearchFailureMode. Call it when the server starts draining.
+func Shutdown() {
+	shutdown(ErrShuttingDown)
+}
+
+// ShuttingDown reports whether Shutdown has been called.
+func ShuttingDown() bool {
+	return shutdownCtx.Err() != nil
+}
+
+// withShutdown returns a context that is also cancelled, with cause ErrShuttingDown,
+// when Shutdown is called.
+func withShutdown(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(shutdownCtx, func() { cancel(ErrShuttingDown) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// freshShutdown gives the test its own shutdown signal, so calling Shutdown doesn't
+// affect the tests after it.
+func freshShutdown(t *testing.T) {
+	t.Helper()
+	prevCtx, prevCancel := shutdownCtx, shutdown
+	shutdownCtx, shutdown = context.WithCancelCause(context.Background())
+	t.Cleanup(func() { shutdownCtx, shutdown = prevCtx, prevCancel })
+}
+
+// hangingSearcher blocks until its context ends and reports when it has started.
+func hangingSearcher(started chan<- struct{}) WebSearcher {
+	return WebSearcherFunc(func(ctx context.Context, query string) ([]string, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, context.Cause(ctx)
+	})
+}
+
+func TestShutdownCancelsHangingSearch(t *testing.T) {
+	for _, mode := range []SearchFailureMode{SearchFailProceed, SearchFailAbort} {
+		t.Run(mode.String(), func(t *testing.T) {
+			freshShutdown(t)
+			started := make(chan struct{})
+			registerSearcher(t, "hanging", hangingSearcher(started))
+			var sent string
+			var res Result
+			p := NewSearchAugmentedProvider(promptRecorder(&sent), "hanging", mode)
+
+			errc := make(chan error, 1)
+			go func() { errc <- p.Stream(WithResult(context.Background(), &res), "q", func(string) {}) }()
+			<-started
+			Shutdown()
+
+			var err error
+			select {
+			case err = <-errc:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Shutdown didn't cancel the search")
+			}
+			if mode == SearchFailAbort {
+				if !errors.Is(err, ErrShuttingDown) || sent != "" {
+					t.Fatalf("err = %v, inner got %q; want the stream aborted with ErrShuttingDown", err, sent)
+				}
+				return
+			}
+			// proceed: the answer is generated without search context
+			if err != nil || sent != "q" || res.Augmentation != AugmentationSkipped {
+				t.Fatalf("err = %v, inner got %q, augmentation %s; want the plain prompt answered", err, sent, res.Augmentation)
+			}
+		})
+	}
+}
+
+func TestSearchAfterShutdownFailsAtOnce(t *testing.T) {
+	freshShutdown(t)
+	called := false
+	registerSearcher(t, "after", WebSearcherFunc(func(context.Context, string) ([]string, error) {
+		called = true
+		return []string{"result"}, nil
+	}))
+	Shutdown()
+	if !ShuttingDown() {
+		t.Fatal("ShuttingDown = false after Shutdown")
+	}
+	if _, err := SearchWeb(context.Background(), "after", "q"); !errors.Is(err, ErrShuttingDown) || called {
+		t.Fatalf("SearchWeb after Shutdown = %v (searcher called %v), want ErrShuttingDown without searching", err, called)
+	}
+}
@@ -0,0 +1,71 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// withStopSequences ends the stream at the first occurrence of any of stops. Content is
+// delivered up to the match and the provider's context is cancelled. Because a sequence
+// may be split across chunks, the tail of the output that could still be the start of
+// one is held back until the next chunk arrives. The returned finish function must be
+// called when streaming ends; it delivers anything still held back and reports whether
+// a stop sequence was hit.
+func withStopSequences(ctx context.Context, stops []string, handler StreamHandler) (context.Context, StreamHandler, func() bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	longest := 0
+	for _, s := range stops {
+		longest = max(longest, len(s))
+	}
+	var pending string
+	stopped := false
+	wrapped := func(chunk string) {
+		if stopped {
+			return
+		}
+		pending += chunk
+		if i := firstStop(pending, stops); i >= 0 {
+			stopped = true
+			if i > 0 {
+				handler(pending[:i])
+			}
+			pending = ""
+			cancel()
+			return
+		}
+		// hold back the longest suffix that could begin a stop sequence, without
+		// splitting a UTF-8 sequence
+		cut := max(len(pending)-(longest-1), 0)
+		for cut > 0 && cut < len(pending) && !utf8.RuneStart(pending[cut]) {
+			cut--
+		}
+		if cut > 0 {
+			handler(pending[:cut])
+			pending = pending[cut:]
+		}
+	}
+	finish := func() bool {
+		if !stopped && pending != "" {
+			handler(pending)
+			pending = ""
+		}
+		cancel()
+		return stopped
+	}
+	return ctx, wrapped, finish
+}
+
+// firstStop returns the index of the earliest stop sequence in s, or -1.
+func firstStop(s string, stops []string) int {
+	first := -1
+	for _, stop := range stops {
+		if stop == "" {
+			continue
+		}
+		if i := strings.Index(s, stop); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	return first
+}
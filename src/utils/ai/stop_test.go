@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStopSequenceAcrossChunks(t *testing.T) {
+	cancelled := false
+	register(t, "stop-test", providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		handler("The answer is 42</ans")
+		handler("wer> and then some")
+		// a provider that ignores the stop keeps going until its context ends
+		for i := 0; i < 1000 && ctx.Err() == nil; i++ {
+			handler(" more")
+		}
+		cancelled = ctx.Err() != nil
+		return ctx.Err()
+	}))
+
+	var res Result
+	ctx := WithResult(WithOptions(context.Background(), Options{StopSequences: []string{"</answer>"}}), &res)
+	chunks, err := collect(t, ctx, "stop-test", "q")
+	if err != nil {
+		t.Fatalf("err = %v, want a stop sequence to end the stream normally", err)
+	}
+	if got := joined(chunks); got != "The answer is 42" {
+		t.Fatalf("output = %q, want everything before the stop sequence", got)
+	}
+	if !cancelled {
+		t.Fatal("the provider's context was not cancelled at the stop sequence")
+	}
+	if res.FinishReason != FinishStop {
+		t.Fatalf("finish reason = %q, want stop", res.FinishReason)
+	}
+}
+
+func TestWithStopSequences(t *testing.T) {
+	tests := []struct {
+		name    string
+		stops   []string
+		chunks  []string
+		want    string
+		stopped bool
+	}{
+		{"no match", []string{"STOP"}, []string{"all ", "of ", "it ST"}, "all of it ST", false},
+		{"earliest of several", []string{"\n\n", "END"}, []string{"one E", "ND two\n\nthree"}, "one ", true},
+		{"match at start", []string{"###"}, []string{"##", "# after"}, "", true},
+		{"multibyte held back whole", []string{"→stop"}, []string{"naïve →", "st", "op!"}, "naïve ", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []string
+			_, h, finish := withStopSequences(context.Background(), tt.stops, func(c string) { out = append(out, c) })
+			for _, c := range tt.chunks {
+				h(c)
+			}
+			stopped := finish()
+			if joined(out) != tt.want || stopped != tt.stopped {
+				t.Fatalf("output %q stopped %v, want %q %v", joined(out), stopped, tt.want, tt.stopped)
+			}
+			for _, c := range out {
+				if c == "" {
+					t.Fatal("an empty chunk was delivered")
+				}
+			}
+		})
+	}
+}
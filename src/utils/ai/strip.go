@@ -0,0 +1,143 @@
+package ai
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// StripPrefixWindow is how many bytes of a response are held back so a Prefix pattern
+// can be matched against its start. It delays the first chunk of providers that have a
+// Prefix set; the rest of the response streams as usual.
+var StripPrefixWindow = 80
+
+// StripPatterns remove noise from a provider's output before it reaches the handler.
+type StripPatterns struct {
+	// Tokens are removed wherever they appear, including when split across chunks,
+	// e.g. leaked chat template tokens such as "<|assistant|>".
+	Tokens []string
+	// Prefix is matched against the start of the response (the first StripPrefixWindow
+	// bytes) and the match is dropped, e.g. `Sure! Here's the answer:\s*`.
+	Prefix *regexp.Regexp
+}
+
+var (
+	stripsMu sync.RWMutex
+	strips   = map[string]StripPatterns{}
+)
+
+// SetStripPatterns sets the patterns Stream removes from the named provider's output.
+// Empty patterns remove the setting.
+func SetStripPatterns(name string, p StripPatterns) {
+	stripsMu.Lock()
+	defer stripsMu.Unlock()
+	if len(p.Tokens) == 0 && p.Prefix == nil {
+		delete(strips, name)
+		return
+	}
+	strips[name] = p
+}
+
+func stripPatterns(name string) (StripPatterns, bool) {
+	stripsMu.RLock()
+	defer stripsMu.RUnlock()
+	p, ok := strips[name]
+	return p, ok
+}
+
+// withStrip removes p from the output passed to handler. Text that could still be the
+// start of a token is held back until the next chunk, and the start of the response
+// until StripPrefixWindow bytes have arrived. The returned finish function must be
+// called when streaming ends; it delivers anything still held back.
+func withStrip(p StripPatterns, handler StreamHandler) (StreamHandler, func()) {
+	var pending string
+	started := p.Prefix == nil
+	start := func() {
+		pending = removeTokens(pending, p.Tokens)
+		if loc := p.Prefix.FindStringIndex(pending); loc != nil && loc[0] == 0 {
+			pending = pending[loc[1]:]
+		}
+		started = true
+	}
+	emit := func(final bool) {
+		pending = removeTokens(pending, p.Tokens)
+		cut := len(pending)
+		if !final {
+			cut -= partialToken(pending, p.Tokens)
+			for cut > 0 && cut < len(pending) && !utf8.RuneStart(pending[cut]) {
+				cut--
+			}
+		}
+		if cut > 0 {
+			handler(pending[:cut])
+			pending = pending[cut:]
+		}
+	}
+	wrapped := func(chunk string) {
+		pending += chunk
+		if !started {
+			if len(pending) < StripPrefixWindow {
+				return
+			}
+			start()
+		}
+		emit(false)
+	}
+	finish := func() {
+		if !started {
+			start()
+		}
+		emit(true)
+	}
+	return wrapped, finish
+}
+
+func removeTokens(s string, tokens []string) string {
+	for _, t := range tokens {
+		if t != "" {
+			s = strings.ReplaceAll(s, t, "")
+		}
+	}
+	return s
+}
+
+// partialToken returns the length of the longest suffix of s that is a proper prefix
+// of one of tokens, i.e. how much of s may still turn into a token.
+func partialToken(s string, tokens []string) int {
+	longest := 0
+	for _, t := range tokens {
+		for n := min(len(t)-1, len(s)); n > longest; n-- {
+			if strings.HasSuffix(s, t[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
+
+// stripPatternsFromEnv applies STRIP_TOKENS_<NAME> (comma-separated) and
+// STRIP_PREFIX_<NAME> (a regular expression) for every registered provider.
+func stripPatternsFromEnv() {
+	for name := range providers {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		var p StripPatterns
+		for _, t := range strings.Split(os.Getenv("STRIP_TOKENS_"+key), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				p.Tokens = append(p.Tokens, t)
+			}
+		}
+		if expr := os.Getenv("STRIP_PREFIX_" + key); expr != "" {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				log.Printf("STRIP_PREFIX_%s: %v, ignoring", key, err)
+			} else {
+				p.Prefix = re
+			}
+		}
+		SetStripPatterns(name, p)
+	}
+}
@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+// stripPatternsFor sets p for name for the duration of the test.
+func stripPatternsFor(t *testing.T, name string, p StripPatterns) {
+	t.Helper()
+	SetStripPatterns(name, p)
+	t.Cleanup(func() { SetStripPatterns(name, StripPatterns{}) })
+}
+
+func TestStripTokenSplitAcrossChunks(t *testing.T) {
+	register(t, "strip-test", &ScriptedProvider{Chunks: []string{"<|assis", "tant|>Hello", " there<|", "end|>"}})
+	stripPatternsFor(t, "strip-test", StripPatterns{Tokens: []string{"<|assistant|>", "<|end|>"}})
+
+	chunks, err := collect(t, context.Background(), "strip-test", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joined(chunks); got != "Hello there" {
+		t.Fatalf("output = %q, want the template tokens removed", got)
+	}
+	for _, c := range chunks {
+		if c == "" {
+			t.Fatal("an empty chunk was delivered")
+		}
+	}
+
+	// other providers are left alone
+	register(t, "strip-other", &ScriptedProvider{Chunks: []string{"<|assistant|>kept"}})
+	if chunks, _ := collect(t, context.Background(), "strip-other", "hi"); joined(chunks) != "<|assistant|>kept" {
+		t.Fatalf("unconfigured provider output = %q", joined(chunks))
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	prefix := regexp.MustCompile(`^(Sure|Certainly)! Here's the answer:\s*`)
+	tests := []struct {
+		chunks []string
+		want   string
+	}{
+		{[]string{"Sure! Here's", " the answer: ", "42 is it."}, "42 is it."},
+		// shorter than the window: handled when the stream ends
+		{[]string{"Certainly! Here's the answer:", " yes"}, "yes"},
+		// only at the start
+		{[]string{"No. Sure! Here's the answer: x"}, "No. Sure! Here's the answer: x"},
+	}
+	for _, tt := range tests {
+		var out []string
+		h, finish := withStrip(StripPatterns{Prefix: prefix}, func(c string) { out = append(out, c) })
+		for _, c := range tt.chunks {
+			h(c)
+		}
+		finish()
+		if joined(out) != tt.want {
+			t.Errorf("strip %q = %q, want %q", tt.chunks, joined(out), tt.want)
+		}
+	}
+}
+
+func TestPartialToken(t *testing.T) {
+	tokens := []string{"<|end|>", "</s>"}
+	for s, want := range map[string]int{"text <|en": 4, "text </": 2, "text <": 1, "text": 0, "<|end|": 6} {
+		if got := partialToken(s, tokens); got != want {
+			t.Errorf("partialToken(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UnknownProviderError is returned by Lookup for a name that is neither registered
+// nor an alias. It matches ErrProviderNotFound with errors.Is.
+type UnknownProviderError struct {
+	Name       string
+	Suggestion string   // closest registered name or alias; empty when nothing is close
+	Available  []string // registered names and aliases, sorted
+}
+
+func (e *UnknownProviderError) Error() string {
+	s := fmt.Sprintf("unknown provider %q", e.Name)
+	if e.Suggestion != "" {
+		s += fmt.Sprintf("; did you mean %q?", e.Suggestion)
+	}
+	return s + fmt.Sprintf(" available: [%s]", strings.Join(e.Available, " "))
+}
+
+func (e *UnknownProviderError) Is(target error) bool { return target == ErrProviderNotFound }
+
+// unknownProvider builds the error for name, suggesting the closest known name.
+func unknownProvider(name string) error {
+	available := make([]string, 0, len(providers))
+	for n := range providers {
+		available = append(available, n)
+	}
+	for a := range Aliases() {
+		available = append(available, a)
+	}
+	sort.Strings(available)
+	return &UnknownProviderError{Name: name, Suggestion: closest(name, available), Available: available}
+}
+
+// closest returns the candidate with the smallest edit distance to name, ignoring
+// case, or "" when even that one differs in more than a third of its characters
+// (at least 2). Ties go to the first candidate.
+func closest(name string, candidates []string) string {
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		d := levenshtein(strings.ToLower(name), strings.ToLower(c))
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	if best == "" || bestDist > max(2, len([]rune(best))/3) {
+		return ""
+	}
+	return best
+}
+
+// levenshtein is the number of single-rune insertions, deletions and substitutions
+// turning a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLookupSuggestsClosestProvider(t *testing.T) {
+	register(t, "anthropic", &ScriptedProvider{})
+	register(t, "openai", &ScriptedProvider{})
+	withAlias(t, "local-llama", "mock")
+
+	tests := []struct {
+		name, want string
+	}{
+		{"anthropc", "anthropic"},
+		{"OpenAl", "openai"},
+		{"local-lama", "local-llama"},
+		{"totally-different", ""},
+	}
+	for _, tt := range tests {
+		_, err := Lookup(tt.name)
+		var ue *UnknownProviderError
+		if !errors.As(err, &ue) || !errors.Is(err, ErrProviderNotFound) {
+			t.Fatalf("Lookup(%q) = %v, want an UnknownProviderError", tt.name, err)
+		}
+		if ue.Suggestion != tt.want {
+			t.Errorf("Lookup(%q) suggested %q, want %q", tt.name, ue.Suggestion, tt.want)
+		}
+		if !slices.IsSorted(ue.Available) || !slices.Contains(ue.Available, "anthropic") || !slices.Contains(ue.Available, "local-llama") {
+			t.Errorf("available = %q, want the sorted names and aliases", ue.Available)
+		}
+	}
+
+	_, err := Lookup("anthropc")
+	msg := err.Error()
+	if !strings.HasPrefix(msg, `unknown provider "anthropc"; did you mean "anthropic"? available: [`) {
+		t.Fatalf("error = %q", msg)
+	}
+	_, err = Lookup("totally-different")
+	if strings.Contains(err.Error(), "did you mean") {
+		t.Fatalf("error = %q, want no suggestion for a name that isn't close", err)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"anthropc", "anthropic", 1},
+		{"naïve", "naive", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// promptWrap brackets a prompt with provider-specific text, e.g. "[INST] " and " [/INST]".
+type promptWrap struct {
+	prefix, suffix string
+}
+
+var (
+	wrapsMu sync.RWMutex
+	wraps   = map[string]promptWrap{}
+)
+
+// SetPromptWrap sets a prefix and suffix that Stream adds around every prompt sent to the
+// named provider. It applies to any provider; HTTPProvider also has PromptPrefix and
+// PromptSuffix fields for per-instance wrapping, applied inside this one.
+func SetPromptWrap(name, prefix, suffix string) {
+	wrapsMu.Lock()
+	defer wrapsMu.Unlock()
+	if prefix == "" && suffix == "" {
+		delete(wraps, name)
+		return
+	}
+	wraps[name] = promptWrap{prefix, suffix}
+}
+
+// wrapPrompt applies the registry-level prefix/suffix for a provider.
+func wrapPrompt(name, prompt string) string {
+	wrapsMu.RLock()
+	w, ok := wraps[name]
+	wrapsMu.RUnlock()
+	if !ok {
+		return prompt
+	}
+	return w.prefix + prompt + w.suffix
+}
+
+// promptWrapsFromEnv applies PROMPT_PREFIX_<NAME> and PROMPT_SUFFIX_<NAME> for every
+// registered provider.
+func promptWrapsFromEnv() {
+	for name := range providers {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		prefix, suffix := os.Getenv("PROMPT_PREFIX_"+key), os.Getenv("PROMPT_SUFFIX_"+key)
+		if prefix != "" || suffix != "" {
+			SetPromptWrap(name, prefix, suffix)
+		}
+	}
+}
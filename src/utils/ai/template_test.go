@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// promptEchoUpstream answers every request with "ok" and sends the body's prompt field
+// on the returned channel.
+func promptEchoUpstream(t *testing.T) (*httptest.Server, <-chan string) {
+	t.Helper()
+	prompts := make(chan string, 8)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Prompt string }
+		json.NewDecoder(r.Body).Decode(&body)
+		prompts <- body.Prompt
+		fmt.Fprintln(w, "ok")
+	}))
+	t.Cleanup(ts.Close)
+	return ts, prompts
+}
+
+func TestPromptPrefixAndSuffix(t *testing.T) {
+	upstream, prompts := promptEchoUpstream(t)
+	h := rawProvider(t, "wrap-test", upstream.URL)
+	h.PromptPrefix, h.PromptSuffix = "<s>[INST] ", " [/INST]"
+
+	if _, err := collect(t, context.Background(), "wrap-test", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-prompts, "<s>[INST] hello [/INST]"; got != want {
+		t.Fatalf("upstream prompt = %q, want %q", got, want)
+	}
+
+	// the registry-level wrap goes inside the provider's own
+	SetPromptWrap("wrap-test", "System: be brief.\n", "\n")
+	t.Cleanup(func() { SetPromptWrap("wrap-test", "", "") })
+	if _, err := collect(t, context.Background(), "wrap-test", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-prompts, "<s>[INST] System: be brief.\nhello\n [/INST]"; got != want {
+		t.Fatalf("upstream prompt = %q, want %q", got, want)
+	}
+
+	SetPromptWrap("wrap-test", "", "")
+	if got := wrapPrompt("wrap-test", "hello"); got != "hello" {
+		t.Fatalf("wrapPrompt after clearing = %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrProviderTimeout is returned when a provider produces no output for longer than its timeout.
+var ErrProviderTimeout = errors.New("provider timed out waiting for output")
+
+// DefaultProviderTimeout is the inactivity timeout for providers without their own setting.
+// Zero disables it. It can be set with PROVIDER_TIMEOUT.
+//
+// Precedence: a deadline on the caller's context always wins and disables the provider
+// timeouts entirely; otherwise a timeout set with SetProviderTimeout applies; otherwise
+// DefaultProviderTimeout applies.
+var DefaultProviderTimeout = 2 * time.Minute
+
+var (
+	timeoutsMu sync.RWMutex
+	timeouts   = map[string]time.Duration{}
+)
+
+// SetProviderTimeout sets the inactivity timeout for a provider. The timer restarts on every
+// chunk, so a long streamed response is fine as long as it keeps producing output.
+// A zero duration disables the timeout for that provider.
+func SetProviderTimeout(name string, d time.Duration) {
+	timeoutsMu.Lock()
+	timeouts[name] = d
+	timeoutsMu.Unlock()
+}
+
+// providerTimeout returns the effective inactivity timeout for a provider.
+func providerTimeout(name string) time.Duration {
+	timeoutsMu.RLock()
+	defer timeoutsMu.RUnlock()
+	if d, ok := timeouts[name]; ok {
+		return d
+	}
+	return DefaultProviderTimeout
+}
+
+// withInactivityTimeout cancels ctx if handler is not called for d. The returned stop
+// function must be called when streaming ends; it reports whether the timeout fired.
+func withInactivityTimeout(ctx context.Context, d time.Duration, handler StreamHandler) (context.Context, StreamHandler, func() bool) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(d, func() { cancel(ErrProviderTimeout) })
+	wrapped := func(chunk string) {
+		// time spent in the handler (e.g. blocked on a paused client) isn't the provider's
+		timer.Stop()
+		handler(chunk)
+		timer.Reset(d)
+	}
+	// reasoning counts as output too; a model may think for a long time before answering
+	if reasoning := ReasoningFrom(ctx); reasoning != nil {
+		ctx = WithReasoning(ctx, func(chunk string) {
+			timer.Reset(d)
+			reasoning(chunk)
+		})
+	}
+	stop := func() bool {
+		timer.Stop()
+		fired := errors.Is(context.Cause(ctx), ErrProviderTimeout)
+		cancel(nil)
+		return fired
+	}
+	return ctx, wrapped, stop
+}
@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a model would see for a text. Prompt budgets (see
+// SetPromptBudget) are measured with the provider's Tokenizer.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// TokenizerFunc adapts a function to a Tokenizer.
+type TokenizerFunc func(text string) int
+
+func (f TokenizerFunc) Count(text string) int { return f(text) }
+
+// CharTokenizer estimates a token per 4 characters, about right for English text. It
+// is used for providers without a Tokenizer of their own.
+var CharTokenizer Tokenizer = TokenizerFunc(func(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+})
+
+// WordTokenizer approximates a BPE tokenizer: whitespace is free, a run of letters or
+// digits costs a token per 4 characters (at least one), and every other character,
+// such as punctuation or a CJK ideograph, costs one.
+var WordTokenizer Tokenizer = TokenizerFunc(func(text string) int {
+	n, run := 0, 0
+	flush := func() {
+		if run > 0 {
+			n += (run + 3) / 4
+			run = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case (unicode.IsLetter(r) || unicode.IsDigit(r)) && !unicode.Is(unicode.Han, r):
+			run++
+		default:
+			flush()
+			n++
+		}
+	}
+	flush()
+	return n
+})
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = map[string]Tokenizer{}
+)
+
+// SetTokenizer sets the Tokenizer for the named provider; nil restores CharTokenizer.
+func SetTokenizer(name string, t Tokenizer) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	if t == nil {
+		delete(tokenizers, name)
+		return
+	}
+	tokenizers[name] = t
+}
+
+// tokenizerFor returns the named provider's Tokenizer, or CharTokenizer.
+func tokenizerFor(name string) Tokenizer {
+	tokenizersMu.RLock()
+	defer tokenizersMu.RUnlock()
+	if t, ok := tokenizers[name]; ok {
+		return t
+	}
+	return CharTokenizer
+}
+
+// tokenizersFromEnv applies TOKENIZER_<NAME>=words|chars for every registered provider.
+func tokenizersFromEnv() {
+	for name := range providers {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		switch strings.ToLower(os.Getenv("TOKENIZER_" + key)) {
+		case "words":
+			SetTokenizer(name, WordTokenizer)
+		case "chars":
+			SetTokenizer(name, CharTokenizer)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTokenizers(t *testing.T) {
+	tests := []struct {
+		text        string
+		chars, word int
+	}{
+		{"", 0, 0},
+		{"hello", 2, 2},
+		{"hello, world!", 4, 6},
+		{"a b c d e f", 3, 6},
+		{"internationalization", 5, 5},
+		{"日本語です", 2, 4}, // an ideograph each, kana like letters
+	}
+	for _, tt := range tests {
+		if got := CharTokenizer.Count(tt.text); got != tt.chars {
+			t.Errorf("CharTokenizer(%q) = %d, want %d", tt.text, got, tt.chars)
+		}
+		if got := WordTokenizer.Count(tt.text); got != tt.word {
+			t.Errorf("WordTokenizer(%q) = %d, want %d", tt.text, got, tt.word)
+		}
+	}
+}
+
+func TestCustomTokenizerDrivesBudget(t *testing.T) {
+	var sent string
+	register(t, "tokenizer-test", promptRecorder(&sent))
+	SetPromptBudget("tokenizer-test", 50)
+	t.Cleanup(func() {
+		SetPromptBudget("tokenizer-test", 0)
+		SetTokenizer("tokenizer-test", nil)
+	})
+	prompt := strings.Repeat("word ", 20) // 100 characters
+
+	// the default char/4 estimate makes it 25 tokens, well within the budget
+	if n := tokenizerFor("tokenizer-test").Count(prompt); n != 25 {
+		t.Fatalf("default tokenizer counted %d tokens, want CharTokenizer's 25", n)
+	}
+	var res Result
+	if _, err := collect(t, WithResult(context.Background(), &res), "tokenizer-test", prompt); err != nil {
+		t.Fatal(err)
+	}
+	if sent != prompt || res.Truncated {
+		t.Fatalf("sent %q (truncated %v), want the prompt as is", sent, res.Truncated)
+	}
+
+	// a tokenizer that counts every character makes it 100 tokens, twice the budget
+	perChar := TokenizerFunc(func(s string) int { return len([]rune(s)) })
+	SetTokenizer("tokenizer-test", perChar)
+	res = Result{}
+	if _, err := collect(t, WithResult(context.Background(), &res), "tokenizer-test", prompt); err != nil {
+		t.Fatal(err)
+	}
+	if n := perChar.Count(sent); n > 50 || !res.Truncated {
+		t.Fatalf("sent %d tokens (truncated %v) with a budget of 50", n, res.Truncated)
+	}
+
+	SetTokenizer("tokenizer-test", nil)
+	if n := tokenizerFor("tokenizer-test").Count(prompt); n != 25 {
+		t.Fatalf("after SetTokenizer(nil) %d tokens, want CharTokenizer's 25", n)
+	}
+}
+
+func TestTokenizersFromEnv(t *testing.T) {
+	register(t, "tokenizer-env", &ScriptedProvider{})
+	t.Setenv("TOKENIZER_TOKENIZER_ENV", "words")
+	t.Cleanup(func() { SetTokenizer("tokenizer-env", nil) })
+	tokenizersFromEnv()
+	if got := tokenizerFor("tokenizer-env").Count("a b c d"); got != 4 {
+		t.Fatalf("TOKENIZER_TOKENIZER_ENV=words counted %d tokens for 4 words, want WordTokenizer's 4 (CharTokenizer says 2)", got)
+	}
+}
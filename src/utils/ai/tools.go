@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Tool is a Go function the model can call through OpenAI-style function calling.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any // JSON Schema for the arguments object
+	Call        func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// ToolCall is one function call requested by the model, with the outcome of running it.
+type ToolCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Output    string          `json:"output,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+var (
+	toolsMu sync.RWMutex
+	tools   = map[string]Tool{}
+)
+
+// RegisterTool makes a tool available to providers that support function calling.
+func RegisterTool(t Tool) {
+	toolsMu.Lock()
+	defer toolsMu.Unlock()
+	tools[t.Name] = t
+}
+
+// ToolObserver is told about each tool call DispatchToolCalls handles: once with done
+// false before the tool runs, and once with done true and the call's Output or Error.
+type ToolObserver func(call ToolCall, done bool)
+
+type toolObserverKey struct{}
+
+// WithToolObserver returns a context whose tool calls are reported to fn.
+func WithToolObserver(ctx context.Context, fn ToolObserver) context.Context {
+	return context.WithValue(ctx, toolObserverKey{}, fn)
+}
+
+// observeTool reports a call to the request's observer, if any.
+func observeTool(ctx context.Context, call ToolCall, done bool) {
+	if fn, _ := ctx.Value(toolObserverKey{}).(ToolObserver); fn != nil {
+		fn(call, done)
+	}
+}
+
+type noToolDispatchKey struct{}
+
+// withoutToolDispatch marks ctx so the tool calls a provider parses are recorded but
+// never run, for requests whose side effects must not happen twice, such as shadow
+// traffic.
+func withoutToolDispatch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noToolDispatchKey{}, true)
+}
+
+// toolDefinitions returns the registered tools in the chat completions "tools" format,
+// or nil when none are registered.
+func toolDefinitions() []map[string]any {
+	toolsMu.RLock()
+	defer toolsMu.RUnlock()
+	if len(tools) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	defs := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		t := tools[name]
+		params := t.Parameters
+		if params == nil {
+			params = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		defs = append(defs, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  params,
+			},
+		})
+	}
+	return defs
+}
+
+// toolCallDelta is one tool_calls entry of a streamed chat completions delta. The first
+// delta for a call carries its id and name; later ones only add argument fragments.
+type toolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// toolCallAccumulator reassembles streamed tool calls. Fragments are keyed by index,
+// so several calls streamed in parallel within one response stay separate.
+type toolCallAccumulator struct {
+	calls map[int]*pendingToolCall
+}
+
+type pendingToolCall struct {
+	id, name string
+	args     []byte
+}
+
+func (a *toolCallAccumulator) add(d toolCallDelta) {
+	if a.calls == nil {
+		a.calls = map[int]*pendingToolCall{}
+	}
+	c, ok := a.calls[d.Index]
+	if !ok {
+		c = &pendingToolCall{}
+		a.calls[d.Index] = c
+	}
+	if d.ID != "" {
+		c.id = d.ID
+	}
+	if d.Function.Name != "" {
+		c.name += d.Function.Name
+	}
+	c.args = append(c.args, d.Function.Arguments...)
+}
+
+// flush returns the accumulated calls in index order and resets the accumulator.
+// Arguments that don't form valid JSON are reported on the call instead of dispatched.
+func (a *toolCallAccumulator) flush() []ToolCall {
+	if len(a.calls) == 0 {
+		return nil
+	}
+	idx := make([]int, 0, len(a.calls))
+	for i := range a.calls {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	out := make([]ToolCall, 0, len(idx))
+	for _, i := range idx {
+		c := a.calls[i]
+		call := ToolCall{ID: c.id, Name: c.name, Arguments: json.RawMessage(c.args)}
+		if len(c.args) == 0 {
+			call.Arguments = json.RawMessage("{}")
+		} else if !json.Valid(c.args) {
+			call.Error = "invalid arguments JSON"
+		}
+		out = append(out, call)
+	}
+	a.calls = nil
+	return out
+}
+
+// DispatchToolCalls runs each call against the registered tools and fills in its
+// Output or Error. Calls that already carry an error, such as malformed arguments,
+// are not run. If the request's provider doesn't support tools, or the request must
+// not have side effects (see withoutToolDispatch), every call fails with that reason.
+// Each call is reported to the request's ToolObserver before and after it runs.
+func DispatchToolCalls(ctx context.Context, calls []ToolCall) []ToolCall {
+	if ctx.Value(noToolDispatchKey{}) != nil {
+		for i := range calls {
+			if calls[i].Error == "" {
+				calls[i].Error = "tool calls are not run for this request"
+			}
+		}
+		return calls
+	}
+	if name := ProviderFrom(ctx); name != "" {
+		if err := CheckCapabilities(name, Capabilities{Tools: true}); err != nil {
+			for i := range calls {
+				calls[i].Error = err.Error()
+			}
+			return calls
+		}
+	}
+	for i := range calls {
+		c := &calls[i]
+		observeTool(ctx, *c, false)
+		dispatchToolCall(ctx, c)
+		observeTool(ctx, *c, true)
+	}
+	return calls
+}
+
+// dispatchToolCall runs one call and records its Output or Error.
+func dispatchToolCall(ctx context.Context, c *ToolCall) {
+	if c.Error != "" {
+		return
+	}
+	toolsMu.RLock()
+	t, ok := tools[c.Name]
+	toolsMu.RUnlock()
+	if !ok || t.Call == nil {
+		c.Error = fmt.Sprintf("unknown tool %q", c.Name)
+		return
+	}
+	out, err := t.Call(ctx, c.Arguments)
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	c.Output = out
+}
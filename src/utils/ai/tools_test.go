@@ -0,0 +1,106 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// registerTool makes tool available for the duration of the test.
+func registerTool(t *testing.T, tool Tool) {
+	t.Helper()
+	RegisterTool(tool)
+	t.Cleanup(func() {
+		toolsMu.Lock()
+		delete(tools, tool.Name)
+		toolsMu.Unlock()
+	})
+}
+
+// delta is a tool_calls entry as it appears in one streamed chunk.
+func delta(index int, id, name, args string) toolCallDelta {
+	var d toolCallDelta
+	d.Index, d.ID = index, id
+	d.Function.Name, d.Function.Arguments = name, args
+	return d
+}
+
+func TestToolCallAccumulatorParallelFragments(t *testing.T) {
+	var acc toolCallAccumulator
+	// two calls streamed in parallel, their argument fragments interleaved
+	for _, d := range []toolCallDelta{
+		delta(0, "c0", "weather", ""),
+		delta(1, "c1", "time", `{"zone"`),
+		delta(0, "", "", `{"city":`),
+		delta(1, "", "", `:"UTC"}`),
+		delta(0, "", "", `"Oslo"}`),
+		delta(2, "c2", "broken", `{"x":`),
+	} {
+		acc.add(d)
+	}
+	calls := acc.flush()
+	if len(calls) != 3 {
+		t.Fatalf("flush = %+v, want 3 calls", calls)
+	}
+	if c := calls[0]; c.ID != "c0" || c.Name != "weather" || string(c.Arguments) != `{"city":"Oslo"}` || c.Error != "" {
+		t.Errorf("call 0 = %+v", c)
+	}
+	if c := calls[1]; c.ID != "c1" || c.Name != "time" || string(c.Arguments) != `{"zone":"UTC"}` {
+		t.Errorf("call 1 = %+v", c)
+	}
+	if c := calls[2]; c.Error != "invalid arguments JSON" {
+		t.Errorf("call 2 with truncated arguments = %+v, want an error", c)
+	}
+	if again := acc.flush(); again != nil {
+		t.Fatalf("second flush = %+v, want the accumulator reset", again)
+	}
+
+	acc.add(delta(0, "c3", "noargs", ""))
+	if calls := acc.flush(); string(calls[0].Arguments) != "{}" {
+		t.Fatalf("call without arguments = %s, want {}", calls[0].Arguments)
+	}
+}
+
+func TestDispatchToolCalls(t *testing.T) {
+	registerTool(t, Tool{Name: "test-echo", Call: func(ctx context.Context, args json.RawMessage) (string, error) {
+		var in struct{ Text string }
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+		return in.Text, nil
+	}})
+	registerTool(t, Tool{Name: "test-fail", Call: func(context.Context, json.RawMessage) (string, error) {
+		return "", errors.New("tool broke")
+	}})
+
+	var observed []string
+	ctx := WithToolObserver(context.Background(), func(c ToolCall, done bool) {
+		observed = append(observed, fmt.Sprintf("%s:%v", c.Name, done))
+	})
+	calls := DispatchToolCalls(ctx, []ToolCall{
+		{Name: "test-echo", Arguments: json.RawMessage(`{"text":"hi"}`)},
+		{Name: "test-fail", Arguments: json.RawMessage(`{}`)},
+		{Name: "test-missing", Arguments: json.RawMessage(`{}`)},
+		{Name: "test-echo", Error: "invalid arguments JSON"},
+	})
+
+	if calls[0].Output != "hi" || calls[0].Error != "" {
+		t.Errorf("echo call = %+v", calls[0])
+	}
+	if calls[1].Error != "tool broke" {
+		t.Errorf("failing call = %+v", calls[1])
+	}
+	if calls[2].Error != `unknown tool "test-missing"` {
+		t.Errorf("unknown tool call = %+v", calls[2])
+	}
+	if calls[3].Output != "" || calls[3].Error != "invalid arguments JSON" {
+		t.Errorf("malformed call was run: %+v", calls[3])
+	}
+	want := fmt.Sprint([]string{"test-echo:false", "test-echo:true", "test-fail:false", "test-fail:true",
+		"test-missing:false", "test-missing:true", "test-echo:false", "test-echo:true"})
+	if fmt.Sprint(observed) != want {
+		t.Errorf("observer saw %v, want %v", observed, want)
+	}
+}
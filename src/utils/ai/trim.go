@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	trimMu sync.RWMutex
+	trims  = map[string]bool{}
+)
+
+// SetTrimWhitespace turns on trimming of a provider's response at its boundaries:
+// leading whitespace before the first content and trailing whitespace after the last
+// is dropped, while whitespace inside the response is kept as sent.
+func SetTrimWhitespace(name string, on bool) {
+	trimMu.Lock()
+	defer trimMu.Unlock()
+	if !on {
+		delete(trims, name)
+		return
+	}
+	trims[name] = true
+}
+
+func trimWhitespace(name string) bool {
+	trimMu.RLock()
+	defer trimMu.RUnlock()
+	return trims[name]
+}
+
+// withTrim drops leading whitespace until the first content, and holds back each
+// chunk's trailing whitespace until more content follows. finish discards whatever
+// whitespace is still held, which is the response's trailing whitespace.
+func withTrim(handler StreamHandler) (StreamHandler, func()) {
+	started := false
+	var held string
+	wrapped := func(chunk string) {
+		if !started {
+			chunk = strings.TrimLeftFunc(chunk, unicode.IsSpace)
+			if chunk == "" {
+				return
+			}
+			started = true
+		}
+		content := strings.TrimRightFunc(chunk, unicode.IsSpace)
+		if content == "" {
+			held += chunk
+			return
+		}
+		out := held + content
+		held = chunk[len(content):]
+		handler(out)
+	}
+	return wrapped, func() { held = "" }
+}
+
+// trimFromEnv applies TRIM_WHITESPACE_<NAME>=true for every registered provider.
+func trimFromEnv() {
+	for name := range providers {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if on, _ := strconv.ParseBool(os.Getenv("TRIM_WHITESPACE_" + key)); on {
+			SetTrimWhitespace(name, true)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package ai
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestTrimWhitespaceAtBoundaries(t *testing.T) {
+	register(t, "trim-test", &ScriptedProvider{Chunks: []string{"\n ", " Hello,  ", "\n\n", "world.\n", "\n  "}})
+
+	// off by default
+	chunks, err := collect(t, context.Background(), "trim-test", "hi")
+	if err != nil || joined(chunks) != "\n  Hello,  \n\nworld.\n\n  " {
+		t.Fatalf("untrimmed = %q, %v", joined(chunks), err)
+	}
+
+	SetTrimWhitespace("trim-test", true)
+	t.Cleanup(func() { SetTrimWhitespace("trim-test", false) })
+	chunks, err = collect(t, context.Background(), "trim-test", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joined(chunks); got != "Hello,  \n\nworld." {
+		t.Fatalf("trimmed = %q, want the boundaries trimmed and the inside untouched", got)
+	}
+	// interior whitespace travels with the content after it, not as chunks of its own
+	if want := []string{"Hello,", "  \n\nworld."}; !slices.Equal(chunks, want) {
+		t.Fatalf("chunks = %q, want %q", chunks, want)
+	}
+}
+
+func TestTrimWhitespaceOnlyResponse(t *testing.T) {
+	var out []string
+	h, finish := withTrim(func(c string) { out = append(out, c) })
+	for _, c := range []string{" ", "\n", "\t"} {
+		h(c)
+	}
+	finish()
+	if len(out) != 0 {
+		t.Fatalf("whitespace-only response delivered %q, want nothing", out)
+	}
+}
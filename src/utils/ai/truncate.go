@@ -0,0 +1,184 @@
+package ai
+
+import (
+	"context"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// truncationMarker replaces the part of a prompt that was cut to fit a budget.
+const truncationMarker = "\n[...truncated...]\n"
+
+var (
+	budgetsMu sync.RWMutex
+	budgets   = map[string]int{}
+)
+
+// SetPromptBudget limits the prompt sent to the named provider to n tokens, as counted
+// by its Tokenizer (see SetTokenizer; by default about 4 characters per token).
+// A conversation (see WithMessages) loses its oldest turns first, keeping the system
+// message and the latest prompt. Search-augmented providers drop their lowest-ranked
+// results first. Anything still over budget loses its middle, so the instructions at
+// the start and the question at the end survive. n <= 0 removes the limit.
+func SetPromptBudget(name string, n int) {
+	budgetsMu.Lock()
+	defer budgetsMu.Unlock()
+	if n <= 0 {
+		delete(budgets, name)
+		return
+	}
+	budgets[name] = n
+}
+
+func promptBudget(name string) int {
+	budgetsMu.RLock()
+	defer budgetsMu.RUnlock()
+	return budgets[name]
+}
+
+// fitPrompt cuts prompt to the budget of the request's provider and records on the
+// Result whether it had to.
+func fitPrompt(ctx context.Context, prompt string) string {
+	name := ProviderFrom(ctx)
+	budget := promptBudget(name)
+	out, cut := truncateMiddle(prompt, budget, tokenizerFor(name))
+	if cut > 0 {
+		log.Printf("prompt: truncated %d characters to fit budget of %d tokens", cut, budget)
+		markTruncated(ctx, cut)
+	}
+	return out
+}
+
+// fitConversation fits the request's history (see WithMessages) and prompt to the
+// provider's budget. Providers that take messages get the trimmed history in the
+// returned context; for the others history and prompt are rendered as one transcript
+// and the context carries no history, so they and anything they call see a plain prompt.
+func fitConversation(ctx context.Context, prompt string) (context.Context, string) {
+	history := MessagesFrom(ctx)
+	if len(history) == 0 {
+		return ctx, prompt
+	}
+	name := ProviderFrom(ctx)
+	budget, tok := promptBudget(name), tokenizerFor(name)
+	if budget > 0 {
+		// leave room for the provider's prompt template
+		budget = max(budget-tok.Count(wrapPrompt(name, "")), 1)
+	}
+	history, prompt, cut := fitHistory(history, prompt, budget, tok)
+	if cut > 0 {
+		log.Printf("prompt: dropped %d characters of conversation to fit budget of %d tokens", cut, budget)
+		markTruncated(ctx, cut)
+	}
+	if capabilitiesOf(providers[name]).Messages {
+		return WithMessages(ctx, history), prompt
+	}
+	return WithMessages(ctx, nil), Transcript(history, prompt)
+}
+
+// fitHistory drops the oldest turns of history, each a user message and the replies
+// to it, until its transcript with prompt fits budget tokens. System messages are
+// always kept; if they and prompt alone are over budget the prompt loses its middle.
+// It returns what is left and how many characters were removed.
+func fitHistory(history []Message, prompt string, budget int, tok Tokenizer) ([]Message, string, int) {
+	full := utf8.RuneCountInString(Transcript(history, prompt))
+	if budget <= 0 || tok.Count(Transcript(history, prompt)) <= budget {
+		return history, prompt, 0
+	}
+	kept := append([]Message(nil), history...)
+	for tok.Count(Transcript(kept, prompt)) > budget {
+		first := slices.IndexFunc(kept, func(m Message) bool { return m.Role != RoleSystem })
+		if first < 0 {
+			break
+		}
+		// the turn runs until the next user or system message
+		end := first + 1
+		for end < len(kept) && kept[end].Role == RoleAssistant {
+			end++
+		}
+		kept = slices.Delete(kept, first, end)
+	}
+	if tok.Count(Transcript(kept, prompt)) > budget {
+		if room := budget - tok.Count(Transcript(kept, "")); room > 0 {
+			prompt, _ = truncateMiddle(prompt, room, tok)
+		}
+	}
+	return kept, prompt, full - utf8.RuneCountInString(Transcript(kept, prompt))
+}
+
+func markTruncated(ctx context.Context, cut int) {
+	if res := ResultFrom(ctx); res != nil {
+		res.Truncated = true
+		res.TruncatedChars += cut
+	}
+}
+
+// truncateMiddle shortens s to at most budget tokens by cutting from the middle,
+// keeping a third of what remains from the head and the rest from the tail. It
+// returns the result and how many runes were removed. budget <= 0 means no limit.
+func truncateMiddle(s string, budget int, tok Tokenizer) (string, int) {
+	if budget <= 0 || tok.Count(s) <= budget {
+		return s, 0
+	}
+	r := []rune(s)
+	n := len(r)
+	cut := func(keep int) string {
+		head := keep / 3
+		return string(r[:head]) + truncationMarker + string(r[n-(keep-head):])
+	}
+	if tok.Count(cut(0)) > budget {
+		// not even the marker fits; keep as much of the tail as does
+		lo, hi := 0, n
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if tok.Count(string(r[n-mid:])) <= budget {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		return string(r[n-lo:]), n - lo
+	}
+	// the most runes whose cut version fits; counts grow with the runes kept
+	lo, hi := 0, n-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if tok.Count(cut(mid)) <= budget {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return cut(lo), n - lo
+}
+
+// fitSearchResults drops trailing results until the augmented prompt fits budget
+// tokens. It returns the results to use and how many characters were shed.
+func fitSearchResults(prompt string, results []string, budget int, tok Tokenizer) ([]string, int) {
+	if budget <= 0 {
+		return results, 0
+	}
+	full := utf8.RuneCountInString(buildSearchPrompt(prompt, results))
+	for len(results) > 0 && tok.Count(buildSearchPrompt(prompt, results)) > budget {
+		results = results[:len(results)-1]
+	}
+	if len(results) == 0 {
+		return nil, full - utf8.RuneCountInString(prompt)
+	}
+	return results, full - utf8.RuneCountInString(buildSearchPrompt(prompt, results))
+}
+
+// promptBudgetsFromEnv applies PROMPT_BUDGET_<NAME> (e.g. PROMPT_BUDGET_OLLAMA_SEARCH=8000)
+// for every registered provider.
+func promptBudgetsFromEnv() {
+	for name := range providers {
+		key := "PROMPT_BUDGET_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+			SetPromptBudget(name, n)
+		}
+	}
+}
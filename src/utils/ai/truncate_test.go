@@ -0,0 +1,129 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// runes counts a token per character, so budgets in tests are exact.
+var runes = TokenizerFunc(utf8.RuneCountInString)
+
+func TestTruncateMiddle(t *testing.T) {
+	s := strings.Repeat("a", 50) + strings.Repeat("b", 100) + strings.Repeat("c", 50)
+	out, cut := truncateMiddle(s, 100, runes)
+	if n := runes.Count(out); n > 100 {
+		t.Fatalf("result has %d tokens, want <= 100", n)
+	}
+	if !strings.HasPrefix(out, "aaaa") || !strings.HasSuffix(out, "cccc") || !strings.Contains(out, truncationMarker) {
+		t.Fatalf("result %q should keep both ends around the marker", out)
+	}
+	if cut != utf8.RuneCountInString(s)-utf8.RuneCountInString(strings.Replace(out, truncationMarker, "", 1)) {
+		t.Fatalf("cut = %d doesn't match what was removed", cut)
+	}
+	if out, cut := truncateMiddle(s, 0, runes); out != s || cut != 0 {
+		t.Fatal("budget 0 should leave the prompt alone")
+	}
+	if out, cut := truncateMiddle("héllo wörld", 5, runes); cut == 0 || !utf8.ValidString(out) || runes.Count(out) > 5 {
+		t.Fatalf("tiny budget = %q, %d", out, cut)
+	}
+}
+
+// longHistory is a system message followed by n turns, each about 40 characters.
+func longHistory(n int) []Message {
+	history := []Message{{Role: RoleSystem, Content: "You are terse."}}
+	for i := 1; i <= n; i++ {
+		history = append(history,
+			Message{Role: RoleUser, Content: fmt.Sprintf("question number %d", i)},
+			Message{Role: RoleAssistant, Content: fmt.Sprintf("answer number %d", i)})
+	}
+	return history
+}
+
+func TestFitHistoryDropsOldestTurns(t *testing.T) {
+	history := longHistory(20)
+	budget := 200
+	kept, prompt, cut := fitHistory(history, "latest question", budget, runes)
+
+	if got := runes.Count(Transcript(kept, prompt)); got > budget {
+		t.Fatalf("transcript has %d tokens, want <= %d", got, budget)
+	}
+	if prompt != "latest question" {
+		t.Fatalf("prompt changed to %q", prompt)
+	}
+	if kept[0] != history[0] {
+		t.Fatalf("system message dropped: %+v", kept[0])
+	}
+	// whole turns from the end survive: user then assistant, the newest last
+	rest := kept[1:]
+	if len(rest) == 0 || len(rest)%2 != 0 || rest[0].Role != RoleUser {
+		t.Fatalf("kept %+v, want whole turns", rest)
+	}
+	if last := rest[len(rest)-1]; last != history[len(history)-1] {
+		t.Fatalf("newest turn dropped; last kept %+v", last)
+	}
+	if rest[0] == history[1] {
+		t.Fatal("oldest turn kept")
+	}
+	full := utf8.RuneCountInString(Transcript(history, "latest question"))
+	if want := full - utf8.RuneCountInString(Transcript(kept, prompt)); cut != want {
+		t.Fatalf("cut = %d, want %d", cut, want)
+	}
+
+	if kept, _, cut := fitHistory(history, "q", 10000, runes); len(kept) != len(history) || cut != 0 {
+		t.Fatal("history within budget should be left alone")
+	}
+}
+
+func TestFitHistoryShortensPromptLast(t *testing.T) {
+	history := longHistory(3)
+	prompt := strings.Repeat("long question ", 20)
+	kept, out, cut := fitHistory(history, prompt, 120, runes)
+	if len(kept) != 1 || kept[0].Role != RoleSystem {
+		t.Fatalf("kept %+v, want only the system message", kept)
+	}
+	if cut == 0 || out == prompt || !strings.Contains(out, truncationMarker) {
+		t.Fatalf("prompt not shortened: %q", out)
+	}
+	if got := runes.Count(Transcript(kept, out)); got > 120 {
+		t.Fatalf("transcript has %d tokens, want <= 120", got)
+	}
+}
+
+func TestStreamFitsConversationToBudget(t *testing.T) {
+	var sent string
+	register(t, "truncate-test", providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		if MessagesFrom(ctx) != nil {
+			t.Error("provider was given the history as well as the transcript")
+		}
+		sent = prompt
+		handler("ok")
+		return nil
+	}))
+	SetPromptBudget("truncate-test", 200)
+	SetTokenizer("truncate-test", runes)
+	t.Cleanup(func() {
+		SetPromptBudget("truncate-test", 0)
+		SetTokenizer("truncate-test", nil)
+	})
+
+	var res Result
+	ctx := WithMessages(WithResult(context.Background(), &res), longHistory(20))
+	if _, err := collect(t, ctx, "truncate-test", "latest question"); err != nil {
+		t.Fatal(err)
+	}
+	if runes.Count(sent) > 200 {
+		t.Fatalf("sent %d tokens, over the budget of 200:\n%s", runes.Count(sent), sent)
+	}
+	if !strings.HasPrefix(sent, "System: You are terse.\n") || !strings.HasSuffix(sent, "User: latest question\nAssistant:") {
+		t.Fatalf("system message or latest prompt missing:\n%s", sent)
+	}
+	if strings.Contains(sent, "question number 1\n") || !strings.Contains(sent, "answer number 20\n") {
+		t.Fatalf("want the oldest turns dropped and the newest kept:\n%s", sent)
+	}
+	if !res.Truncated || res.TruncatedChars == 0 {
+		t.Fatalf("result = %+v, want Truncated", res)
+	}
+}
@@ -0,0 +1,46 @@
+package ai
+
+import "unicode/utf8"
+
+// withRuneBoundaries makes sure handler only sees chunks made of whole UTF-8 sequences.
+// A provider that splits a multibyte character across chunks has the incomplete tail
+// held back and prepended to the next chunk, so stop-sequence and strip scanning, TTS
+// and clients never see half a character. The returned flush function must be called
+// when streaming ends; it delivers anything still held back, even if it never completed.
+func withRuneBoundaries(handler StreamHandler) (StreamHandler, func()) {
+	var pending string
+	wrapped := func(chunk string) {
+		if pending != "" {
+			chunk = pending + chunk
+			pending = ""
+		}
+		if cut := incompleteSuffix(chunk); cut < len(chunk) {
+			pending = chunk[cut:]
+			chunk = chunk[:cut]
+		}
+		if chunk != "" {
+			handler(chunk)
+		}
+	}
+	flush := func() {
+		if pending != "" {
+			handler(pending)
+			pending = ""
+		}
+	}
+	return wrapped, flush
+}
+
+// incompleteSuffix returns the index where a trailing, not yet complete UTF-8 sequence
+// starts in s, or len(s) if s ends on a character boundary.
+func incompleteSuffix(s string) int {
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if utf8.FullRuneInString(s[i:]) {
+				return len(s)
+			}
+			return i
+		}
+	}
+	return len(s)
+}
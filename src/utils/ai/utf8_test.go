@@ -0,0 +1,62 @@
+package ai
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWithRuneBoundaries(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{"ascii untouched", []string{"ab", "cd"}, []string{"ab", "cd"}},
+		{"two-byte split", []string{"caf\xc3", "\xa9!"}, []string{"caf", "é!"}},
+		{"emoji over three chunks", []string{"hi \xf0\x9f", "\x98", "\x80 there"}, []string{"hi ", "😀 there"}},
+		{"chunk of only a fragment", []string{"\xe4", "\xb8\x96"}, []string{"世"}},
+		// a sequence that never completes is still delivered at the end
+		{"truncated at end", []string{"ok \xe4\xb8"}, []string{"ok ", "\xe4\xb8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []string
+			h, flush := withRuneBoundaries(func(c string) { out = append(out, c) })
+			for _, c := range tt.chunks {
+				h(c)
+			}
+			flush()
+			if !slices.Equal(out, tt.want) {
+				t.Fatalf("chunks = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamMultibyteSplitAcrossChunks(t *testing.T) {
+	text := "naïve 世界 😀 done"
+	register(t, "utf8-test", providerFunc(func(ctx context.Context, prompt string, handler StreamHandler) error {
+		// one byte at a time, splitting every multibyte character
+		for i := range len(text) {
+			handler(text[i : i+1])
+		}
+		return nil
+	}))
+
+	// a stop sequence that never matches still scans every chunk
+	ctx := WithOptions(context.Background(), Options{StopSequences: []string{"世界 😀 never"}})
+	chunks, err := collect(t, ctx, "utf8-test", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range chunks {
+		if !utf8.ValidString(c) {
+			t.Fatalf("chunk %q is not valid UTF-8", c)
+		}
+	}
+	if joined(chunks) != text {
+		t.Fatalf("output = %q, want %q", joined(chunks), text)
+	}
+}
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// bodyError looks for field (a dot-separated path such as "error" or "response.error")
+// in a JSON document and returns it as an error if it is present and non-empty.
+// Data that isn't a JSON object never produces an error.
+func bodyError(data []byte, field string) error {
+	data = []byte(strings.TrimSpace(string(data)))
+	if field == "" || len(data) == 0 || data[0] != '{' {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	for _, key := range strings.Split(field, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	msg := errorMessage(v)
+	if msg == "" {
+		return nil
+	}
+	return &ProviderError{StatusCode: 200, Msg: "upstream error: " + msg}
+}
+
+// errorMessage renders an error value from a response body, preferring a "message" field.
+func errorMessage(v any) string {
+	switch e := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return e
+	case bool:
+		if e {
+			return "error flag set"
+		}
+		return ""
+	case map[string]any:
+		if m, ok := e["message"].(string); ok && m != "" {
+			return m
+		}
+		if len(e) == 0 {
+			return ""
+		}
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,66 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyError(t *testing.T) {
+	tests := []struct {
+		body, field, want string
+	}{
+		{`{"error":{"message":"rate limited","code":429}}`, "error", "upstream error: rate limited"},
+		{`{"error":"model not found"}`, "error", "upstream error: model not found"},
+		{`{"status":{"failed":true}}`, "status.failed", "upstream error: error flag set"},
+		{`{"error":null,"response":"fine"}`, "error", ""},
+		{`{"error":{"message":"ignored"}}`, "", ""},
+		{`not json`, "error", ""},
+	}
+	for _, tt := range tests {
+		err := bodyError([]byte(tt.body), tt.field)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.Contains(got, tt.want) || (tt.want == "") != (err == nil) {
+			t.Errorf("bodyError(%s, %q) = %v, want %q", tt.body, tt.field, err, tt.want)
+		}
+	}
+}
+
+func TestErrorFieldInOKResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" {
+			fmt.Fprintln(w, `{"response":"partial "}`)
+		}
+		fmt.Fprintln(w, `{"error":{"message":"content filtered"}}`)
+	}))
+	defer upstream.Close()
+
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprint("stream=", stream), func(t *testing.T) {
+			endpoint := upstream.URL
+			if stream {
+				endpoint += "/stream"
+			}
+			h := NewHTTPProvider(endpoint, "", "", stream)
+			h.Format = FormatNDJSON
+			h.ErrorField = "error"
+			register(t, "error-field-test", h)
+
+			chunks, err := collect(t, context.Background(), "error-field-test", "hi")
+			var pe *ProviderError
+			if !errors.As(err, &pe) || pe.StatusCode != http.StatusOK || !strings.Contains(err.Error(), "content filtered") {
+				t.Fatalf("err = %v, want a ProviderError with the body's message", err)
+			}
+			if strings.Contains(joined(chunks), "content filtered") {
+				t.Fatalf("error body streamed as content: %q", chunks)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package ai
+
+import (
+	"context"
+	"j-project/src/utils/redact"
+	"log"
+	"sync"
+	"time"
+)
+
+// WarmupTimeout bounds each provider's warm-up request. Loading a large Ollama model
+// from disk can take a while, so it is generous.
+var WarmupTimeout = 60 * time.Second
+
+// Warmup sends a tiny prompt to each named provider concurrently and discards the
+// output, so that e.g. Ollama has the model loaded before the first real request.
+// Providers are called directly, bypassing the breaker and concurrency limits, so a
+// slow or failing warm-up is only logged and never counts against the provider.
+// Warmup returns once every provider has answered, failed or timed out.
+func Warmup(ctx context.Context, names ...string) {
+	var wg sync.WaitGroup
+	for _, name := range names {
+		p, err := Lookup(name)
+		if err != nil {
+			log.Printf("warmup: %v", err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, WarmupTimeout)
+			defer cancel()
+			one := 1
+			ctx = WithOptions(WithProvider(ctx, name), Options{MaxTokens: &one})
+			start := time.Now()
+			if err := p.Stream(ctx, "hi", func(string) {}); err != nil {
+				log.Printf("warmup: %s failed after %s: %s", name, time.Since(start).Round(time.Millisecond), redact.Scrub(err.Error()))
+				return
+			}
+			log.Printf("warmup: %s ready in %s", name, time.Since(start).Round(time.Millisecond))
+		}()
+	}
+	wg.Wait()
+}
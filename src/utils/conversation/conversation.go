@@ -0,0 +1,100 @@
+package conversation
+
+import (
+	"j-project/src/utils/ai"
+	"sync"
+	"time"
+)
+
+// Turn is one exchange: a user prompt and the assistant's response to it.
+type Turn struct {
+	User      string `json:"user"`
+	Assistant string `json:"assistant"`
+}
+
+// Store keeps recent conversation history per session in memory. Sessions expire
+// after TTL without activity and keep at most MaxTurns turns, oldest dropped first.
+type Store struct {
+	TTL      time.Duration
+	MaxTurns int
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+type session struct {
+	turns    []Turn
+	lastUsed time.Time
+}
+
+// NewStore creates a Store. maxTurns <= 0 keeps every turn until the session expires.
+func NewStore(ttl time.Duration, maxTurns int) *Store {
+	return &Store{TTL: ttl, MaxTurns: maxTurns, sessions: map[string]*session{}}
+}
+
+// History returns a copy of the turns recorded for id, or nil for unknown or expired
+// sessions.
+func (s *Store) History(id string) []Turn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || s.expired(sess, time.Now()) {
+		delete(s.sessions, id)
+		return nil
+	}
+	sess.lastUsed = time.Now()
+	return append([]Turn(nil), sess.turns...)
+}
+
+// Append records a turn for id, creating the session if needed. Expired sessions
+// are swept as a side effect, so memory stays bounded without a background goroutine.
+func (s *Store) Append(id string, t Turn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, sess := range s.sessions {
+		if s.expired(sess, now) {
+			delete(s.sessions, k)
+		}
+	}
+	sess, ok := s.sessions[id]
+	if !ok {
+		sess = &session{}
+		s.sessions[id] = sess
+	}
+	sess.turns = append(sess.turns, t)
+	if s.MaxTurns > 0 && len(sess.turns) > s.MaxTurns {
+		sess.turns = append([]Turn(nil), sess.turns[len(sess.turns)-s.MaxTurns:]...)
+	}
+	sess.lastUsed = now
+}
+
+// Reset forgets the history of id.
+func (s *Store) Reset(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// Len returns the number of live sessions.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func (s *Store) expired(sess *session, now time.Time) bool {
+	return s.TTL > 0 && now.Sub(sess.lastUsed) > s.TTL
+}
+
+// Messages returns history as chat messages, oldest first, for ai.WithMessages.
+func Messages(history []Turn) []ai.Message {
+	if len(history) == 0 {
+		return nil
+	}
+	out := make([]ai.Message, 0, 2*len(history))
+	for _, t := range history {
+		out = append(out, ai.Message{Role: ai.RoleUser, Content: t.User}, ai.Message{Role: ai.RoleAssistant, Content: t.Assistant})
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package conversation
+
+import (
+	"j-project/src/utils/ai"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStoreKeepsLatestTurns(t *testing.T) {
+	s := NewStore(time.Minute, 2)
+	for _, u := range []string{"one", "two", "three"} {
+		s.Append("a", Turn{User: u, Assistant: u + "!"})
+	}
+	s.Append("b", Turn{User: "other"})
+
+	got := s.History("a")
+	want := []Turn{{"two", "two!"}, {"three", "three!"}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("History = %+v, want %+v", got, want)
+	}
+	// a copy: changing it doesn't change the store
+	got[0].User = "changed"
+	if s.History("a")[0].User != "two" {
+		t.Fatal("History returned the stored slice")
+	}
+	if s.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", s.Len())
+	}
+
+	s.Reset("a")
+	if h := s.History("a"); h != nil {
+		t.Fatalf("History after Reset = %+v", h)
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	s := NewStore(20*time.Millisecond, 0)
+	s.Append("a", Turn{User: "hi"})
+	time.Sleep(40 * time.Millisecond)
+	if h := s.History("a"); h != nil {
+		t.Fatalf("expired session returned %+v", h)
+	}
+	s.Append("b", Turn{User: "hi"})
+	if s.Len() != 1 {
+		t.Fatalf("Len = %d, want expired sessions swept", s.Len())
+	}
+}
+
+func TestMessages(t *testing.T) {
+	if m := Messages(nil); m != nil {
+		t.Fatalf("Messages(nil) = %+v", m)
+	}
+	got := Messages([]Turn{{"hi", "hello"}, {"how are you?", "fine"}})
+	want := []ai.Message{
+		{Role: ai.RoleUser, Content: "hi"}, {Role: ai.RoleAssistant, Content: "hello"},
+		{Role: ai.RoleUser, Content: "how are you?"}, {Role: ai.RoleAssistant, Content: "fine"},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Messages = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,240 @@
+package dump
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queueSize is the number of chunks buffered per stream before writes start dropping.
+const queueSize = 256
+
+// Recorder writes each stream's raw response and a JSON metadata sidecar into a directory.
+// Writes happen on a background goroutine so a slow disk never blocks the live stream.
+type Recorder struct {
+	Dir string
+}
+
+// NewRecorder creates a Recorder writing into dir, creating the directory if needed.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Recorder{Dir: dir}, nil
+}
+
+// Meta is the sidecar written next to each dumped response.
+type Meta struct {
+	ID           string    `json:"id"`
+	Provider     string    `json:"provider"`
+	Prompt       string    `json:"prompt"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	DurationMs   int64     `json:"duration_ms"`
+	FirstChunkMs int64     `json:"first_chunk_ms,omitempty"`
+	Chunks       int       `json:"chunks"`
+	Bytes        int       `json:"bytes"`
+	Dropped      int       `json:"dropped,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Stream is a single in-progress dump. Write and Close may be called from the stream goroutine.
+type Stream struct {
+	path string
+	ch   chan string
+	done chan struct{}
+
+	mu   sync.Mutex
+	meta Meta
+}
+
+// Start begins dumping a new stream. It never fails: if the file can't be created the
+// stream is still returned and the error is logged and recorded in the sidecar.
+func (r *Recorder) Start(provider, prompt string) *Stream {
+	id := newID()
+	s := &Stream{
+		path: filepath.Join(r.Dir, id),
+		ch:   make(chan string, queueSize),
+		done: make(chan struct{}),
+		meta: Meta{ID: id, Provider: provider, Prompt: prompt, Start: time.Now()},
+	}
+	go s.run()
+	return s
+}
+
+// ID returns the identifier used for the dump files.
+func (s *Stream) ID() string {
+	return s.meta.ID
+}
+
+// Write queues a chunk for writing. If the writer has fallen behind the chunk is dropped
+// (and counted in the sidecar) instead of blocking the caller.
+func (s *Stream) Write(chunk string) {
+	s.mu.Lock()
+	if s.meta.Chunks == 0 && s.meta.Dropped == 0 {
+		s.meta.FirstChunkMs = time.Since(s.meta.Start).Milliseconds()
+	}
+	select {
+	case s.ch <- chunk:
+		s.meta.Chunks++
+		s.meta.Bytes += len(chunk)
+	default:
+		s.meta.Dropped++
+	}
+	s.mu.Unlock()
+}
+
+// Close records the stream outcome and flushes the dump in the background.
+func (s *Stream) Close(err error) {
+	s.mu.Lock()
+	s.meta.End = time.Now()
+	s.meta.DurationMs = s.meta.End.Sub(s.meta.Start).Milliseconds()
+	if err != nil {
+		s.meta.Error = err.Error()
+	}
+	s.mu.Unlock()
+	close(s.ch)
+}
+
+// Wait blocks until the dump files have been written.
+func (s *Stream) Wait() {
+	<-s.done
+}
+
+func (s *Stream) run() {
+	defer close(s.done)
+
+	f, err := os.Create(s.path + ".txt")
+	if err != nil {
+		log.Printf("dump: create %s: %v", s.path, err)
+		// drain so writers never block on a full channel
+		for range s.ch {
+		}
+	} else {
+		w := bufio.NewWriter(f)
+		for chunk := range s.ch {
+			w.WriteString(chunk)
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("dump: write %s: %v", s.path, err)
+		}
+		f.Close()
+	}
+
+	s.mu.Lock()
+	meta := s.meta
+	s.mu.Unlock()
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		log.Printf("dump: marshal meta: %v", err)
+		return
+	}
+	if err := os.WriteFile(s.path+".json", b, 0o644); err != nil {
+		log.Printf("dump: write %s.json: %v", s.path, err)
+	}
+}
+
+func newID() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return strconv.FormatInt(time.Now().UnixMilli(), 10) + "-" + hex.EncodeToString(b[:])
+}
+
+// ErrNotFound is returned by Load when no dump exists for an ID.
+var ErrNotFound = errors.New("dump: interaction not found")
+
+// Load returns the metadata and response recorded for id.
+func (r *Recorder) Load(id string) (Meta, string, error) {
+	var meta Meta
+	if !validID(id) {
+		return meta, "", ErrNotFound
+	}
+	path := filepath.Join(r.Dir, id)
+	b, err := os.ReadFile(path + ".json")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return meta, "", ErrNotFound
+		}
+		return meta, "", err
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return meta, "", err
+	}
+	resp, err := os.ReadFile(path + ".txt")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return meta, "", err
+	}
+	return meta, string(resp), nil
+}
+
+// validID reports whether id has the shape produced by newID, which also rules out path traversal.
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffSummary compares a stored response with a new one.
+type DiffSummary struct {
+	Identical    bool    `json:"identical"`
+	OldChars     int     `json:"old_chars"`
+	NewChars     int     `json:"new_chars"`
+	CommonPrefix int     `json:"common_prefix_chars"`
+	Similarity   float64 `json:"word_similarity"` // 0..1, based on the longest common word subsequence
+}
+
+// maxDiffWords bounds the quadratic word comparison.
+const maxDiffWords = 2000
+
+// Compare summarises how a new response differs from an old one.
+func Compare(old, new string) DiffSummary {
+	d := DiffSummary{Identical: old == new, OldChars: len(old), NewChars: len(new)}
+	for d.CommonPrefix < len(old) && d.CommonPrefix < len(new) && old[d.CommonPrefix] == new[d.CommonPrefix] {
+		d.CommonPrefix++
+	}
+	a, b := strings.Fields(old), strings.Fields(new)
+	if len(a) > maxDiffWords {
+		a = a[:maxDiffWords]
+	}
+	if len(b) > maxDiffWords {
+		b = b[:maxDiffWords]
+	}
+	if len(a)+len(b) == 0 {
+		d.Similarity = 1
+		return d
+	}
+	// longest common subsequence over words, one row at a time
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				cur[j] = prev[j-1] + 1
+			case prev[j] >= cur[j-1]:
+				cur[j] = prev[j]
+			default:
+				cur[j] = cur[j-1]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	d.Similarity = 2 * float64(prev[len(b)]) / float64(len(a)+len(b))
+	return d
+}
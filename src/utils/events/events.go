@@ -0,0 +1,93 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types published by this module.
+const (
+	StreamStarted   = "stream.started"
+	StreamEnded     = "stream.ended" // Error is set when the stream failed
+	ProviderDefault = "provider.default_changed"
+	ProviderSwitch  = "provider.fallback" // a fallback chain moved on to the next provider
+	ConnOpened      = "ws.opened"
+	ConnClosed      = "ws.closed"
+)
+
+// Event is one thing that happened in the server, as sent to subscribers.
+type Event struct {
+	Time      time.Time      `json:"time"`
+	Type      string         `json:"type"`
+	Provider  string         `json:"provider,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Fields    map[string]any `json:"fields,omitempty"`
+}
+
+// Bus fans events out to subscribers. Publish never blocks: a subscriber whose buffer
+// is full misses the event, and the miss is counted in Dropped.
+type Bus struct {
+	mu      sync.RWMutex
+	subs    map[chan Event]struct{}
+	dropped atomic.Uint64
+}
+
+// NewBus creates an empty Bus.
+func NewBus() *Bus {
+	return &Bus{subs: map[chan Event]struct{}{}}
+}
+
+// Publish sends e to every subscriber that has room for it. A zero Time is set to now.
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.subs) == 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events published from now on, buffering up to
+// size of them, and a function that ends the subscription and closes the channel.
+func (b *Bus) Subscribe(size int) (<-chan Event, func()) {
+	if size < 1 {
+		size = 1
+	}
+	ch := make(chan Event, size)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Dropped returns how many deliveries were skipped because a subscriber was full.
+func (b *Bus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Default is the process-wide bus the ai package and the handlers publish to.
+var Default = NewBus()
+
+// Publish sends e on Default.
+func Publish(e Event) {
+	Default.Publish(e)
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusFanOut(t *testing.T) {
+	b := NewBus()
+	a, stopA := b.Subscribe(4)
+	c, stopC := b.Subscribe(4)
+	defer stopC()
+
+	b.Publish(Event{Type: StreamStarted, Provider: "mock"})
+	for _, ch := range []<-chan Event{a, c} {
+		e := <-ch
+		if e.Type != StreamStarted || e.Provider != "mock" || e.Time.IsZero() {
+			t.Fatalf("event = %+v, want stream.started stamped with the time", e)
+		}
+	}
+
+	stopA()
+	stopA() // idempotent
+	if _, ok := <-a; ok {
+		t.Fatal("channel still open after unsubscribing")
+	}
+	b.Publish(Event{Type: StreamEnded})
+	if e := <-c; e.Type != StreamEnded {
+		t.Fatalf("remaining subscriber got %+v", e)
+	}
+}
+
+func TestBusDropsForSlowSubscriber(t *testing.T) {
+	b := NewBus()
+	slow, stop := b.Subscribe(2)
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		for range 5 {
+			b.Publish(Event{Type: ConnOpened})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a subscriber that isn't reading")
+	}
+	if n := b.Dropped(); n != 3 {
+		t.Fatalf("Dropped = %d, want the 3 events past the buffer", n)
+	}
+	if len(slow) != 2 {
+		t.Fatalf("subscriber holds %d events, want its buffer of 2", len(slow))
+	}
+}
@@ -0,0 +1,67 @@
+package logsample
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sampler thins out high-volume log events such as per-chunk logging. An event is
+// logged when it is the Every-th since the last logged one and fewer than PerSecond
+// events have been logged in the current second. Zero disables either limit.
+// Stream start, end and errors should be logged unconditionally, not through a Sampler.
+type Sampler struct {
+	Every     int
+	PerSecond int
+
+	mu      sync.Mutex
+	seen    int
+	window  time.Time
+	logged  int
+	skipped int
+}
+
+// New creates a Sampler logging every nth event and at most perSecond per second.
+func New(every, perSecond int) *Sampler {
+	return &Sampler{Every: every, PerSecond: perSecond}
+}
+
+// FromEnv creates a Sampler from LOG_CHUNK_EVERY (default 1) and LOG_CHUNK_RATE
+// (default 10 per second).
+func FromEnv() *Sampler {
+	return New(envInt("LOG_CHUNK_EVERY", 1), envInt("LOG_CHUNK_RATE", 10))
+}
+
+// Allow reports whether the current event should be logged and, if so, how many
+// events were skipped since the last one that was.
+func (s *Sampler) Allow() (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	if s.Every > 1 && s.seen%s.Every != 0 {
+		s.skipped++
+		return false, 0
+	}
+	if s.PerSecond > 0 {
+		now := time.Now()
+		if now.Sub(s.window) >= time.Second {
+			s.window, s.logged = now, 0
+		}
+		if s.logged >= s.PerSecond {
+			s.skipped++
+			return false, 0
+		}
+		s.logged++
+	}
+	skipped := s.skipped
+	s.skipped = 0
+	return true, skipped
+}
+
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n >= 0 {
+		return n
+	}
+	return def
+}
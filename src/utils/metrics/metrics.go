@@ -0,0 +1,56 @@
+package metrics
+
+import "sync/atomic"
+
+// Tag is a key/value label attached to a metric sample.
+type Tag struct {
+	Key, Value string
+}
+
+// Metrics is the sink the ai package and the HTTP handlers report to. Implementations
+// must be safe for concurrent use and should return quickly; they are called on the
+// streaming path. Adapt it to StatsD, OpenTelemetry or anything else by implementing
+// these three methods.
+type Metrics interface {
+	IncrCounter(name string, tags ...Tag)
+	ObserveHistogram(name string, value float64, tags ...Tag)
+	SetGauge(name string, value float64, tags ...Tag)
+}
+
+// Nop discards every sample. It is the default.
+type Nop struct{}
+
+func (Nop) IncrCounter(string, ...Tag)               {}
+func (Nop) ObserveHistogram(string, float64, ...Tag) {}
+func (Nop) SetGauge(string, float64, ...Tag)         {}
+
+type holder struct{ m Metrics }
+
+var current atomic.Pointer[holder]
+
+func init() {
+	current.Store(&holder{Nop{}})
+}
+
+// Set installs m as the process-wide metrics sink. A nil m restores Nop.
+func Set(m Metrics) {
+	if m == nil {
+		m = Nop{}
+	}
+	current.Store(&holder{m})
+}
+
+// Get returns the current metrics sink.
+func Get() Metrics {
+	return current.Load().m
+}
+
+// Metric names reported by this module.
+const (
+	StreamsTotal      = "ai_streams_total"           // counter, tag provider
+	StreamErrorsTotal = "ai_stream_errors_total"     // counter, tag provider
+	StreamDuration    = "ai_stream_duration_seconds" // histogram, tag provider
+	ActiveStreams     = "ai_active_streams"          // gauge
+	WSConnections     = "ws_active_connections"      // gauge
+	HTTPRequestsTotal = "http_requests_total"        // counter, tags route and code
+)
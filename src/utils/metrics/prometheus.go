@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram bucket upper bounds, in seconds, used by
+// NewPrometheus when none are given.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Prometheus keeps samples in memory and serves them in the Prometheus text
+// exposition format. It implements http.Handler; mount it at /metrics.
+type Prometheus struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series // by name plus rendered labels
+}
+
+type series struct {
+	name, labels string
+	kind         string // counter, gauge or histogram
+	value        float64
+	counts       []uint64 // per bucket, non-cumulative
+	sum          float64
+	count        uint64
+}
+
+// NewPrometheus creates an empty Prometheus sink with the given histogram buckets,
+// or DefaultBuckets.
+func NewPrometheus(buckets ...float64) *Prometheus {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Prometheus{buckets: b, series: map[string]*series{}}
+}
+
+// get returns the series for name and tags, creating it as kind. Callers must hold p.mu.
+func (p *Prometheus) get(kind, name string, tags []Tag) *series {
+	labels := renderLabels(tags)
+	key := name + labels
+	s, ok := p.series[key]
+	if !ok {
+		s = &series{name: name, labels: labels, kind: kind}
+		if kind == "histogram" {
+			s.counts = make([]uint64, len(p.buckets))
+		}
+		p.series[key] = s
+	}
+	return s
+}
+
+func (p *Prometheus) IncrCounter(name string, tags ...Tag) {
+	p.mu.Lock()
+	p.get("counter", name, tags).value++
+	p.mu.Unlock()
+}
+
+func (p *Prometheus) ObserveHistogram(name string, value float64, tags ...Tag) {
+	p.mu.Lock()
+	s := p.get("histogram", name, tags)
+	if i := sort.SearchFloat64s(p.buckets, value); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += value
+	s.count++
+	p.mu.Unlock()
+}
+
+func (p *Prometheus) SetGauge(name string, value float64, tags ...Tag) {
+	p.mu.Lock()
+	p.get("gauge", name, tags).value = value
+	p.mu.Unlock()
+}
+
+// ServeHTTP writes every series in the text exposition format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	all := make([]*series, 0, len(p.series))
+	for _, s := range p.series {
+		c := *s
+		c.counts = append([]uint64(nil), s.counts...)
+		all = append(all, &c)
+	}
+	p.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		return all[i].labels < all[j].labels
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	var b strings.Builder
+	typed := ""
+	for _, s := range all {
+		if s.name != typed {
+			fmt.Fprintf(&b, "# TYPE %s %s\n", s.name, s.kind)
+			typed = s.name
+		}
+		if s.kind != "histogram" {
+			fmt.Fprintf(&b, "%s%s %s\n", s.name, s.labels, formatFloat(s.value))
+			continue
+		}
+		var cum uint64
+		for i, le := range p.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", s.name, withLabel(s.labels, "le", formatFloat(le)), cum)
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", s.name, withLabel(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", s.name, s.labels, formatFloat(s.sum))
+		fmt.Fprintf(&b, "%s_count%s %d\n", s.name, s.labels, s.count)
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// renderLabels formats tags as {k="v",...}, sorted by key, or "" when there are none.
+func renderLabels(tags []Tag) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	sorted := append([]Tag(nil), tags...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	parts := make([]string, len(sorted))
+	for i, t := range sorted {
+		parts[i] = t.Key + "=" + strconv.Quote(t.Value)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// withLabel adds one more label to rendered labels.
+func withLabel(labels, key, value string) string {
+	l := key + "=" + strconv.Quote(value)
+	if labels == "" {
+		return "{" + l + "}"
+	}
+	return labels[:len(labels)-1] + "," + l + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,175 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode controls how SafeString renders user text in logs.
+type Mode int
+
+const (
+	// ModeHash logs only the length and a short hash of the text (the default).
+	ModeHash Mode = iota
+	// ModeTruncate logs a short prefix of the text plus its length and hash.
+	ModeTruncate
+	// ModeFull logs the text verbatim. Intended for local development only.
+	ModeFull
+)
+
+// truncateLen is how many bytes ModeTruncate keeps, less any partial character.
+const truncateLen = 32
+
+// ParseMode maps "hash", "truncate" or "full" to a Mode, defaulting to ModeHash.
+func ParseMode(s string) Mode {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "full":
+		return ModeFull
+	case "truncate":
+		return ModeTruncate
+	default:
+		return ModeHash
+	}
+}
+
+// DefaultDenyPatterns match text that SafeString never logs verbatim, whatever the
+// Mode: US social security numbers and payment card numbers.
+var DefaultDenyPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+}
+
+var (
+	mu      sync.RWMutex
+	mode    = ParseMode(os.Getenv("LOG_PROMPTS"))
+	secrets []string
+	deny    = append(DefaultDenyPatterns, patternFromEnv("LOG_PROMPT_DENY")...)
+	allow   = patternFromEnv("LOG_PROMPT_ALLOW")
+)
+
+// patternFromEnv compiles the regex in the named variable. An invalid one is logged
+// and, for an allowlist, leaves nothing allowed rather than everything.
+func patternFromEnv(name string) []*regexp.Regexp {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	re, err := regexp.Compile(v)
+	if err != nil {
+		log.Printf("redact: invalid %s: %v", name, err)
+		return []*regexp.Regexp{regexp.MustCompile(`$^`)}
+	}
+	return []*regexp.Regexp{re}
+}
+
+// SetDenyPatterns replaces the patterns whose matches SafeString only ever logs as a
+// hash. DefaultDenyPatterns are not kept unless passed again.
+func SetDenyPatterns(patterns ...*regexp.Regexp) {
+	mu.Lock()
+	deny = patterns
+	mu.Unlock()
+}
+
+// SetAllowPatterns switches SafeString to allowlist mode: text is only logged per the
+// Mode when it matches one of patterns, and as a hash otherwise. No patterns turns
+// allowlist mode off. Set with LOG_PROMPT_ALLOW.
+func SetAllowPatterns(patterns ...*regexp.Regexp) {
+	mu.Lock()
+	allow = patterns
+	mu.Unlock()
+}
+
+// SetMode changes how SafeString renders text.
+func SetMode(m Mode) {
+	mu.Lock()
+	mode = m
+	mu.Unlock()
+}
+
+// RegisterSecret records a value (such as an API key) that must never appear in logs.
+// Scrub and SafeString replace any occurrence of it.
+func RegisterSecret(v string) {
+	if len(v) < 4 {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range secrets {
+		if s == v {
+			return
+		}
+	}
+	secrets = append(secrets, v)
+}
+
+// Scrub replaces registered secrets in s with a placeholder. Use it for text that
+// is otherwise safe to log, such as errors that may echo upstream responses.
+func Scrub(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, "[secret]")
+	}
+	return s
+}
+
+// SafeString renders user-supplied text (prompts, responses) for logging according to
+// the configured Mode. Registered secrets are always removed, and text matching a deny
+// pattern (or, in allowlist mode, no allow pattern) is only ever logged as a hash.
+func SafeString(s string) string {
+	mu.RLock()
+	m := mode
+	if m != ModeHash && !permitted(s) {
+		m = ModeHash
+	}
+	mu.RUnlock()
+
+	switch m {
+	case ModeFull:
+		return Scrub(s)
+	case ModeTruncate:
+		// scrubbed before cutting, so a secret straddling the cut leaves no prefix behind
+		scrubbed := Scrub(s)
+		if len(scrubbed) <= truncateLen {
+			return scrubbed
+		}
+		cut := truncateLen
+		for cut > 0 && !utf8.RuneStart(scrubbed[cut]) {
+			cut--
+		}
+		return scrubbed[:cut] + "… " + summary(s)
+	default:
+		return summary(s)
+	}
+}
+
+// permitted reports whether s may be logged beyond a hash. Callers must hold mu.
+func permitted(s string) bool {
+	for _, re := range deny {
+		if re.MatchString(s) {
+			return false
+		}
+	}
+	if len(allow) == 0 {
+		return true
+	}
+	for _, re := range allow {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// summary describes text without revealing it.
+func summary(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "[len=" + strconv.Itoa(len(s)) + " sha256=" + hex.EncodeToString(sum[:4]) + "]"
+}
@@ -0,0 +1,124 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// withMode runs the test under m and restores the previous settings afterwards.
+func withMode(t *testing.T, m Mode) {
+	t.Helper()
+	mu.Lock()
+	prevMode, prevSecrets, prevDeny, prevAllow := mode, secrets, deny, allow
+	mode, deny, allow = m, DefaultDenyPatterns, nil
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		mode, secrets, deny, allow = prevMode, prevSecrets, prevDeny, prevAllow
+		mu.Unlock()
+	})
+}
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"full": ModeFull, " Truncate ": ModeTruncate, "hash": ModeHash, "": ModeHash, "bogus": ModeHash} {
+		if got := ParseMode(in); got != want {
+			t.Errorf("ParseMode(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestSafeStringTruncateKeepsWholeRunes(t *testing.T) {
+	withMode(t, ModeTruncate)
+	// the 32-byte cut falls inside a two-byte "é"
+	s := strings.Repeat("a", truncateLen-1) + "éclair and more text"
+	got := SafeString(s)
+	if !utf8.ValidString(got) {
+		t.Fatalf("SafeString = %q, not valid UTF-8", got)
+	}
+	if want := strings.Repeat("a", truncateLen-1) + "… " + summary(s); got != want {
+		t.Fatalf("SafeString = %q, want %q", got, want)
+	}
+	if got := SafeString("short"); got != "short" {
+		t.Fatalf("short text = %q", got)
+	}
+}
+
+func TestSafeStringNeverLeaksSecrets(t *testing.T) {
+	withMode(t, ModeTruncate)
+	RegisterSecret("sk-live-0123456789")
+	// the secret straddles the truncation point
+	s := strings.Repeat("x", truncateLen-6) + "sk-live-0123456789 trailing"
+	if got := SafeString(s); strings.Contains(got, "sk-live") {
+		t.Fatalf("SafeString leaked part of a secret: %q", got)
+	}
+	SetMode(ModeFull)
+	if got := SafeString("key is sk-live-0123456789"); got != "key is [secret]" {
+		t.Fatalf("full mode = %q", got)
+	}
+	if got := Scrub("error: sk-live-0123456789 rejected"); got != "error: [secret] rejected" {
+		t.Fatalf("Scrub = %q", got)
+	}
+}
+
+func TestSafeStringPatterns(t *testing.T) {
+	withMode(t, ModeFull)
+	ssn := "my ssn is 123-45-6789"
+	if got := SafeString(ssn); got != summary(ssn) {
+		t.Fatalf("denied text = %q, want only its summary", got)
+	}
+	SetAllowPatterns(regexp.MustCompile(`^hello`))
+	if got := SafeString("hello world"); got != "hello world" {
+		t.Fatalf("allowed text = %q", got)
+	}
+	if got := SafeString("goodbye world"); got != summary("goodbye world") {
+		t.Fatalf("text outside the allowlist = %q", got)
+	}
+}
+
+func TestSafeStringCardNumbersHashed(t *testing.T) {
+	for _, m := range []Mode{ModeFull, ModeTruncate} {
+		withMode(t, m)
+		for _, prompt := range []string{
+			"charge my card 4111111111111111 please",
+			"card: 4111 1111 1111 1111, exp 12/29",
+			"amex 3782-822463-10005",
+		} {
+			got := SafeString(prompt)
+			if got != summary(prompt) || strings.Contains(got, "1111") || strings.Contains(got, "3782") {
+				t.Errorf("mode %v: %q logged as %q, want only its hash", m, prompt, got)
+			}
+		}
+		// numbers too short to be a card are ordinary text
+		if got := SafeString("order 12345 shipped"); got != "order 12345 shipped" {
+			t.Errorf("mode %v: %q logged as %q", m, "order 12345 shipped", got)
+		}
+	}
+}
+
+func TestSetDenyPatterns(t *testing.T) {
+	withMode(t, ModeFull)
+	SetDenyPatterns(regexp.MustCompile(`(?i)\bpassport\b`))
+	if got := SafeString("my Passport number"); got != summary("my Passport number") {
+		t.Fatalf("custom deny pattern: %q", got)
+	}
+	// replacing the patterns drops the defaults
+	if got := SafeString("ssn 123-45-6789"); got != "ssn 123-45-6789" {
+		t.Fatalf("default pattern still applied after SetDenyPatterns: %q", got)
+	}
+	// a deny match wins over the allowlist
+	SetAllowPatterns(regexp.MustCompile(`^my`))
+	if got := SafeString("my passport"); got != summary("my passport") {
+		t.Fatalf("allowed but denied text = %q", got)
+	}
+}
+
+func TestInvalidAllowPatternAllowsNothing(t *testing.T) {
+	withMode(t, ModeFull)
+	t.Setenv("LOG_PROMPT_ALLOW", "(unclosed")
+	SetAllowPatterns(patternFromEnv("LOG_PROMPT_ALLOW")...)
+	if got := SafeString("hello"); got != summary("hello") {
+		t.Fatalf("with an invalid allowlist %q was logged as %q, want only its hash", "hello", got)
+	}
+}
@@ -0,0 +1,94 @@
+package tts
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ClipsDir holds pre-recorded audio played instead of synthesizing common phrases. Its
+// clips.json maps each phrase to a 16-bit mono WAV file in the directory, e.g.
+//
+//	{"Let me think about that.": "thinking.wav", "Sorry, something went wrong.": "error.wav"}
+//
+// Phrases match ignoring case, spacing and surrounding punctuation; other text is
+// synthesized as usual. Clips play through Sink, or TTS_PLAYER (default "aplay") when
+// no sink is set, so they work without espeak. Set with TTS_CLIPS_DIR.
+var ClipsDir = os.Getenv("TTS_CLIPS_DIR")
+
+// clip is one decoded pre-recorded phrase.
+type clip struct {
+	file string
+	pcm  []byte
+	rate int
+}
+
+var (
+	clipsOnce sync.Once
+	clips     map[string]clip
+)
+
+// loadClips reads ClipsDir once. Entries whose file is missing or not a supported WAV
+// are logged and skipped.
+func loadClips() {
+	clipsOnce.Do(func() {
+		if ClipsDir == "" {
+			return
+		}
+		manifest := filepath.Join(ClipsDir, "clips.json")
+		data, err := os.ReadFile(manifest)
+		if err != nil {
+			log.Printf("tts: clips disabled: %v", err)
+			return
+		}
+		var phrases map[string]string
+		if err := json.Unmarshal(data, &phrases); err != nil {
+			log.Printf("tts: clips disabled: %s: %v", manifest, err)
+			return
+		}
+		clips = make(map[string]clip, len(phrases))
+		for phrase, file := range phrases {
+			// rooted first so the file stays inside ClipsDir
+			wav, err := os.ReadFile(filepath.Join(ClipsDir, filepath.Clean("/"+file)))
+			if err == nil {
+				var c clip
+				if c.pcm, c.rate, err = parseWAV(wav); err == nil {
+					c.file = file
+					clips[normalizePhrase(phrase)] = c
+					continue
+				}
+			}
+			log.Printf("tts: skipping clip %q: %v", file, err)
+		}
+		log.Printf("tts: %d pre-recorded clips loaded from %s", len(clips), ClipsDir)
+	})
+}
+
+// clipFor returns the pre-recorded clip for text, if there is one.
+func clipFor(text string) (clip, bool) {
+	loadClips()
+	c, ok := clips[normalizePhrase(text)]
+	return c, ok
+}
+
+// normalizePhrase lowercases text, collapses its whitespace and trims punctuation
+// from both ends.
+func normalizePhrase(text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	return strings.TrimFunc(text, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSpace(r) })
+}
+
+// playClip plays a clip through Sink or the TTS_PLAYER command.
+func playClip(ctx context.Context, c clip) error {
+	sink := Sink
+	if sink == nil {
+		player := envString("TTS_PLAYER", "aplay")
+		sink = &PlayerSink{Command: strings.Fields(player)}
+	}
+	return sink.Play(ctx, c.pcm, c.rate)
+}
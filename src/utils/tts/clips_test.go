@@ -0,0 +1,93 @@
+package tts
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// loadClipsFrom loads the clips in dir for the duration of the test, playing them (and
+// synthesized speech) through a recordingSink.
+func loadClipsFrom(t *testing.T, dir string) *recordingSink {
+	t.Helper()
+	prevDir, prevClips, prevSink := ClipsDir, clips, Sink
+	ClipsDir, clipsOnce, clips = dir, sync.Once{}, nil
+	loadClips()
+	sink := &recordingSink{}
+	Sink = sink
+	t.Cleanup(func() { ClipsDir, clips, Sink = prevDir, prevClips, prevSink })
+	return sink
+}
+
+// writeFiles creates each name under dir with its content.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadClipsManifest(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "clips")
+	os.Mkdir(dir, 0o755)
+	writeFiles(t, root, map[string]string{"secret.wav": string(encodeWAV([]byte("secret"), 8000))})
+	writeFiles(t, dir, map[string]string{
+		"clips.json": `{"Let me think about that.": "thinking.wav", "Missing": "nope.wav",
+			"Escape": "../secret.wav", "Broken": "bad.wav"}`,
+		"thinking.wav": string(encodeWAV([]byte("think"), 22050)),
+		"bad.wav":      "not a wav file",
+	})
+	loadClipsFrom(t, dir)
+
+	if len(clips) != 1 {
+		t.Fatalf("loaded %d clips, want only the valid one: %+v", len(clips), clips)
+	}
+	c, ok := clipFor("  let me THINK about   that ")
+	if !ok || string(c.pcm) != "think" || c.rate != 22050 || c.file != "thinking.wav" {
+		t.Fatalf("clipFor = %+v, %v", c, ok)
+	}
+	// "../secret.wav" resolves inside the clips directory, where there is no such file
+	if _, ok := clipFor("Escape"); ok {
+		t.Fatal("a clip outside ClipsDir was loaded")
+	}
+}
+
+func TestClipPlaysOrFallsThroughToSynthesis(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run a fake espeak")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"clips.json":   `{"Let me think about that.": "thinking.wav"}`,
+		"thinking.wav": string(encodeWAV([]byte("recorded"), 16000)),
+	})
+	// a fake espeak whose --stdout WAV holds the text it was given as audio
+	script := filepath.Join(dir, "espeak")
+	writeFiles(t, dir, map[string]string{"espeak": "#!/bin/sh\nfor last; do :; done\n" +
+		`printf 'RIFF\0\0\0\0WAVEfmt \020\0\0\0\001\0\001\0\200\076\0\0\0\175\0\0\002\0\020\0data\0\0\0\0'` + "\n" +
+		`printf '%s' "$last"` + "\n"})
+	os.Chmod(script, 0o755)
+	probeOnce.Do(func() {})
+	prevBinary, prevAvailable := Binary, available
+	Binary, available = script, true
+	t.Cleanup(func() { Binary, available = prevBinary, prevAvailable })
+	sink := loadClipsFrom(t, dir)
+
+	speak(context.Background(), "test", "Let me think about that.")
+	speak(context.Background(), "test", "Something else entirely.")
+	if got, _ := sink.result(); !slices.Equal(got, []string{"recorded", "Something else entirely."}) {
+		t.Fatalf("played %q, want the clip and then synthesized speech", got)
+	}
+
+	wav, err := Synthesize(context.Background(), "let me think about that")
+	if pcm, _, _ := parseWAV(wav); err != nil || string(pcm) != "recorded" {
+		t.Fatalf("Synthesize of a clip phrase = %q, %v; want the clip's audio", pcm, err)
+	}
+}
@@ -0,0 +1,142 @@
+package tts
+
+import (
+	"log"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// DetectLanguage picks each utterance's voice from the language it is written in, for
+// responses that switch languages. Sentences whose language isn't recognised keep the
+// requested voice (see WithVoice and Voice). It is off by default since it costs a scan
+// of every sentence; set TTS_DETECT_LANGUAGE=true to enable it.
+var DetectLanguage = os.Getenv("TTS_DETECT_LANGUAGE") == "true"
+
+// LanguageVoices maps a detected language code to the voice speaking it. Languages not
+// listed use the code itself, which is how espeak names its voices. Set with
+// TTS_LANGUAGE_VOICES, e.g. "en=en-us,pt=pt-br".
+var LanguageVoices = languageVoicesFromEnv()
+
+func languageVoicesFromEnv() map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("TTS_LANGUAGE_VOICES"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		lang, voice, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(lang) == "" || strings.TrimSpace(voice) == "" {
+			log.Printf("tts: ignoring TTS_LANGUAGE_VOICES entry %q, want lang=voice", pair)
+			continue
+		}
+		m[strings.TrimSpace(lang)] = strings.TrimSpace(voice)
+	}
+	return m
+}
+
+// languageVoice returns the voice for a detected language.
+func languageVoice(lang string) string {
+	if v, ok := LanguageVoices[lang]; ok {
+		return v
+	}
+	return lang
+}
+
+// scriptLanguages are languages recognised by their writing system alone.
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+}
+
+// stopwords are frequent short words of Latin-script languages. A word may count for
+// several languages; the one with the most matches wins.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "in", "that", "it", "with", "you", "this", "for", "was", "what", "have", "be", "not"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "ein", "eine", "mit", "zu", "auf", "sie", "es", "wir", "sind", "auch", "den", "dem", "für"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "pas", "je", "vous", "nous", "que", "pour", "dans", "avec", "ce", "qui", "sur", "du"},
+	"es": {"el", "la", "los", "las", "y", "es", "un", "una", "que", "de", "no", "por", "para", "con", "está", "muy", "yo", "del", "se", "lo"},
+	"it": {"il", "la", "e", "è", "di", "che", "un", "una", "non", "per", "con", "sono", "gli", "le", "del", "questo", "della", "io"},
+	"pt": {"o", "a", "os", "as", "e", "é", "um", "uma", "que", "não", "de", "para", "com", "em", "do", "da", "você", "eu", "isso"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "ik", "je", "dat", "met", "zijn", "op", "voor", "ook", "wat", "er", "maar"},
+}
+
+// letterHints are letters found in only one of the stopword languages.
+var letterHints = map[rune]string{
+	'ß': "de", 'ä': "de", 'ö': "de", 'ü': "de",
+	'ñ': "es", '¿': "es", '¡': "es",
+	'ã': "pt", 'õ': "pt",
+	'œ': "fr", 'ù': "fr",
+}
+
+var stopwordLangs = func() map[string][]string {
+	m := map[string][]string{}
+	for lang, words := range stopwords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// detectLanguage guesses the language of a sentence, returning an ISO 639-1 code or ""
+// when there is too little to go on. Non-Latin scripts are recognised by their letters
+// and Latin-script languages by their stopwords; it is meant for choosing a voice, not
+// for telling closely related languages apart reliably.
+func detectLanguage(text string) string {
+	scores := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.table, r) {
+				scores[s.lang]++
+				break
+			}
+		}
+	}
+	// a mostly non-Latin sentence is decided by its script
+	for _, s := range scriptLanguages {
+		if scores[s.lang]*2 > letters {
+			return s.lang
+		}
+	}
+
+	clear(scores)
+	for _, r := range strings.ToLower(text) {
+		if lang, ok := letterHints[r]; ok {
+			scores[lang]++
+		}
+	}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for _, lang := range stopwordLangs[w] {
+			scores[lang]++
+		}
+	}
+	best, bestScore, tied := "", 0, false
+	for lang, n := range scores {
+		switch {
+		case n > bestScore:
+			best, bestScore, tied = lang, n, false
+		case n == bestScore:
+			tied = true
+		}
+	}
+	// one matching word says little, and a tie says nothing
+	if bestScore < 2 || tied {
+		return ""
+	}
+	return best
+}
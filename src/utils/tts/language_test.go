@@ -0,0 +1,69 @@
+package tts
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"This is the answer you wanted.":     "en",
+		"Das ist nicht das, was ich meine.":  "de",
+		"Je ne sais pas, mais nous verrons.": "fr",
+		"¿Dónde está la estación?":           "es",
+		"これは日本語の文です。":                        "ja",
+		"Привет, как дела?":                  "ru",
+		"Okay.":                              "",
+		"42!":                                "",
+	}
+	for text, want := range tests {
+		if got := detectLanguage(text); got != want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+const languageListing = `Pty Language       Age/Gender VoiceName          File                 Other Languages
+ 5  de              --/M      German             gmw/de
+ 5  en              --/M      English            gmw/en
+ 2  en-gb           --/M      English_(Great_Britain) gmw/en            (en 2)
+ 5  fr              --/M      French             roa/fr
+ 5  ja              --/M      Japanese           jpx/ja
+`
+
+func TestStreamPicksVoicePerSentence(t *testing.T) {
+	spoken, _ := fakeEspeak(t)
+	mockVoices(t, languageListing, nil)
+	prevDetect, prevVoice, prevVoices := DetectLanguage, Voice, LanguageVoices
+	DetectLanguage, Voice, LanguageVoices = true, "en", map[string]string{"en": "en-gb"}
+	t.Cleanup(func() { DetectLanguage, Voice, LanguageVoices = prevDetect, prevVoice, prevVoices })
+
+	speakAll := func(text string) []string {
+		t.Helper()
+		s := NewStream("test")
+		s.Write(text)
+		s.Close()
+		s.Wait()
+		return spoken()
+	}
+	got := speakAll("This is the answer you wanted. Das ist nicht das, was ich meine. " +
+		"Je ne sais pas, mais nous verrons. Привет, как дела? Okay. これは日本語の文です。")
+	want := []string{
+		"-v en-gb This is the answer you wanted.",
+		"-v de Das ist nicht das, was ich meine.",
+		"-v fr Je ne sais pas, mais nous verrons.",
+		// Russian is not installed, so it falls back, and "Okay." keeps the requested voice
+		"-v en Привет, как дела?",
+		"-v en Okay.",
+		"-v ja これは日本語の文です。",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("espeak calls %q, want %q", got, want)
+	}
+
+	// with detection off every sentence uses the requested voice
+	DetectLanguage = false
+	if got := speakAll("Das ist nicht das, was ich meine. "); got[len(got)-1] != "-v en Das ist nicht das, was ich meine." {
+		t.Fatalf("espeak called with %q with detection off, want the requested voice", got[len(got)-1])
+	}
+}
@@ -0,0 +1,135 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// AudioSink plays synthesized speech. pcm is signed 16-bit little-endian mono audio.
+// Implementations may play it in-process, through a system player or send it elsewhere.
+type AudioSink interface {
+	Play(ctx context.Context, pcm []byte, sampleRate int) error
+}
+
+// Sink receives synthesized audio. When nil (the default) the TTS binary plays the text
+// itself, as before sinks existed. Otherwise the binary is run with --stdout to
+// synthesize a WAV and its audio is handed to Sink. TTS_SINK=player selects a
+// PlayerSink running TTS_PLAYER (default "aplay").
+var Sink AudioSink = sinkFromEnv()
+
+func sinkFromEnv() AudioSink {
+	if strings.ToLower(os.Getenv("TTS_SINK")) != "player" {
+		return nil
+	}
+	player := os.Getenv("TTS_PLAYER")
+	if player == "" {
+		player = "aplay"
+	}
+	return &PlayerSink{Command: strings.Fields(player)}
+}
+
+// PlayerSink plays audio by piping it as a WAV file to a command's stdin,
+// e.g. []string{"aplay", "-q"} or []string{"paplay"}.
+type PlayerSink struct {
+	Command []string
+}
+
+func (p *PlayerSink) Play(ctx context.Context, pcm []byte, sampleRate int) error {
+	if len(p.Command) == 0 {
+		return errors.New("tts: player sink has no command")
+	}
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(encodeWAV(pcm, sampleRate))
+	return cmd.Run()
+}
+
+// ErrUnavailable is returned by Synthesize when the TTS binary wasn't found.
+var ErrUnavailable = errors.New("tts: binary not available")
+
+// Synthesize renders text as a 16-bit mono WAV file with the TTS binary, without
+// playing it, or returns its pre-recorded clip (see ClipsDir). Cancelling ctx kills the
+// synthesis.
+func Synthesize(ctx context.Context, text string) ([]byte, error) {
+	if c, ok := clipFor(text); ok {
+		return encodeWAV(c.pcm, c.rate), nil
+	}
+	if !Probe() {
+		return nil, ErrUnavailable
+	}
+	pcm, rate, err := synthesize(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return encodeWAV(pcm, rate), nil
+}
+
+// synthesize runs the TTS binary with --stdout and returns the PCM audio it produced.
+func synthesize(ctx context.Context, text string) ([]byte, int, error) {
+	out, err := exec.CommandContext(ctx, Binary, voiceArgs(ctx, text, "--stdout")...).Output()
+	if err != nil {
+		return nil, 0, err
+	}
+	return parseWAV(out)
+}
+
+// parseWAV extracts the samples and sample rate of a 16-bit mono PCM WAV file.
+// Streamed WAVs (espeak's) may carry placeholder sizes, so the data chunk is taken to
+// run to the end of the input.
+func parseWAV(data []byte) ([]byte, int, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, errors.New("tts: not a WAV file")
+	}
+	rate := 0
+	for off := 12; off+8 <= len(data); {
+		id, size := string(data[off:off+4]), int(binary.LittleEndian.Uint32(data[off+4:off+8]))
+		body := data[off+8:]
+		switch id {
+		case "fmt ":
+			if size < 16 || len(body) < 16 {
+				return nil, 0, errors.New("tts: short fmt chunk")
+			}
+			format, channels := binary.LittleEndian.Uint16(body[0:2]), binary.LittleEndian.Uint16(body[2:4])
+			bits := binary.LittleEndian.Uint16(body[14:16])
+			if format != 1 || channels != 1 || bits != 16 {
+				return nil, 0, fmt.Errorf("tts: unsupported WAV (format %d, %d channels, %d bits)", format, channels, bits)
+			}
+			rate = int(binary.LittleEndian.Uint32(body[4:8]))
+		case "data":
+			if rate == 0 {
+				return nil, 0, errors.New("tts: WAV data before fmt chunk")
+			}
+			if size > 0 && size <= len(body) {
+				body = body[:size]
+			}
+			return body, rate, nil
+		}
+		off += 8 + size + size%2
+	}
+	return nil, 0, errors.New("tts: WAV has no data chunk")
+}
+
+// encodeWAV wraps 16-bit mono PCM in a WAV header.
+func encodeWAV(pcm []byte, sampleRate int) []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	b.WriteString("RIFF")
+	binary.Write(&b, le, uint32(36+len(pcm)))
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, le, uint32(16))
+	binary.Write(&b, le, uint16(1)) // PCM
+	binary.Write(&b, le, uint16(1)) // mono
+	binary.Write(&b, le, uint32(sampleRate))
+	binary.Write(&b, le, uint32(sampleRate*2)) // byte rate
+	binary.Write(&b, le, uint16(2))            // block align
+	binary.Write(&b, le, uint16(16))           // bits per sample
+	b.WriteString("data")
+	binary.Write(&b, le, uint32(len(pcm)))
+	b.Write(pcm)
+	return b.Bytes()
+}
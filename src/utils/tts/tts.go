@@ -1,24 +1,317 @@
 package tts
 
 import (
+	"context"
+	"j-project/src/utils/redact"
 	"log"
+	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// Binary is the TTS executable used for playback. It can be overridden with TTS_BINARY.
+var Binary = "espeak"
+
+var (
+	probeOnce sync.Once
+	available bool
+)
+
+// Probe looks up the TTS binary once and reports whether it was found. If it is missing a
+// single warning is logged and the package switches to log-only mode instead of
+// spawning a failing process for every utterance. Probe is safe to call repeatedly.
+func Probe() bool {
+	probeOnce.Do(func() {
+		if b := os.Getenv("TTS_BINARY"); b != "" {
+			Binary = b
+		}
+		path, err := exec.LookPath(Binary)
+		if err != nil {
+			log.Printf("tts: %q not found, TTS disabled (text will be logged instead): %v", Binary, err)
+			return
+		}
+		available = true
+		log.Printf("tts: using %s", path)
+		loadVoices()
+	})
+	return available
+}
+
+// Available reports whether the TTS binary was found.
+func Available() bool {
+	return Probe()
+}
+
+// MaxBacklog caps how many sentences a Stream may have waiting to be spoken. When a new
+// sentence would exceed it the oldest waiting ones are dropped, so speech skips ahead and
+// stays close to the latest text. Zero (the default) never drops. Set with TTS_MAX_BACKLOG.
+var MaxBacklog = envInt("TTS_MAX_BACKLOG", 0)
+
+// dropped counts utterances discarded because of MaxBacklog.
+var dropped atomic.Uint64
+
+// Dropped returns the number of utterances dropped so far because of MaxBacklog.
+func Dropped() uint64 {
+	return dropped.Load()
+}
+
+func envInt(name string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// audioMu is held while audio is playing so that utterances never overlap. A Stream holds
+// it for its whole lifetime, so two streams are spoken one after the other, not interleaved.
+var audioMu sync.Mutex
+
 // Speak starts a non-blocking TTS play of the provided text.
 // It returns immediately and does the actual playback in a goroutine so callers don't wait.
 // The implementation attempts to use `espeak` by default; if that's not available it will
 // simply log the text. This keeps the function safe and non-blocking on servers without
 // a TTS binary installed.
+//
+// Speak gives no ordering guarantee between calls; use a Stream to speak a response.
 func Speak(provider string, text string) {
 	go func() {
-		// Allow specifying provider in future; for now attempt espeak for local playback.
-		// If espeak fails or is not available we just log the text.
-		cmd := exec.Command("espeak", text)
-		if err := cmd.Run(); err != nil {
-			log.Printf("tts: espeak failed or not available, falling back to log output: %v (text=%q)", err, text)
+		audioMu.Lock()
+		defer audioMu.Unlock()
+		speak(context.Background(), provider, text)
+	}()
+}
+
+// speak plays text synchronously, killing the TTS process if ctx ends. Callers must
+// hold audioMu.
+func speak(ctx context.Context, provider string, text string) {
+	if c, ok := clipFor(text); ok {
+		err := playClip(ctx, c)
+		switch {
+		case ctx.Err() != nil:
+			log.Printf("tts: playback cancelled (provider=%s)", provider)
+			return
+		case err == nil:
+			log.Printf("tts: played clip %s (provider=%s)", c.file, provider)
+			return
+		}
+		log.Printf("tts: playing clip %s failed, synthesizing instead: %v", c.file, err)
+	}
+	// Allow specifying provider in future; for now attempt espeak for local playback.
+	// If espeak fails or is not available we just log the text.
+	if !Probe() {
+		log.Printf("tts (log-only): %s", redact.SafeString(text))
+		return
+	}
+	if Sink != nil {
+		pcm, rate, err := synthesize(ctx, text)
+		if err == nil {
+			err = Sink.Play(ctx, pcm, rate)
+		}
+		if ctx.Err() != nil {
+			log.Printf("tts: playback cancelled (provider=%s)", provider)
+			return
+		}
+		if err != nil {
+			log.Printf("tts: playback through sink failed: %v (text=%s)", err, redact.SafeString(text))
 			return
 		}
-		log.Printf("tts: spoke text (provider=%s)", provider)
+		log.Printf("tts: spoke text through sink (provider=%s)", provider)
+		return
+	}
+	cmd := exec.CommandContext(ctx, Binary, voiceArgs(ctx, text)...)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			log.Printf("tts: playback cancelled (provider=%s)", provider)
+			return
+		}
+		log.Printf("tts: %s failed, falling back to log output: %v (text=%s)", Binary, err, redact.SafeString(text))
+		return
+	}
+	log.Printf("tts: spoke text (provider=%s)", provider)
+}
+
+// Stream speaks the chunks of one AI response in the order they were written.
+// Chunks are buffered into sentences and played by a single goroutine per stream,
+// which holds the global audio lock so concurrent streams don't overlap.
+// This is the recommended way to wire TTS into a streamed response.
+//
+// A Stream created with NewStreamContext lives no longer than its context: when the
+// context ends the sentence being spoken is cut off and the rest of the queue is
+// discarded, leaving other streams alone.
+type Stream struct {
+	provider string
+	ctx      context.Context
+
+	mu        sync.Mutex
+	sentences Sentences // text not yet terminated by a sentence boundary
+	queue     []string
+	closed    bool
+	wake      chan struct{}
+	done      chan struct{}
+}
+
+// NewStream starts an ordered TTS stream. Call Close when the response ends.
+func NewStream(provider string) *Stream {
+	return NewStreamContext(context.Background(), provider)
+}
+
+// NewStreamContext starts an ordered TTS stream whose playback stops when ctx ends.
+func NewStreamContext(ctx context.Context, provider string) *Stream {
+	s := &Stream{
+		provider: provider,
+		ctx:      ctx,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write adds a chunk of text. It never blocks on playback.
+func (s *Stream) Write(chunk string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	sentences := s.sentences.Write(chunk)
+	if len(sentences) == 0 {
+		return
+	}
+	s.queue = append(s.queue, sentences...)
+	s.trimBacklog()
+	s.signal()
+}
+
+// trimBacklog drops the oldest waiting sentences beyond MaxBacklog. Callers must hold s.mu.
+func (s *Stream) trimBacklog() {
+	if MaxBacklog <= 0 || len(s.queue) <= MaxBacklog {
+		return
+	}
+	n := len(s.queue) - MaxBacklog
+	dropped.Add(uint64(n))
+	s.queue = append(s.queue[:0], s.queue[n:]...)
+}
+
+// Close flushes any buffered text and lets the stream finish playing in the background.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if rest := s.sentences.Flush(); rest != "" {
+		s.queue = append(s.queue, rest)
+		s.trimBacklog()
+	}
+	s.closed = true
+	s.signal()
+}
+
+// Wait blocks until everything written before Close has been spoken.
+func (s *Stream) Wait() {
+	<-s.done
+}
+
+func (s *Stream) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Stream) run() {
+	defer close(s.done)
+	locked := false
+	defer func() {
+		if locked {
+			audioMu.Unlock()
+		}
 	}()
+
+	for {
+		s.mu.Lock()
+		if s.ctx.Err() != nil {
+			// cancelled: drop whatever is left and ignore later writes
+			s.queue, s.closed = nil, true
+			s.mu.Unlock()
+			return
+		}
+		if len(s.queue) == 0 {
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return
+			}
+			select {
+			case <-s.wake:
+			case <-s.ctx.Done():
+			}
+			continue
+		}
+		text := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		if !locked {
+			audioMu.Lock()
+			locked = true
+		}
+		if s.ctx.Err() == nil {
+			speak(s.ctx, s.provider, text)
+		}
+	}
+}
+
+// Sentences buffers streamed text and hands it back one complete sentence at a time,
+// the same way a Stream splits what it speaks. The zero value is ready to use.
+type Sentences struct {
+	buf strings.Builder
+}
+
+// Write adds a chunk and returns the sentences it completed.
+func (s *Sentences) Write(chunk string) []string {
+	s.buf.WriteString(chunk)
+	sentences, rest := splitSentences(s.buf.String())
+	if len(sentences) > 0 {
+		s.buf.Reset()
+		s.buf.WriteString(rest)
+	}
+	return sentences
+}
+
+// Flush returns the buffered unterminated text, trimmed, and empties the buffer.
+func (s *Sentences) Flush() string {
+	rest := strings.TrimSpace(s.buf.String())
+	s.buf.Reset()
+	return rest
+}
+
+// splitSentences returns the complete sentences in text and the unterminated remainder.
+// A sentence ends at '.', '!', '?' or a newline followed by whitespace.
+func splitSentences(text string) (sentences []string, rest string) {
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '.', '!', '?', '\n':
+		default:
+			continue
+		}
+		if i+1 < len(text) && text[i+1] != ' ' && text[i+1] != '\n' && text[i+1] != '\t' {
+			continue
+		}
+		if i+1 == len(text) && text[i] != '\n' {
+			// the next chunk may continue this token (e.g. "3." followed by "14")
+			continue
+		}
+		if s := strings.TrimSpace(text[start : i+1]); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = i + 1
+	}
+	return sentences, text[start:]
 }
@@ -0,0 +1,213 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// recordingSink records what it plays, in order, and notices overlapping playback.
+type recordingSink struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	played  []string
+	playing int
+	overlap bool
+}
+
+func (r *recordingSink) Play(ctx context.Context, pcm []byte, sampleRate int) error {
+	r.mu.Lock()
+	r.playing++
+	if r.playing > 1 {
+		r.overlap = true
+	}
+	r.played = append(r.played, string(pcm))
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	r.playing--
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingSink) result() ([]string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.played), r.overlap
+}
+
+// withClips makes each phrase a pre-recorded clip whose audio is the phrase itself and
+// plays clips through a recordingSink, so speech can be observed without espeak.
+func withClips(t *testing.T, delay time.Duration, phrases ...string) *recordingSink {
+	t.Helper()
+	loadClips()
+	prevClips, prevSink := clips, Sink
+	clips = map[string]clip{}
+	for _, p := range phrases {
+		clips[normalizePhrase(p)] = clip{file: p, pcm: []byte(p), rate: 16000}
+	}
+	sink := &recordingSink{delay: delay}
+	Sink = sink
+	t.Cleanup(func() { clips, Sink = prevClips, prevSink })
+	return sink
+}
+
+func TestStreamSpeaksInWriteOrder(t *testing.T) {
+	var want []string
+	for i := range 20 {
+		want = append(want, fmt.Sprintf("Sentence %d.", i))
+	}
+	sink := withClips(t, 0, want...)
+
+	// emit the text as fast as possible in chunks that don't line up with sentences
+	s := NewStream("test")
+	text := strings.Join(want, " ")
+	for i := 0; i < len(text); i += 3 {
+		s.Write(text[i:min(i+3, len(text))])
+	}
+	s.Close()
+	s.Wait()
+
+	if got, _ := sink.result(); !slices.Equal(got, want) {
+		t.Fatalf("spoken %q, want %q", got, want)
+	}
+}
+
+func TestConcurrentStreamsDoNotInterleave(t *testing.T) {
+	a := []string{"A one.", "A two.", "A three."}
+	b := []string{"B one.", "B two.", "B three."}
+	sink := withClips(t, 5*time.Millisecond, append(slices.Clone(a), b...)...)
+
+	sa, sb := NewStream("a"), NewStream("b")
+	for i := range a {
+		sa.Write(a[i] + " ")
+		sb.Write(b[i] + " ")
+	}
+	sa.Close()
+	sb.Close()
+	sa.Wait()
+	sb.Wait()
+
+	got, overlap := sink.result()
+	if overlap {
+		t.Fatal("two streams played audio at the same time")
+	}
+	if !slices.Equal(got, append(slices.Clone(a), b...)) && !slices.Equal(got, append(slices.Clone(b), a...)) {
+		t.Fatalf("spoken %q, want one stream's sentences after the other's", got)
+	}
+}
+
+func TestStreamContextCancelDropsQueue(t *testing.T) {
+	sink := withClips(t, 50*time.Millisecond, "First.", "Second.", "Third.")
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewStreamContext(ctx, "test")
+	s.Write("First. Second. Third. ")
+	for got, _ := sink.result(); len(got) == 0; got, _ = sink.result() {
+		time.Sleep(time.Millisecond) // wait for "First." to start playing
+	}
+	cancel()
+	s.Close()
+	s.Wait()
+
+	if got, _ := sink.result(); !slices.Equal(got, []string{"First."}) {
+		t.Fatalf("spoken %q after cancel, want only the sentence already playing", got)
+	}
+}
+
+func TestSentences(t *testing.T) {
+	var s Sentences
+	var got []string
+	for _, c := range []string{"Pi is 3", ".14 and", " e is 2.71. Done", "! Trailing"} {
+		got = append(got, s.Write(c)...)
+	}
+	want := []string{"Pi is 3.14 and e is 2.71.", "Done!"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("sentences = %q, want %q", got, want)
+	}
+	if rest := s.Flush(); rest != "Trailing" {
+		t.Fatalf("Flush = %q, want the unterminated text", rest)
+	}
+}
+
+// fakeEspeak installs a shell script as the TTS binary. It logs the arguments of each
+// call, one line per call, and for texts containing "Long" records its pid and sleeps.
+func fakeEspeak(t *testing.T) (spoken func() []string, pid func() int) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run a fake espeak")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "espeak")
+	logFile, pidFile := filepath.Join(dir, "spoken"), filepath.Join(dir, "pid")
+	body := "#!/bin/sh\nfor last; do :; done\necho \"$*\" >> " + logFile + "\n" +
+		"case \"$last\" in *Long*) echo $$ > " + pidFile + "; exec sleep 30;; esac\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	probeOnce.Do(func() {})
+	prevBinary, prevAvailable, prevClips, prevSink := Binary, available, clips, Sink
+	Binary, available, clips, Sink = script, true, map[string]clip{}, nil
+	t.Cleanup(func() { Binary, available, clips, Sink = prevBinary, prevAvailable, prevClips, prevSink })
+
+	spoken = func() []string {
+		b, _ := os.ReadFile(logFile)
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+	pid = func() int {
+		b, _ := os.ReadFile(pidFile)
+		n, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+		return n
+	}
+	return spoken, pid
+}
+
+func TestStreamCancelKillsEspeak(t *testing.T) {
+	spoken, pid := fakeEspeak(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	a := NewStreamContext(ctx, "test")
+	a.Write("A Long sentence. Stale text. ")
+	a.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for pid() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("espeak never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// another stream waits for the audio and is spoken once the first is cancelled
+	b := NewStream("test")
+	b.Write("Other stream. ")
+	b.Close()
+
+	cancel()
+	a.Wait()
+	proc, err := os.FindProcess(pid())
+	if err == nil && proc.Signal(syscall.Signal(0)) == nil {
+		t.Fatalf("espeak (pid %d) still running after its stream was cancelled", pid())
+	}
+
+	done := make(chan struct{})
+	go func() { b.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the other stream never played after the cancel")
+	}
+	if got, want := spoken(), []string{"A Long sentence.", "Other stream."}; !slices.Equal(got, want) {
+		t.Fatalf("spoken %q, want %q without the cancelled stream's queue", got, want)
+	}
+}
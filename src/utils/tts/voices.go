@@ -0,0 +1,151 @@
+package tts
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Voice is the voice requested when a context doesn't name one (see WithVoice). Empty
+// leaves the choice to the TTS binary. Set with TTS_VOICE.
+var Voice = os.Getenv("TTS_VOICE")
+
+// FallbackVoice is used instead of a requested voice that isn't installed. Empty falls
+// back to the binary's default voice. Set with TTS_FALLBACK_VOICE.
+var FallbackVoice = envString("TTS_FALLBACK_VOICE", "en")
+
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// listVoices runs the binary's voice listing; it is a variable so the listing can be
+// replaced where espeak isn't installed.
+var listVoices = func() ([]byte, error) {
+	return exec.Command(Binary, "--voices").Output()
+}
+
+var (
+	voicesOnce sync.Once
+	voices     []string
+	voiceSet   map[string]bool
+	warnedMu   sync.Mutex
+	warned     = map[string]bool{}
+)
+
+// loadVoices reads the installed voices once. A listing that fails or is empty leaves
+// the set nil, and every voice is then passed through as requested.
+func loadVoices() {
+	voicesOnce.Do(func() {
+		out, err := listVoices()
+		if err != nil {
+			log.Printf("tts: listing voices failed, requested voices are used as is: %v", err)
+			return
+		}
+		voices = parseVoices(string(out))
+		if len(voices) == 0 {
+			return
+		}
+		voiceSet = make(map[string]bool, len(voices))
+		for _, v := range voices {
+			voiceSet[strings.ToLower(v)] = true
+		}
+		log.Printf("tts: %d voices available", len(voices))
+	})
+}
+
+// AvailableVoices returns the names the TTS binary accepts as a voice: the language
+// codes, voice names and voice files of `espeak --voices`. It is nil when the binary
+// is missing or its voices couldn't be listed.
+func AvailableVoices() []string {
+	if !Probe() {
+		return nil
+	}
+	loadVoices()
+	return append([]string(nil), voices...)
+}
+
+// parseVoices reads the table printed by `espeak --voices`:
+//
+//	Pty Language       Age/Gender VoiceName          File                 Other Languages
+//	 5  af              --/M      Afrikaans          gmw/af
+func parseVoices(out string) []string {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] == "Pty" {
+			continue
+		}
+		add(fields[1])
+		add(fields[3])
+		add(fields[4])
+	}
+	return names
+}
+
+// resolveVoice returns the voice to pass to the binary for a requested one: the
+// request itself if it is installed (or the voices are unknown), otherwise
+// FallbackVoice, with a warning logged once per missing voice.
+func resolveVoice(requested string) string {
+	if requested == "" {
+		return ""
+	}
+	loadVoices()
+	if voiceSet == nil || voiceSet[strings.ToLower(requested)] {
+		return requested
+	}
+	fallback := FallbackVoice
+	if !voiceSet[strings.ToLower(fallback)] {
+		fallback = ""
+	}
+	warnedMu.Lock()
+	first := !warned[requested]
+	warned[requested] = true
+	warnedMu.Unlock()
+	if first {
+		if fallback == "" {
+			log.Printf("tts: voice %q is not installed, using the default voice", requested)
+		} else {
+			log.Printf("tts: voice %q is not installed, using %q", requested, fallback)
+		}
+	}
+	return fallback
+}
+
+type voiceKey struct{}
+
+// WithVoice returns a context whose speech and synthesis use the named voice.
+func WithVoice(ctx context.Context, voice string) context.Context {
+	return context.WithValue(ctx, voiceKey{}, voice)
+}
+
+// voiceArgs returns the binary's arguments for speaking text with ctx's voice, or the
+// voice of text's language when DetectLanguage is on.
+func voiceArgs(ctx context.Context, text string, extra ...string) []string {
+	voice, ok := ctx.Value(voiceKey{}).(string)
+	if !ok || voice == "" {
+		voice = Voice
+	}
+	if DetectLanguage {
+		if lang := detectLanguage(text); lang != "" {
+			voice = languageVoice(lang)
+		}
+	}
+	args := extra
+	if v := resolveVoice(voice); v != "" {
+		args = append(args, "-v", v)
+	}
+	return append(args, text)
+}
@@ -0,0 +1,100 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const voiceListing = `Pty Language       Age/Gender VoiceName          File                 Other Languages
+ 5  af              --/M      Afrikaans          gmw/af
+ 5  de              --/M      German             gmw/de
+ 2  en-gb           --/M      English_(Great_Britain) gmw/en            (en 2)
+`
+
+// mockVoices replaces the voice listing for the duration of the test and forgets the
+// voices loaded so far.
+func mockVoices(t *testing.T, out string, err error) {
+	t.Helper()
+	reset := func() {
+		voicesOnce, voices, voiceSet = sync.Once{}, nil, nil
+		warnedMu.Lock()
+		warned = map[string]bool{}
+		warnedMu.Unlock()
+	}
+	prev := listVoices
+	listVoices = func() ([]byte, error) { return []byte(out), err }
+	reset()
+	t.Cleanup(func() {
+		listVoices = prev
+		reset()
+	})
+}
+
+func TestParseVoices(t *testing.T) {
+	want := []string{"af", "Afrikaans", "gmw/af", "de", "German", "gmw/de", "en-gb", "English_(Great_Britain)", "gmw/en"}
+	if got := parseVoices(voiceListing); !slices.Equal(got, want) {
+		t.Fatalf("parseVoices = %q, want %q", got, want)
+	}
+}
+
+func TestAvailableVoices(t *testing.T) {
+	mockVoices(t, voiceListing, nil)
+	probeOnce.Do(func() {})
+	prev := available
+	available = true
+	t.Cleanup(func() { available = prev })
+
+	got := AvailableVoices()
+	if !slices.Contains(got, "de") || !slices.Contains(got, "German") || len(got) != 9 {
+		t.Fatalf("AvailableVoices = %q", got)
+	}
+	// callers can't change the package's list
+	got[0] = "changed"
+	if AvailableVoices()[0] != "af" {
+		t.Fatal("AvailableVoices returned the package's own slice")
+	}
+}
+
+func TestMissingVoiceFallsBack(t *testing.T) {
+	mockVoices(t, voiceListing, nil)
+	prevFallback := FallbackVoice
+	t.Cleanup(func() { FallbackVoice = prevFallback })
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	FallbackVoice = "en-gb"
+	ctx := WithVoice(context.Background(), "ja")
+	for range 3 {
+		if args := voiceArgs(ctx, "hello"); !slices.Equal(args, []string{"-v", "en-gb", "hello"}) {
+			t.Fatalf("args for a missing voice = %q, want the fallback", args)
+		}
+	}
+	if n := strings.Count(logs.String(), `voice "ja" is not installed`); n != 1 {
+		t.Fatalf("warned %d times about the missing voice, want once:\n%s", n, logs.String())
+	}
+
+	// installed voices are matched regardless of case
+	if args := voiceArgs(WithVoice(context.Background(), "GERMAN"), "hallo"); !slices.Equal(args, []string{"-v", "GERMAN", "hallo"}) {
+		t.Fatalf("args for an installed voice = %q", args)
+	}
+	// a fallback that isn't installed either leaves the binary's default
+	FallbackVoice = "xx"
+	if args := voiceArgs(WithVoice(context.Background(), "fr"), "bonjour"); !slices.Equal(args, []string{"bonjour"}) {
+		t.Fatalf("args with a missing fallback = %q, want no -v", args)
+	}
+}
+
+func TestVoicesUnknownPassesThrough(t *testing.T) {
+	mockVoices(t, "", errors.New("espeak: not found"))
+	if v := resolveVoice("ja"); v != "ja" {
+		t.Fatalf("resolveVoice without a listing = %q, want the request as is", v)
+	}
+}